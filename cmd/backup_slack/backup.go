@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/metrics"
+	"backup_slack/internal/service"
+)
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	trigger := fs.String("trigger", "manual", "what started this run, recorded in the run history (e.g. scheduled)")
+	metricsFile := fs.String("metrics-file", "", "write Prometheus metrics to this file when the run ends, for node_exporter's textfile collector")
+	fs.Parse(args)
+	start := time.Now()
+
+	// Create only essential data directories
+	dirs := []string{"./data", "./data/storage"}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *metricsFile != "" {
+		defer func() {
+			metrics.RunDuration.Set(time.Since(start).Seconds())
+			updateStoreMetrics(db, cfg.SlackChannels)
+			if err := metrics.WriteFile(*metricsFile); err != nil {
+				logger.Error.Printf("Failed to write metrics: %v", err)
+			}
+		}()
+	}
+
+	logger.Info.Println("Database initialized successfully")
+
+	// Initialize Slack service with channels
+	slackService, err := service.NewSlackService(cfg.SlackAPIToken, db, cfg.StoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize Slack service: %w", err)
+	}
+
+	run, runErr := slackService.RunBackup(*trigger, cfg.SlackChannels)
+	if run.Status == database.RunRunning {
+		// The run couldn't be recorded, but still deserves an alert
+		run.Status, run.Error = database.RunFailed, runErr.Error()
+	}
+	sendAlerts(cfg, db, run)
+	if runErr != nil {
+		return runErr
+	}
+	if run.Status != database.RunSucceeded {
+		logger.Warn.Printf("Backup run %d %s: %s", run.ID, run.Status, run.Error)
+	}
+
+	return nil
+}
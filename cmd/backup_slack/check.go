@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"backup_slack/internal/database"
+)
+
+// runCheck alerts on stale channels and low disk space from the stored
+// sync state, independently of backup runs, so a scheduled backup that
+// stops running altogether is still noticed
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack check\n\n")
+		fmt.Fprintf(fs.Output(), "Checks when each configured channel was last backed up and how full the\n")
+		fmt.Fprintf(fs.Output(), "storage disk is, prints what needs attention and sends alerts for it.\n")
+		fmt.Fprintf(fs.Output(), "Unchanged alerts are resent every NOTIFY_REPEAT_AFTER, and cleared ones\n")
+		fmt.Fprintf(fs.Output(), "are reported once. Run it on a timer of its own, e.g. hourly.\n")
+	}
+	fs.Parse(args)
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenReadOnly(cfg.DBPath, cfg.DBDSN)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var last *database.BackupRun
+	runs, err := db.GetBackupRuns(1)
+	if err != nil {
+		return err
+	}
+	if len(runs) > 0 {
+		last = &runs[0]
+	}
+
+	checker := newChecker(cfg, db)
+	notifications, err := checker.CheckArchive(cfg.SlackChannels, last)
+	if err != nil {
+		return fmt.Errorf("failed to check archive: %w", err)
+	}
+
+	if len(notifications) == 0 {
+		fmt.Println("OK")
+	}
+	for _, n := range notifications {
+		fmt.Println(n.Subject)
+	}
+	deliver(checker, notifiers(cfg), checker.Pending(notifications, last))
+	return nil
+}
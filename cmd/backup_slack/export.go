@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"backup_slack/internal/export"
+)
+
+// runExport writes the archive out in one of the supported formats
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "slack", "export format")
+	out := fs.String("o", "", "output path (default backup_slack-<format>-<date>)")
+	channels := fs.String("channels", "", "comma-separated channel IDs to export (default all)")
+	since := fs.String("since", "", "only export messages on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only export messages before this date (YYYY-MM-DD)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack export [flags]\n\nFormats:\n")
+		for _, f := range export.Formats() {
+			fmt.Fprintf(fs.Output(), "  %-12s %s\n", f.Name, f.Description)
+		}
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	f, err := export.Lookup(*format)
+	if err != nil {
+		return err
+	}
+
+	var opts export.Options
+	if *channels != "" {
+		opts.Filter.ChannelIDs = strings.Split(*channels, ",")
+	}
+	if opts.Filter.Since, err = parseDate(*since); err != nil {
+		return err
+	}
+	if opts.Filter.Until, err = parseDate(*until); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("backup_slack-%s-%s%s", f.Name, time.Now().Format("20060102"), f.Ext)
+	}
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := f.Write(db, opts, *out); err != nil {
+		return fmt.Errorf("failed to export %s: %w", f.Name, err)
+	}
+
+	fmt.Printf("Wrote %s\n", *out)
+	return nil
+}
+
+// parseDate parses an optional YYYY-MM-DD flag as local midnight
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD", value)
+	}
+	return day, nil
+}
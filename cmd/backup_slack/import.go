@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"backup_slack/internal/files"
+	"backup_slack/internal/importer"
+)
+
+// runImport merges a Slack workspace export into the archive
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	withFiles := fs.Bool("files", false, "store referenced files under STORAGE_PATH, downloading those not included in the export")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack import [-files] <export.zip>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected the path of one export ZIP")
+	}
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var opts importer.Options
+	if *withFiles {
+		storage, err := files.NewFileStorage(cfg.StoragePath, 1024*1024*1024) // 1GB max file size
+		if err != nil {
+			return fmt.Errorf("failed to create file storage: %w", err)
+		}
+		opts.Storage = storage
+		opts.Token = cfg.SlackAPIToken
+	}
+
+	stats, err := importer.ImportSlack(db, fs.Arg(0), opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %d channels, %d users, %d messages and %d reactions, and imported %d files\n",
+		stats.Channels, stats.Users, stats.Messages, stats.Reactions, stats.Files)
+	if stats.MessagesSkipped > 0 {
+		fmt.Printf("Kept %d messages already in the archive as they were\n", stats.MessagesSkipped)
+	}
+	if *withFiles {
+		fmt.Printf("Stored %d files, linked %d duplicates, skipped %d already archived\n",
+			stats.FilesStored, stats.FilesLinked, stats.FilesSkipped)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"backup_slack/internal/logger"
+	"backup_slack/internal/service"
+	"backup_slack/internal/status"
+)
+
+// runListen receives Slack events for the configured channels, either as
+// Events API requests or over Socket Mode, and stores them as they arrive,
+// alongside the scheduled backups
+func runListen(args []string) error {
+	fs := flag.NewFlagSet("listen", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:3000", "address to listen on")
+	path := fs.String("path", "/slack/events", "request URL path configured in the Slack app")
+	socket := fs.Bool("socket", false, "connect to Slack in Socket Mode instead of serving HTTP")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics at /metrics, /healthz and /status on this address")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack listen [-addr host:port] [-path /slack/events]\n")
+		fmt.Fprintf(fs.Output(), "       backup_slack listen -socket\n\n")
+		fmt.Fprintf(fs.Output(), "Over HTTP, requires SLACK_SIGNING_SECRET. Slack needs an HTTPS URL, so\n")
+		fmt.Fprintf(fs.Output(), "run it behind a reverse proxy that terminates TLS. Socket Mode needs no\n")
+		fmt.Fprintf(fs.Output(), "public endpoint and requires an app-level token in SLACK_APP_TOKEN.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+	if *socket && cfg.AppToken == "" {
+		return fmt.Errorf("SLACK_APP_TOKEN is required for Socket Mode")
+	}
+	if !*socket && cfg.SigningSecret == "" {
+		return fmt.Errorf("SLACK_SIGNING_SECRET is required to verify Slack requests")
+	}
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	slackService, err := service.NewSlackService(cfg.SlackAPIToken, db, cfg.StoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize Slack service: %w", err)
+	}
+	// Events refer to channels by ID, so they have to be stored first
+	if err := slackService.Initialize(cfg.SlackChannels); err != nil {
+		return fmt.Errorf("failed to initialize channels: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *metricsAddr != "" {
+		go serveMonitoring(ctx, *metricsAddr, db, status.Source{
+			Archive:     db,
+			Workspace:   cfg.Workspace,
+			ChannelIDs:  cfg.SlackChannels,
+			StoragePath: cfg.StoragePath,
+			Queued:      slackService.Queued,
+		})
+	}
+
+	if *socket {
+		if err := slackService.RunSocketMode(ctx, cfg.AppToken, cfg.SlackChannels); err != nil {
+			return err
+		}
+		logger.Info.Printf("Event listener stopped")
+		return nil
+	}
+
+	events := slackService.NewEventHandler(cfg.SigningSecret, cfg.SlackChannels)
+	mux := http.NewServeMux()
+	mux.Handle(*path, events)
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	logger.Info.Printf("Listening for Slack events on http://%s%s for %d channels", *addr, *path, len(cfg.SlackChannels))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		events.Close()
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	// Apply whatever was acknowledged before shutting down
+	events.Close()
+	logger.Info.Printf("Event listener stopped")
+	return nil
+}
@@ -1,18 +1,43 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"backup_slack/internal/config"
 	"backup_slack/internal/database"
 	"backup_slack/internal/logger"
-	"backup_slack/internal/service"
 
 	"github.com/joho/godotenv"
 )
 
+// command is a backup_slack subcommand. Running the binary without one
+// performs a backup, which older systemd units rely on.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"backup", "Back up the configured channels (default)", runBackup},
+	{"check", "Alert on stale channels and low disk space", runCheck},
+	{"export", "Export the archive to another format", runExport},
+	{"import", "Import a Slack workspace export ZIP", runImport},
+	{"listen", "Capture messages as they happen via the Events API", runListen},
+	{"migrate", "Show or change the database schema version", runMigrate},
+	{"migrate-db", "Copy a SQLite archive into PostgreSQL", runMigrateDB},
+	{"runs", "List past backup runs", runRuns},
+	{"search", "Search archived messages", runSearch},
+	{"serve", "Browse the archive in a web browser", runServe},
+	{"status", "Show the last run, channel freshness and archive size", runStatus},
+}
+
 func init() {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -21,61 +46,108 @@ func init() {
 }
 
 func main() {
-	// Create only essential data directories
-	dirs := []string{"./data", "./data/storage"}
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Fatalf("Failed to create directory %s: %v", dir, err)
-		}
+	name, args := "backup", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	if name == "help" {
+		usage()
+		return
 	}
 
-	// Initialize logger with configured log directory and level
-	if err := logger.Init(cfg.LogDir, logger.ParseLogLevel(cfg.LogLevel)); err != nil {
-		log.Fatalf("Failed to initialize logger: %v", err)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err != nil {
+			if logger.Error != nil {
+				logger.Error.Printf("%s failed: %v", name, err)
+			}
+			// Don't repeat the error on stderr if the log just went there
+			if logger.Error == nil || !logger.ToStderr() {
+				log.Printf("%s failed: %v", name, err)
+			}
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Initialize database
-	dbDir := filepath.Dir(cfg.DBPath)
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		logger.Error.Fatalf("Failed to create database directory: %v", err)
-	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	db, err := database.New(cfg.DBPath)
-	if err != nil {
-		logger.Error.Fatalf("Failed to initialize database: %v", err)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: backup_slack [command] [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.summary)
 	}
-	defer db.Close()
-
-	logger.Info.Println("Database initialized successfully")
+	fmt.Fprintf(os.Stderr, "\nRun 'backup_slack <command> -h' for command flags.\n")
+}
 
-	// Initialize Slack service with channels
-	slackService, err := service.NewSlackService(cfg.SlackAPIToken, db, cfg.StoragePath)
+// setup loads configuration and initializes the logger
+func setup() (*config.Config, error) {
+	cfg, err := config.Load()
 	if err != nil {
-		logger.Error.Fatalf("Failed to initialize Slack service: %v", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Initialize channels
-	if err := slackService.Initialize(cfg.SlackChannels); err != nil {
-		logger.Error.Fatalf("Failed to initialize channels: %v", err)
+	// Initialize logger with configured log directory, level and format
+	opts := logger.Options{
+		Level:  logger.ParseLogLevel(cfg.LogLevel),
+		Format: cfg.LogFormat,
+		Stderr: cfg.LogOutput != "file",
+		Rotation: logger.Rotation{
+			MaxSize:    int64(cfg.LogMaxSizeMB) << 20,
+			Interval:   cfg.LogInterval,
+			MaxBackups: cfg.LogMaxBackups,
+			Compress:   cfg.LogCompress,
+		},
+	}
+	if cfg.LogOutput != "stderr" {
+		opts.Dir = cfg.LogDir
+	}
+	if cfg.Workspace != "" {
+		opts.Fields = []any{"workspace", cfg.Workspace}
 	}
+	if err := logger.Configure(opts); err != nil {
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	reopenLogOnHangup()
 
-	logger.Info.Println("Slack service initialized successfully")
-	logger.Info.Printf("Configured to backup %d channels: %v", len(cfg.SlackChannels), cfg.SlackChannels)
+	return cfg, nil
+}
 
-	// Start backing up messages from each channel
-	for _, channelID := range cfg.SlackChannels {
-		channelName := slackService.GetChannelName(channelID)
-		logger.Info.Printf("Starting backup for channel %s (#%s)", channelID, channelName)
-		if err := slackService.BackupChannelMessages(channelID); err != nil {
-			logger.Error.Printf("Failed to backup channel %s (#%s): %v", channelID, channelName, err)
-			continue
+// reopenLogOnHangup reopens the log file on SIGHUP, as logrotate expects
+// after moving it
+func reopenLogOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := logger.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to reopen log file: %v\n", err)
+				continue
+			}
+			logger.Info.Printf("Reopened log file on SIGHUP")
 		}
-		logger.Info.Printf("Completed backup for channel %s (#%s)", channelID, channelName)
+	}()
+}
+
+// openStore opens the configured database, PostgreSQL if DB_DSN is set and
+// SQLite at DB_PATH otherwise
+func openStore(cfg *config.Config) (*database.DB, error) {
+	if cfg.DBDSN == "" {
+		dbDir := filepath.Dir(cfg.DBPath)
+		if err := os.MkdirAll(dbDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	db, err := database.Open(cfg.DBPath, cfg.DBDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
+	return db, nil
 }
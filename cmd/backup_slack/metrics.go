@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/metrics"
+	"backup_slack/internal/status"
+)
+
+// updateStoreMetrics refreshes the metrics read from the archive rather
+// than counted as work happens
+func updateStoreMetrics(db *database.DB, channelIDs []string) {
+	if size, err := db.Size(); err != nil {
+		logger.Warn.Printf("Failed to read database size for metrics: %v", err)
+	} else {
+		metrics.DatabaseSize.Set(float64(size))
+	}
+
+	for _, channelID := range channelIDs {
+		state, err := db.GetSyncState(channelID)
+		if err != nil {
+			logger.Warn.Printf("Failed to read sync state of channel %s for metrics: %v", channelID, err)
+			continue
+		}
+		if !state.LastSyncAt.IsZero() {
+			metrics.LastSync.Set(float64(state.LastSyncAt.Unix()), channelID)
+		}
+	}
+}
+
+// serveMonitoring serves /metrics, /healthz and /status on addr until ctx
+// is cancelled
+func serveMonitoring(ctx context.Context, addr string, db *database.DB, src status.Source) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		updateStoreMetrics(db, src.ChannelIDs)
+		metrics.Handler().ServeHTTP(w, r)
+	})
+	mux.HandleFunc("GET /healthz", src.ServeHealth)
+	mux.HandleFunc("GET /status", src.ServeStatus)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	logger.Info.Printf("Serving metrics, health and status on http://%s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error.Printf("Failed to serve metrics: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"backup_slack/internal/database"
+)
+
+// runMigrate reports or changes the database schema version
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: backup_slack migrate [status | up | down [N] | to N]\n")
+	}
+	fs.Parse(args)
+
+	action := "status"
+	if fs.NArg() > 0 {
+		action = fs.Arg(0)
+	}
+
+	// Validate arguments before touching the database
+	var n int
+	switch action {
+	case "status", "up":
+		if fs.NArg() > 1 {
+			fs.Usage()
+			return fmt.Errorf("%s takes no arguments", action)
+		}
+	case "down":
+		n = 1
+		if fs.NArg() > 1 {
+			steps, err := strconv.Atoi(fs.Arg(1))
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", fs.Arg(1))
+			}
+			n = steps
+		}
+	case "to":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return fmt.Errorf("to requires a version")
+		}
+		version, err := strconv.Atoi(fs.Arg(1))
+		if err != nil {
+			return fmt.Errorf("invalid version %q", fs.Arg(1))
+		}
+		n = version
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	m, err := database.OpenMigrator(cfg.DBPath, cfg.DBDSN)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch action {
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Down(n)
+	case "to":
+		err = m.To(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printMigrationStatus(m)
+}
+
+func printMigrationStatus(m *database.Migrator) error {
+	current, err := m.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version %d (latest supported %d)\n\n", current, m.LatestVersion())
+	unverified := false
+	for _, s := range statuses {
+		state := "pending"
+		if !s.AppliedAt.IsZero() {
+			state = "applied " + s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		name := s.Name
+		switch {
+		case s.Unknown:
+			name = "(unknown to this binary)"
+		case s.Modified:
+			state += "  MODIFIED"
+		case s.Unverified:
+			state += "  unverified*"
+			unverified = true
+		}
+		fmt.Printf("  %3d  %-24s %s\n", s.Version, name, state)
+	}
+	if unverified {
+		fmt.Printf("\n* applied before checksums were recorded; changes made before this version of backup_slack can't be detected\n")
+	}
+	return nil
+}
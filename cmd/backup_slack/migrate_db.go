@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// runMigrateDB copies an existing SQLite archive into PostgreSQL
+func runMigrateDB(args []string) error {
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("migrate-db", flag.ExitOnError)
+	from := fs.String("from", cfg.DBPath, "SQLite database to copy from")
+	to := fs.String("to", cfg.DBDSN, "PostgreSQL DSN to copy into")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both -from (or DB_PATH) and -to (or DB_DSN) are required")
+	}
+
+	src, err := database.New(*from)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := database.NewPostgres(*to)
+	if err != nil {
+		return fmt.Errorf("failed to open PostgreSQL database: %w", err)
+	}
+	defer dst.Close()
+
+	logger.Info.Printf("Copying %s into PostgreSQL", *from)
+	stats, err := database.Copy(dst, src)
+	if err != nil {
+		return err
+	}
+
+	logger.Info.Printf("Copy complete: %+v", stats)
+	fmt.Printf("Copied %d channels, %d users, %d messages, %d reactions, %d files and %d backup runs\n",
+		stats.Channels, stats.Users, stats.Messages, stats.Reactions, stats.Files, stats.Runs)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"backup_slack/internal/config"
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/notify"
+)
+
+// notifiers returns the alert destinations configured in cfg
+func notifiers(cfg *config.Config) notify.Multi {
+	var m notify.Multi
+	if cfg.NotifyWebhookURL != "" {
+		m = append(m, notify.Webhook{URL: cfg.NotifyWebhookURL})
+	}
+	if cfg.NotifySlackWebhookURL != "" {
+		m = append(m, notify.SlackWebhook{URL: cfg.NotifySlackWebhookURL})
+	}
+	if cfg.SMTPAddr != "" && len(cfg.NotifyEmailTo) > 0 {
+		m = append(m, notify.Email{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.NotifyEmailFrom,
+			To:       cfg.NotifyEmailTo,
+		})
+	}
+	return m
+}
+
+// sendAlerts checks a finished run and sends whatever alerts it calls for.
+// Failing to alert is logged rather than failing the run.
+func sendAlerts(cfg *config.Config, db database.Store, run database.BackupRun) {
+	m := notifiers(cfg)
+	if len(m) == 0 {
+		return
+	}
+
+	checker := newChecker(cfg, db)
+	notifications, err := checker.Check(run)
+	if err != nil {
+		// Without a complete check, cleared conditions can't be told apart
+		logger.Error.Printf("Failed to check backup run %d for alerts: %v", run.ID, err)
+	} else {
+		notifications = checker.Pending(notifications, &run)
+	}
+	deliver(checker, m, notifications)
+}
+
+// newChecker returns a checker for the alerts configured in cfg
+func newChecker(cfg *config.Config, db database.Store) notify.Checker {
+	return notify.Checker{
+		Store:          db,
+		StoragePath:    cfg.StoragePath,
+		StaleAfter:     cfg.StaleAfter,
+		MinFreePercent: cfg.MinFreeDiskPercent,
+		StatePath:      cfg.NotifyStatePath,
+		RepeatAfter:    cfg.NotifyRepeatAfter,
+	}
+}
+
+// deliver sends each notification, logging any that fail, and records the
+// ones that went out so they aren't repeated before they're due
+func deliver(checker notify.Checker, m notify.Multi, notifications []notify.Notification) {
+	if len(m) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var delivered []notify.Notification
+	for _, n := range notifications {
+		if n.Resolved {
+			logger.Info.Printf("Sending alert: %s", n.Subject)
+		} else {
+			logger.Warn.Printf("Sending alert: %s", n.Subject)
+		}
+		if err := m.Notify(ctx, n); err != nil {
+			logger.Error.Printf("Failed to send alert %q: %v", n.Subject, err)
+			continue
+		}
+		delivered = append(delivered, n)
+	}
+	if err := checker.Record(delivered); err != nil {
+		logger.Error.Printf("Failed to record sent alerts: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+const runTimeLayout = "2006-01-02 15:04:05"
+
+// runRuns lists past backup runs, or shows one run in detail
+func runRuns(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "number of runs to list, 0 for all")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack runs [-limit N]\n")
+		fmt.Fprintf(fs.Output(), "       backup_slack runs <run-id>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var runID int64
+	if fs.NArg() > 0 {
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil || id <= 0 {
+			fs.Usage()
+			return fmt.Errorf("invalid run ID %q", fs.Arg(0))
+		}
+		runID = id
+	}
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if runID != 0 {
+		return showRun(db, runID)
+	}
+
+	runs, err := db.GetBackupRuns(*limit)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Println("No backup runs recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tDURATION\tTRIGGER\tSTATUS\tMESSAGES\tFILES\tBYTES\tAPI CALLS")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			run.ID, run.StartedAt.Local().Format(runTimeLayout), runDuration(run), run.Trigger, run.Status,
+			run.Messages(), run.Files(), run.BytesDownloaded, run.APICalls)
+	}
+	return w.Flush()
+}
+
+// showRun prints a run with what it stored from each channel
+func showRun(db *database.DB, id int64) error {
+	run, err := db.GetBackupRun(id)
+	if errors.Is(err, database.ErrRunNotFound) {
+		return fmt.Errorf("no backup run with ID %d", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	channels, err := db.GetChannels()
+	if err != nil {
+		return err
+	}
+	names := make(map[string]string, len(channels))
+	for _, ch := range channels {
+		names[ch.ID] = ch.Name
+	}
+
+	finished := "-"
+	if !run.FinishedAt.IsZero() {
+		finished = run.FinishedAt.Local().Format(runTimeLayout)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Run:\t%d\n", run.ID)
+	fmt.Fprintf(w, "Started:\t%s\n", run.StartedAt.Local().Format(runTimeLayout))
+	fmt.Fprintf(w, "Finished:\t%s\n", finished)
+	fmt.Fprintf(w, "Duration:\t%s\n", runDuration(run))
+	fmt.Fprintf(w, "Trigger:\t%s\n", run.Trigger)
+	fmt.Fprintf(w, "Status:\t%s\n", run.Status)
+	if run.Error != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", run.Error)
+	}
+	fmt.Fprintf(w, "Messages:\t%d\n", run.Messages())
+	fmt.Fprintf(w, "Files:\t%d\n", run.Files())
+	fmt.Fprintf(w, "Downloaded:\t%d bytes\n", run.BytesDownloaded)
+	fmt.Fprintf(w, "API calls:\t%d\n", run.APICalls)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(run.Channels) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tNAME\tMESSAGES\tFILES\tBYTES\tERROR")
+	for _, ch := range run.Channels {
+		name := "-"
+		if n, ok := names[ch.ChannelID]; ok {
+			name = "#" + n
+		}
+		errText := ch.Error
+		if errText == "" {
+			errText = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n",
+			ch.ChannelID, name, ch.Messages, ch.Files, ch.BytesDownloaded, errText)
+	}
+	return w.Flush()
+}
+
+// runDuration formats how long a run took, or "-" if it is still running
+// or was interrupted
+func runDuration(run database.BackupRun) string {
+	if run.FinishedAt.IsZero() {
+		return "-"
+	}
+	return run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+}
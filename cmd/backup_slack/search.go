@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/slack"
+)
+
+// runSearch queries the archive using Slack-style search syntax
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "maximum number of results")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack search [-limit N] <query>\n\n")
+		fmt.Fprintf(fs.Output(), "Query syntax: words, \"exact phrases\", from:@user, in:#channel,\n")
+		fmt.Fprintf(fs.Output(), "before:YYYY-MM-DD, after:YYYY-MM-DD, has:file\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no search query given")
+	}
+
+	query, err := database.ParseSearchQuery(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	query.Limit = *limit
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	results, err := db.SearchMessages(query)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No messages found")
+		return nil
+	}
+
+	for _, r := range results {
+		msg := r.Message
+		fmt.Printf("#%s  %s  %s\n", r.ChannelName, r.Username, msg.Timestamp.Local().Format("2006-01-02 15:04"))
+		fmt.Printf("    %s\n", strings.ReplaceAll(r.Snippet, "\n", "\n    "))
+		fmt.Printf("    %s\n\n", slack.Permalink(cfg.WorkspaceURL, msg.ChannelID, msg.ID, msg.ThreadTS.String))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/web"
+)
+
+// runServe serves a read-only web UI for browsing and searching the archive
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack serve [-addr host:port]\n\n")
+		fmt.Fprintf(fs.Output(), "The database is opened read-only, so serve can run alongside backups.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenReadOnly(cfg.DBPath, cfg.DBDSN)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	srv := &http.Server{
+		Addr: *addr,
+		Handler: web.New(db, web.Options{
+			StoragePath:  cfg.StoragePath,
+			WorkspaceURL: cfg.WorkspaceURL,
+			APITokens:    cfg.APITokens,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	if len(cfg.APITokens) == 0 {
+		logger.Info.Printf("API_TOKENS is not set; the JSON API will refuse all requests")
+	}
+	logger.Info.Printf("Serving archive on http://%s", *addr)
+	fmt.Printf("Serving archive on http://%s\n", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	logger.Info.Printf("Server stopped")
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/status"
+)
+
+// runStatus prints the state of the archive, asking a running listener
+// when given its address and reading the database otherwise
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	addr := fs.String("addr", "", "ask the listener serving /status on this address first")
+	asJSON := fs.Bool("json", false, "print the status as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backup_slack status [-addr host:port] [-json]\n\n")
+		fmt.Fprintf(fs.Output(), "Without -addr, or when nothing answers there, the status is read from\n")
+		fmt.Fprintf(fs.Output(), "the database, opened read-only so it can run alongside backups. Queued\n")
+		fmt.Fprintf(fs.Output(), "events are only known to a running listener.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := setup()
+	if err != nil {
+		return err
+	}
+
+	var report status.Report
+	fetched := false
+	if *addr != "" {
+		if report, err = fetchStatus(*addr); err != nil {
+			logger.Warn.Printf("Failed to get status from %s, reading the database: %v", *addr, err)
+		} else {
+			fetched = true
+		}
+	}
+	if !fetched {
+		db, err := database.OpenReadOnly(cfg.DBPath, cfg.DBDSN)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+
+		src := status.Source{
+			Archive:     db,
+			Workspace:   cfg.Workspace,
+			ChannelIDs:  cfg.SlackChannels,
+			StoragePath: cfg.StoragePath,
+		}
+		if report, err = src.Report(); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return printStatus(report)
+}
+
+// fetchStatus gets the status from a running listener
+func fetchStatus(addr string) (status.Report, error) {
+	var report status.Report
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + "/status")
+	if err != nil {
+		return report, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return report, fmt.Errorf("listener returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return report, fmt.Errorf("failed to decode status: %w", err)
+	}
+	return report, nil
+}
+
+func printStatus(report status.Report) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if report.Workspace != "" {
+		fmt.Fprintf(w, "Workspace:\t%s\n", report.Workspace)
+	}
+	if run := report.LastRun; run != nil {
+		duration := "-"
+		if run.FinishedAt != nil {
+			duration = run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "Last run:\t%d (%s) %s, started %s, took %s\n",
+			run.ID, run.Trigger, run.Status, run.StartedAt.Local().Format(runTimeLayout), duration)
+		if run.Error != "" {
+			fmt.Fprintf(w, "Error:\t%s\n", run.Error)
+		}
+	} else {
+		fmt.Fprintf(w, "Last run:\tnone recorded\n")
+	}
+	fmt.Fprintf(w, "Database:\t%d bytes\n", report.DatabaseBytes)
+	fmt.Fprintf(w, "Storage:\t%d bytes\n", report.StorageBytes)
+	if report.Queued != nil {
+		fmt.Fprintf(w, "Queued:\t%d\n", *report.Queued)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Channels) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tNAME\tMESSAGES\tLAST SYNC\tAGE")
+	for _, ch := range report.Channels {
+		name, lastSync, age := "-", "never", "-"
+		if ch.Name != "" {
+			name = "#" + ch.Name
+		}
+		if ch.LastSyncAt != nil {
+			lastSync = ch.LastSyncAt.Local().Format(runTimeLayout)
+			age = report.Time.Sub(*ch.LastSyncAt).Round(time.Minute).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", ch.ID, name, ch.Messages, lastSync, age)
+	}
+	return w.Flush()
+}
@@ -5,20 +5,46 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Config holds all configuration for the application
 type Config struct {
 	SlackAPIToken string
 	SlackChannels []string
+	WorkspaceURL  string // e.g. https://example.slack.com, used to build permalinks
 	DBPath        string
+	DBDSN         string // PostgreSQL connection string; SQLite at DBPath is used when empty
 	StoragePath   string
 	LogPath       string
 	MaxRetries    int
 	BatchSize     int
 	LogLevel      string
+	LogFormat     string        // text or json
+	LogOutput     string        // file, stderr or both
+	LogMaxSizeMB  int           // rotate the log file at this size; 0 disables
+	LogInterval   time.Duration // rotate the log file this often; 0 disables
+	LogMaxBackups int           // rotated log files to keep; 0 keeps all
+	LogCompress   bool          // gzip rotated log files
 	Environment   string
-	LogDir        string // New field for explicit log directory
+	Workspace     string   // added to every log line
+	LogDir        string   // New field for explicit log directory
+	APITokens     []string // bearer tokens for serve's JSON API
+	SigningSecret string   // verifies Slack Events API requests to listen
+	AppToken      string   // app-level token for listen -socket
+
+	// Alerts sent after each backup run
+	NotifyWebhookURL      string // generic JSON webhook
+	NotifySlackWebhookURL string // Slack incoming webhook
+	SMTPAddr              string // host:port of the mail server for alert emails
+	SMTPUsername          string // no SMTP authentication if empty
+	SMTPPassword          string
+	NotifyEmailFrom       string
+	NotifyEmailTo         []string
+	StaleAfter            time.Duration // alert on channels not backed up for longer; 0 disables
+	MinFreeDiskPercent    float64       // alert when storage has less free space; 0 disables
+	NotifyRepeatAfter     time.Duration // resend an unchanged alert this often; 0 never
+	NotifyStatePath       string        // remembers which alerts were sent
 }
 
 // Load returns a Config struct populated with current configuration
@@ -39,8 +65,12 @@ func Load() (*Config, error) {
 	}
 	c.SlackChannels = strings.Split(channels, ",")
 
+	c.WorkspaceURL = getEnvOrDefault("SLACK_WORKSPACE_URL", "")
+
+	// Either a PostgreSQL DSN or a SQLite path is required
+	c.DBDSN = getEnvOrDefault("DB_DSN", "")
 	c.DBPath = getEnvOrDefault("DB_PATH", "")
-	if c.DBPath == "" {
+	if c.DBPath == "" && c.DBDSN == "" {
 		missingVars = append(missingVars, "DB_PATH")
 	}
 
@@ -58,25 +88,74 @@ func Load() (*Config, error) {
 	c.MaxRetries = getEnvAsIntOrDefault("MAX_RETRIES", 3)
 	c.BatchSize = getEnvAsIntOrDefault("BATCH_SIZE", 100)
 	c.LogLevel = getEnvOrDefault("LOG_LEVEL", "INFO")
+	c.LogFormat = strings.ToLower(getEnvOrDefault("LOG_FORMAT", "text"))
+	c.LogOutput = strings.ToLower(getEnvOrDefault("LOG_OUTPUT", "file"))
+	c.LogMaxSizeMB = getEnvAsIntOrDefault("LOG_MAX_SIZE_MB", 100)
+	c.LogInterval = getEnvAsDurationOrDefault("LOG_ROTATE_INTERVAL", 0)
+	c.LogMaxBackups = getEnvAsIntOrDefault("LOG_MAX_BACKUPS", 7)
+	c.LogCompress = getEnvAsBoolOrDefault("LOG_COMPRESS", true)
+
+	c.SigningSecret = getEnvOrDefault("SLACK_SIGNING_SECRET", "")
+	c.AppToken = getEnvOrDefault("SLACK_APP_TOKEN", "")
+
+	c.APITokens = getEnvAsList("API_TOKENS")
+
+	c.NotifyWebhookURL = getEnvOrDefault("NOTIFY_WEBHOOK_URL", "")
+	c.NotifySlackWebhookURL = getEnvOrDefault("NOTIFY_SLACK_WEBHOOK_URL", "")
+	c.SMTPAddr = getEnvOrDefault("SMTP_ADDR", "")
+	c.SMTPUsername = getEnvOrDefault("SMTP_USERNAME", "")
+	c.SMTPPassword = getEnvOrDefault("SMTP_PASSWORD", "")
+	c.NotifyEmailFrom = getEnvOrDefault("NOTIFY_EMAIL_FROM", "")
+	c.NotifyEmailTo = getEnvAsList("NOTIFY_EMAIL_TO")
+	c.StaleAfter = getEnvAsDurationOrDefault("NOTIFY_STALE_AFTER", 48*time.Hour)
+	c.MinFreeDiskPercent = getEnvAsFloatOrDefault("NOTIFY_MIN_FREE_DISK_PERCENT", 10)
+	c.NotifyRepeatAfter = getEnvAsDurationOrDefault("NOTIFY_REPEAT_AFTER", 24*time.Hour)
+	// Next to the SQLite database, or in the storage directory for PostgreSQL
+	c.NotifyStatePath = getEnvOrDefault("NOTIFY_STATE_PATH", "")
+	if c.NotifyStatePath == "" {
+		if c.DBPath != "" {
+			c.NotifyStatePath = c.DBPath + ".alerts.json"
+		} else if c.StoragePath != "" {
+			c.NotifyStatePath = filepath.Join(c.StoragePath, "alerts.json")
+		}
+	}
 
 	// Environment with default
 	c.Environment = getEnvOrDefault("ENVIRONMENT", "development")
 
+	// Workspace name, set by the systemd unit or taken from the working directory
+	c.Workspace = getEnvOrDefault("WORKSPACE", "")
+	if c.Workspace == "" && c.Environment == "production" {
+		workDir, _ := os.Getwd()
+		c.Workspace = filepath.Base(workDir)
+	}
+
 	// Get explicit log directory if specified
 	c.LogDir = getEnvOrDefault("LOG_DIR", "")
 
 	// If LogDir not explicitly set, use default based on environment
 	if c.LogDir == "" {
 		if c.Environment == "production" {
-			// Get workspace name from working directory
-			workDir, _ := os.Getwd()
-			workspace := filepath.Base(workDir)
-			c.LogDir = filepath.Join("/var/log/backup_slack", workspace)
+			c.LogDir = filepath.Join("/var/log/backup_slack", c.Workspace)
 		} else {
 			c.LogDir = "./logs"
 		}
 	}
 
+	switch c.LogFormat {
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q: must be text or json", c.LogFormat)
+	}
+	switch c.LogOutput {
+	case "file", "stderr", "both":
+	case "stdout":
+		// Logs never go to stdout, where commands print their results
+		c.LogOutput = "stderr"
+	default:
+		return nil, fmt.Errorf("invalid LOG_OUTPUT %q: must be file, stderr or both", c.LogOutput)
+	}
+
 	if len(missingVars) > 0 {
 		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missingVars, ", "))
 	}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"fmt"
+
+	"backup_slack/internal/logger"
+)
+
+// CopyStats summarises what Copy transferred
+type CopyStats struct {
+	Channels  int
+	Users     int
+	Messages  int
+	Reactions int
+	Files     int
+	Runs      int
+}
+
+// Copy transfers the whole archive from src into dst. Every table is
+// upserted, so copying into a store that already holds part of the archive
+// is safe. Each channel is written in its own batch to bound transaction size.
+func Copy(dst, src Store) (CopyStats, error) {
+	var stats CopyStats
+
+	channels, err := src.GetChannels()
+	if err != nil {
+		return stats, fmt.Errorf("failed to read channels: %w", err)
+	}
+	users, err := src.GetUsers()
+	if err != nil {
+		return stats, fmt.Errorf("failed to read users: %w", err)
+	}
+
+	err = dst.Batch(func(w Writer) error {
+		for _, ch := range channels {
+			if err := w.InsertChannel(ch); err != nil {
+				return err
+			}
+		}
+		for _, u := range users {
+			if err := w.InsertUser(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to copy channels and users: %w", err)
+	}
+	stats.Channels = len(channels)
+	stats.Users = len(users)
+
+	for _, ch := range channels {
+		filter := MessageFilter{ChannelIDs: []string{ch.ID}}
+
+		messages, err := src.GetMessages(filter)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read messages for channel %s: %w", ch.ID, err)
+		}
+		reactions, err := src.GetReactions(filter)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read reactions for channel %s: %w", ch.ID, err)
+		}
+		files, err := src.GetFiles(filter)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read files for channel %s: %w", ch.ID, err)
+		}
+		members, err := src.GetChannelMembers(ch.ID)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read members for channel %s: %w", ch.ID, err)
+		}
+
+		err = dst.Batch(func(w Writer) error {
+			for _, msg := range messages {
+				if err := w.InsertMessage(msg); err != nil {
+					return err
+				}
+			}
+			for _, r := range reactions {
+				if err := w.InsertReaction(r); err != nil {
+					return err
+				}
+			}
+			for _, f := range files {
+				if err := w.InsertFile(f); err != nil {
+					return err
+				}
+			}
+			for _, id := range members {
+				if err := w.InsertChannelMember(ChannelMember{ChannelID: ch.ID, UserID: id}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("failed to copy channel %s: %w", ch.ID, err)
+		}
+
+		state, err := src.GetSyncState(ch.ID)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read sync state for channel %s: %w", ch.ID, err)
+		}
+		if !state.LastSyncAt.IsZero() {
+			if err := dst.UpdateSyncState(state); err != nil {
+				return stats, fmt.Errorf("failed to copy sync state for channel %s: %w", ch.ID, err)
+			}
+		}
+
+		stats.Messages += len(messages)
+		stats.Reactions += len(reactions)
+		stats.Files += len(files)
+		logger.Info.Printf("Copied channel %s (#%s): %d messages, %d reactions, %d files",
+			ch.ID, ch.Name, len(messages), len(reactions), len(files))
+	}
+
+	// Runs keep their IDs, so copying them again replaces rather than
+	// duplicates them
+	runs, err := src.GetBackupRuns(0)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read backup runs: %w", err)
+	}
+	for _, run := range runs {
+		if _, err := dst.SaveBackupRun(run); err != nil {
+			return stats, fmt.Errorf("failed to copy backup run %d: %w", run.ID, err)
+		}
+	}
+	stats.Runs = len(runs)
+
+	return stats, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"backup_slack/internal/logger"
@@ -14,6 +15,26 @@ import (
 
 type DB struct {
 	*sql.DB
+	writer
+	fts5 bool // SQLite full-text index available, see setupSearchIndex
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx so the writes can run
+// either directly or as part of a batch
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// writer implements the upserts shared by DB and Tx for a given dialect
+type writer struct {
+	exec    execer
+	dialect dialect
+}
+
+// Tx groups writes into a single transaction so that a page of messages is
+// committed atomically instead of one autocommit per row
+type Tx struct {
+	writer
 }
 
 type Channel struct {
@@ -58,16 +79,61 @@ type File struct {
 	Checksum        string
 }
 
+type Reaction struct {
+	MessageID string
+	UserID    string
+	Emoji     string
+	Timestamp time.Time
+}
+
+// ChannelMember records that a user belongs to a channel, as listed in a
+// Slack export. Members are known even if they never posted.
+type ChannelMember struct {
+	ChannelID string
+	UserID    string
+}
+
+// SyncState records when a channel was last backed up successfully
+type SyncState struct {
+	ChannelID  string
+	LastSyncAt time.Time
+}
+
 // New creates a new database connection and ensures schema is up to date
 func New(dbPath string) (*DB, error) {
+	db, err := openSQLite(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply migrations
+	if err := (&Migrator{db: db, dialect: dialectSQLite}).Up(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	fts5, err := setupSearchIndex(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{DB: db, writer: writer{exec: db, dialect: dialectSQLite}, fts5: fts5}, nil
+}
+
+// openSQLite opens and verifies a SQLite connection without touching the schema
+func openSQLite(dbPath string) (*sql.DB, error) {
 	// Ensure database directory exists
 	dbDir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	// Open database connection
-	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
+	// Open database connection. WAL lets readers run alongside the backup job,
+	// and synchronous=NORMAL is durable enough in WAL mode while avoiding an
+	// fsync on every commit.
+	dsn := dbPath + "?_foreign_keys=on&_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000"
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -78,13 +144,83 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Apply migrations
-	if err := applyMigrations(db); err != nil {
+	return db, nil
+}
+
+// OpenReadOnly opens an existing database for browsing. It never applies
+// migrations or writes, so it can run alongside the backup job, and refuses
+// databases whose schema isn't the one this binary expects.
+func OpenReadOnly(dbPath, dsn string) (*DB, error) {
+	var (
+		db   *sql.DB
+		d    = dialectSQLite
+		fts5 bool
+		err  error
+	)
+	if dsn != "" {
+		d = dialectPostgres
+		db, err = openPostgres(readOnlyDSN(dsn))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := os.Stat(dbPath); err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		db, err = sql.Open("sqlite3", "file:"+dbPath+"?mode=ro&_busy_timeout=5000")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to ping database: %w", err)
+		}
+		if fts5, err = searchIndexReady(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	m := &Migrator{db: db, dialect: d}
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	switch latest := m.LatestVersion(); {
+	case current > latest:
+		db.Close()
+		return nil, fmt.Errorf("%w: database is at version %d, latest supported is %d; upgrade backup_slack",
+			ErrSchemaTooNew, current, latest)
+	case current < latest:
+		db.Close()
+		return nil, fmt.Errorf("database schema is at version %d, expected %d; run a backup or backup_slack migrate up first",
+			current, latest)
+	}
+
+	return &DB{DB: db, writer: writer{exec: db, dialect: d}, fts5: fts5}, nil
+}
+
+// readOnlyDSN makes every transaction on a PostgreSQL connection read-only.
+// lib/pq passes unknown parameters on to the server as settings.
+func readOnlyDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "default_transaction_read_only=on"
 	}
+	return dsn + " default_transaction_read_only=on"
+}
 
-	return &DB{db}, nil
+// Open connects to PostgreSQL when dsn is set and to the SQLite file at
+// dbPath otherwise
+func Open(dbPath, dsn string) (*DB, error) {
+	if dsn != "" {
+		return NewPostgres(dsn)
+	}
+	return New(dbPath)
 }
 
 // Close closes the database connection
@@ -92,7 +228,43 @@ func (db *DB) Close() error {
 	return db.DB.Close()
 }
 
-func (db *DB) InsertChannel(ch Channel) error {
+// Size returns the size of the database in bytes. On SQLite it excludes
+// pages still in the write-ahead log.
+func (db *DB) Size() (int64, error) {
+	query := `SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`
+	if db.dialect == dialectPostgres {
+		query = `SELECT pg_database_size(current_database())`
+	}
+
+	var size int64
+	if err := db.QueryRow(query).Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to get database size: %w", err)
+	}
+	return size, nil
+}
+
+// Batch runs fn inside a single transaction. The transaction is committed
+// if fn returns nil and rolled back otherwise.
+func (db *DB) Batch(fn func(w Writer) error) error {
+	sqlTx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	if err := fn(&Tx{writer{exec: sqlTx, dialect: db.dialect}}); err != nil {
+		if rbErr := sqlTx.Rollback(); rbErr != nil {
+			logger.Error.Printf("Failed to roll back transaction: %v", rbErr)
+		}
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (w writer) InsertChannel(ch Channel) error {
 	query := `
         INSERT INTO channels (
             id, name, channel_type, is_archived, created_at, topic, purpose
@@ -104,7 +276,7 @@ func (db *DB) InsertChannel(ch Channel) error {
             topic = excluded.topic,
             purpose = excluded.purpose
     `
-	result, err := db.DB.Exec(query,
+	result, err := w.exec.Exec(w.dialect.rebind(query),
 		ch.ID, ch.Name, ch.ChannelType, ch.IsArchived, ch.CreatedAt, ch.Topic, ch.Purpose)
 	if err != nil {
 		logger.Error.Printf("Database error upserting channel %s: %v", ch.Name, err)
@@ -116,52 +288,44 @@ func (db *DB) InsertChannel(ch Channel) error {
 	return nil
 }
 
-func (db *DB) InsertMessage(msg Message) error {
-	// First verify user exists
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", msg.UserID).Scan(&exists)
-	if err != nil {
-		return fmt.Errorf("failed to check user existence: %w", err)
-	}
-	if !exists {
-		logger.Error.Printf("Attempted to insert message with non-existent user ID: %s", msg.UserID)
-		return fmt.Errorf("user %s does not exist", msg.UserID)
-	}
-
+// InsertMessage relies on the users foreign key instead of a separate
+// existence query, so the author has to be written first
+func (w writer) InsertMessage(msg Message) error {
 	query := `
         INSERT INTO messages (
             id, channel_id, user_id, content, timestamp, 
             thread_ts, message_type, is_deleted, last_edited
-        ) VALUES (?, ?, ?, ?, datetime(?), ?, ?, ?, datetime(?))
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
         ON CONFLICT(id) DO UPDATE SET
             content = excluded.content,
             is_deleted = excluded.is_deleted,
             last_edited = excluded.last_edited
     `
 
-	lastEdited := sql.NullString{Valid: false}
+	var lastEdited interface{}
 	if msg.LastEdited.Valid {
-		lastEdited.String = msg.LastEdited.Time.Format("2006-01-02 15:04:05")
-		lastEdited.Valid = true
+		lastEdited = w.dialect.timeArg(msg.LastEdited.Time)
 	}
 
-	_, err = db.Exec(query,
+	_, err := w.exec.Exec(w.dialect.rebind(query),
 		msg.ID, msg.ChannelID, msg.UserID, msg.Content,
-		msg.Timestamp.Format("2006-01-02 15:04:05"),
+		w.dialect.timeArg(msg.Timestamp),
 		msg.ThreadTS, msg.MessageType,
 		msg.IsDeleted, lastEdited,
 	)
-
-	return err
+	if err != nil {
+		return fmt.Errorf("failed to insert message %s: %w", msg.ID, err)
+	}
+	return nil
 }
 
 func (db *DB) GetLastMessageTimestamp(channelID string) (time.Time, error) {
 	var unixTime int64
-	query := `SELECT COALESCE(MAX(CAST(strftime('%s', timestamp) AS INTEGER)), 0)
+	query := `SELECT COALESCE(MAX(` + db.dialect.unixSeconds("timestamp") + `), 0)
               FROM messages 
               WHERE channel_id = ?`
 
-	err := db.DB.QueryRow(query, channelID).Scan(&unixTime)
+	err := db.DB.QueryRow(db.dialect.rebind(query), channelID).Scan(&unixTime)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to get last message timestamp: %w", err)
 	}
@@ -173,15 +337,22 @@ func (db *DB) GetLastMessageTimestamp(channelID string) (time.Time, error) {
 	return timestamp, nil
 }
 
-func (db *DB) InsertUser(user User) error {
+// InsertUser stores a user. The backup only knows user IDs, so placeholder
+// rows whose username is the ID are filled in by later inserts with real
+// names (e.g. from an import) but never overwrite them.
+func (w writer) InsertUser(user User) error {
 	query := `
         INSERT INTO users (
             id, username, display_name, avatar_url, first_seen
         ) VALUES (?, ?, ?, ?, ?)
-        ON CONFLICT(id) DO NOTHING
+        ON CONFLICT(id) DO UPDATE SET
+            username = CASE WHEN excluded.username != excluded.id
+                THEN excluded.username ELSE users.username END,
+            display_name = COALESCE(NULLIF(excluded.display_name, ''), users.display_name),
+            avatar_url = COALESCE(NULLIF(excluded.avatar_url, ''), users.avatar_url)
     `
 
-	_, err := db.Exec(query,
+	_, err := w.exec.Exec(w.dialect.rebind(query),
 		user.ID, user.Username, user.DisplayName,
 		user.AvatarURL, user.FirstSeen)
 
@@ -195,7 +366,7 @@ func (db *DB) MessageExists(messageID string) (bool, error) {
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM messages WHERE id = ?)`
 
-	err := db.QueryRow(query, messageID).Scan(&exists)
+	err := db.QueryRow(db.dialect.rebind(query), messageID).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check message existence: %w", err)
 	}
@@ -204,7 +375,7 @@ func (db *DB) MessageExists(messageID string) (bool, error) {
 }
 
 // InsertFile stores file metadata in the database
-func (db *DB) InsertFile(file File) error {
+func (w writer) InsertFile(file File) error {
 	query := `
 		INSERT INTO files (
 			id, message_id, original_url, local_path, file_name,
@@ -215,7 +386,7 @@ func (db *DB) InsertFile(file File) error {
 			checksum = excluded.checksum
 	`
 
-	_, err := db.Exec(query,
+	_, err := w.exec.Exec(w.dialect.rebind(query),
 		file.ID, file.MessageID, file.OriginalURL, file.LocalPath,
 		file.FileName, file.FileType, file.SizeBytes,
 		file.UploadTimestamp, file.Checksum)
@@ -235,7 +406,7 @@ func (db *DB) GetDuplicateFiles(checksum string) ([]File, error) {
 		WHERE checksum = ?
 	`
 
-	rows, err := db.Query(query, checksum)
+	rows, err := db.Query(db.dialect.rebind(query), checksum)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query duplicate files: %w", err)
 	}
@@ -289,7 +460,7 @@ func (db *DB) GetOrphanedFiles() ([]File, error) {
 func (db *DB) DeleteFile(fileID string) error {
 	query := `DELETE FROM files WHERE id = ?`
 
-	result, err := db.Exec(query, fileID)
+	result, err := db.DB.Exec(db.dialect.rebind(query), fileID)
 	if err != nil {
 		return fmt.Errorf("failed to delete file record: %w", err)
 	}
@@ -305,3 +476,363 @@ func (db *DB) DeleteFile(fileID string) error {
 
 	return nil
 }
+
+// InsertReaction stores a reaction, keeping the first time it was seen
+func (w writer) InsertReaction(reaction Reaction) error {
+	query := `
+		INSERT INTO reactions (message_id, user_id, emoji, timestamp)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(message_id, user_id, emoji) DO NOTHING
+	`
+
+	_, err := w.exec.Exec(w.dialect.rebind(query),
+		reaction.MessageID, reaction.UserID, reaction.Emoji, reaction.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to insert reaction: %w", err)
+	}
+	return nil
+}
+
+// InsertChannelMember records a channel member; recording one twice is a
+// no-op
+func (w writer) InsertChannelMember(member ChannelMember) error {
+	query := `
+		INSERT INTO channel_members (channel_id, user_id)
+		VALUES (?, ?)
+		ON CONFLICT(channel_id, user_id) DO NOTHING
+	`
+
+	if _, err := w.exec.Exec(w.dialect.rebind(query), member.ChannelID, member.UserID); err != nil {
+		return fmt.Errorf("failed to insert channel member: %w", err)
+	}
+	return nil
+}
+
+// GetChannelMembers returns the IDs of a channel's recorded members
+func (db *DB) GetChannelMembers(channelID string) ([]string, error) {
+	query := `SELECT user_id FROM channel_members WHERE channel_id = ? ORDER BY user_id`
+
+	rows, err := db.Query(db.dialect.rebind(query), channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan channel member row: %w", err)
+		}
+		members = append(members, id)
+	}
+
+	return members, rows.Err()
+}
+
+// DeleteReaction removes a user's reaction with an emoji from a message
+func (db *DB) DeleteReaction(reaction Reaction) error {
+	query := `DELETE FROM reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`
+
+	if _, err := db.DB.Exec(db.dialect.rebind(query), reaction.MessageID, reaction.UserID, reaction.Emoji); err != nil {
+		return fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	return nil
+}
+
+// GetChannels returns all stored channels ordered by name
+func (db *DB) GetChannels() ([]Channel, error) {
+	query := `
+		SELECT id, name, channel_type, COALESCE(is_archived, FALSE), created_at,
+			   COALESCE(topic, ''), COALESCE(purpose, '')
+		FROM channels
+		ORDER BY name
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []Channel
+	for rows.Next() {
+		var ch Channel
+		err := rows.Scan(&ch.ID, &ch.Name, &ch.ChannelType, &ch.IsArchived,
+			&ch.CreatedAt, &ch.Topic, &ch.Purpose)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel row: %w", err)
+		}
+		channels = append(channels, ch)
+	}
+
+	return channels, rows.Err()
+}
+
+// GetUsers returns all stored users ordered by ID
+func (db *DB) GetUsers() ([]User, error) {
+	query := `
+		SELECT id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), first_seen
+		FROM users
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL, &u.FirstSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// GetMessages returns the messages matching filter in chronological order,
+// or in ID order when paging with AfterID
+func (db *DB) GetMessages(filter MessageFilter) ([]Message, error) {
+	where, args := filter.where(db.dialect, "m")
+	order := "m.timestamp, m.id"
+	if filter.AfterID != "" {
+		// Pages must follow the cursor, or a message whose time is out of
+		// step with its ID could be skipped or returned twice
+		order = "m.id"
+	}
+	query := `
+		SELECT m.id, m.channel_id, m.user_id, COALESCE(m.content, ''), m.timestamp,
+			   m.thread_ts, m.message_type, COALESCE(m.is_deleted, FALSE), m.last_edited
+		FROM messages m
+	` + where + `
+		ORDER BY ` + order + `
+	`
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(&m.ID, &m.ChannelID, &m.UserID, &m.Content, &m.Timestamp,
+			&m.ThreadTS, &m.MessageType, &m.IsDeleted, &m.LastEdited)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message row: %w", err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// CountMessages counts the messages matching filter
+func (db *DB) CountMessages(filter MessageFilter) (int, error) {
+	where, args := filter.where(db.dialect, "m")
+	var count int
+	err := db.QueryRow(db.dialect.rebind(`SELECT COUNT(*) FROM messages m `+where), args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return count, nil
+}
+
+// GetMessagePage returns up to limit of a channel's top-level messages,
+// newest first, starting after the message before (from the newest when
+// empty). Thread replies are left out; fetch them with a ThreadTS filter.
+// Slack timestamps sort the same as strings, so IDs make a stable cursor.
+func (db *DB) GetMessagePage(channelID, before string, limit int) ([]Message, error) {
+	query := `
+		SELECT m.id, m.channel_id, m.user_id, COALESCE(m.content, ''), m.timestamp,
+			   m.thread_ts, m.message_type, COALESCE(m.is_deleted, FALSE), m.last_edited
+		FROM messages m
+		WHERE m.channel_id = ?
+		  AND (m.thread_ts IS NULL OR m.thread_ts = '' OR m.thread_ts = m.id)
+	`
+	args := []interface{}{channelID}
+	if before != "" {
+		query += " AND m.id < ?"
+		args = append(args, before)
+	}
+	query += " ORDER BY m.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(&m.ID, &m.ChannelID, &m.UserID, &m.Content, &m.Timestamp,
+			&m.ThreadTS, &m.MessageType, &m.IsDeleted, &m.LastEdited)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message row: %w", err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// GetFiles returns metadata for files attached to messages matching filter
+func (db *DB) GetFiles(filter MessageFilter) ([]File, error) {
+	where, args := filter.where(db.dialect, "m")
+	query := `
+		SELECT f.id, f.message_id, f.original_url, f.local_path, f.file_name,
+			   f.file_type, f.size_bytes, f.upload_timestamp, f.checksum
+		FROM files f
+		JOIN messages m ON f.message_id = m.id
+	` + where + `
+		ORDER BY f.upload_timestamp, f.id
+	`
+
+	rows, err := db.Query(db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var f File
+		err := rows.Scan(&f.ID, &f.MessageID, &f.OriginalURL, &f.LocalPath,
+			&f.FileName, &f.FileType, &f.SizeBytes, &f.UploadTimestamp, &f.Checksum)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file row: %w", err)
+		}
+		files = append(files, f)
+	}
+
+	return files, rows.Err()
+}
+
+// GetReactions returns reactions on messages matching filter
+func (db *DB) GetReactions(filter MessageFilter) ([]Reaction, error) {
+	where, args := filter.where(db.dialect, "m")
+	query := `
+		SELECT r.message_id, r.user_id, r.emoji, r.timestamp
+		FROM reactions r
+		JOIN messages m ON r.message_id = m.id
+	` + where + `
+		ORDER BY r.message_id, r.emoji, r.timestamp
+	`
+
+	rows, err := db.Query(db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reactions: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []Reaction
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.MessageID, &r.UserID, &r.Emoji, &r.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction row: %w", err)
+		}
+		reactions = append(reactions, r)
+	}
+
+	return reactions, rows.Err()
+}
+
+// GetSyncState returns the sync state for a channel
+func (db *DB) GetSyncState(channelID string) (SyncState, error) {
+	state := SyncState{ChannelID: channelID}
+	query := `SELECT last_sync_at FROM sync_state WHERE channel_id = ?`
+
+	err := db.QueryRow(db.dialect.rebind(query), channelID).Scan(&state.LastSyncAt)
+	if err != nil && err != sql.ErrNoRows {
+		return state, fmt.Errorf("failed to get sync state: %w", err)
+	}
+
+	return state, nil
+}
+
+// UpdateSyncState records a successful sync for a channel
+func (db *DB) UpdateSyncState(state SyncState) error {
+	query := `
+		INSERT INTO sync_state (channel_id, last_sync_at)
+		VALUES (?, ?)
+		ON CONFLICT(channel_id) DO UPDATE SET
+			last_sync_at = excluded.last_sync_at
+	`
+
+	if _, err := db.DB.Exec(db.dialect.rebind(query), state.ChannelID, state.LastSyncAt); err != nil {
+		return fmt.Errorf("failed to update sync state: %w", err)
+	}
+	return nil
+}
+
+// where builds a WHERE clause over the messages table aliased as alias
+func (f MessageFilter) where(d dialect, alias string) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	if len(f.ChannelIDs) > 0 {
+		placeholders := make([]string, len(f.ChannelIDs))
+		for i, id := range f.ChannelIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		conds = append(conds, fmt.Sprintf("%s.channel_id IN (%s)", alias, strings.Join(placeholders, ", ")))
+	}
+	if len(f.MessageIDs) > 0 {
+		conds = append(conds, fmt.Sprintf("%s.id IN (%s)", alias, placeholders(len(f.MessageIDs))))
+		for _, id := range f.MessageIDs {
+			args = append(args, id)
+		}
+	}
+	if len(f.UserIDs) > 0 {
+		conds = append(conds, fmt.Sprintf("%s.user_id IN (%s)", alias, placeholders(len(f.UserIDs))))
+		for _, id := range f.UserIDs {
+			args = append(args, id)
+		}
+	}
+	if len(f.ThreadTS) > 0 {
+		in := placeholders(len(f.ThreadTS))
+		conds = append(conds, fmt.Sprintf("(%s.thread_ts IN (%s) OR %s.id IN (%s))", alias, in, alias, in))
+		for range 2 {
+			for _, ts := range f.ThreadTS {
+				args = append(args, ts)
+			}
+		}
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, alias+".timestamp >= ?")
+		args = append(args, d.timeArg(f.Since))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, alias+".timestamp < ?")
+		args = append(args, d.timeArg(f.Until))
+	}
+	if f.AfterID != "" {
+		conds = append(conds, alias+".id > ?")
+		args = append(args, f.AfterID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// placeholders returns n comma-separated bind parameters
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
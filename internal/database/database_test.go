@@ -0,0 +1,213 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"backup_slack/internal/logger"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	if err := logger.Init(filepath.Join(tmpDir, "logs"), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	db, err := New(filepath.Join(tmpDir, "backup.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InsertChannel(Channel{
+		ID:          "C123456",
+		Name:        "general",
+		ChannelType: "public_channel",
+		CreatedAt:   time.Unix(1700000000, 0),
+	}); err != nil {
+		t.Fatalf("Failed to insert channel: %v", err)
+	}
+	return db
+}
+
+func TestNewEnablesWAL(t *testing.T) {
+	db := newTestDB(t)
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("Failed to read journal mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want %q", mode, "wal")
+	}
+}
+
+func TestSize(t *testing.T) {
+	db := newTestDB(t)
+
+	size, err := db.Size()
+	if err != nil {
+		t.Fatalf("Size() error = %v", err)
+	}
+	if size <= 0 {
+		t.Errorf("Size() = %d, want a positive size", size)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	newTestDB(t) // initializes the logger
+	dbPath := filepath.Join(t.TempDir(), "backup.db")
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	err = db.InsertChannel(Channel{ID: "C1", Name: "general", ChannelType: "public_channel", CreatedAt: time.Unix(1700000000, 0)})
+	if err != nil {
+		t.Fatalf("InsertChannel() error = %v", err)
+	}
+	// Left open, as the backup job would be
+
+	ro, err := OpenReadOnly(dbPath, "")
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	defer ro.Close()
+	defer db.Close()
+
+	channels, err := ro.GetChannels()
+	if err != nil || len(channels) != 1 {
+		t.Errorf("GetChannels() = %+v, %v, want general", channels, err)
+	}
+	if err := ro.InsertUser(User{ID: "U1", Username: "alice"}); err == nil {
+		t.Error("InsertUser() succeeded on a read-only database")
+	}
+
+	if _, err := OpenReadOnly(filepath.Join(t.TempDir(), "missing.db"), ""); err == nil {
+		t.Error("OpenReadOnly() succeeded on a missing database")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	db := newTestDB(t)
+
+	msg := func(id string) Message {
+		return Message{
+			ID:          id,
+			ChannelID:   "C123456",
+			UserID:      "U123456",
+			Content:     "hello",
+			Timestamp:   time.Unix(1700000000, 0),
+			MessageType: "message",
+		}
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		err := db.Batch(func(tx Writer) error {
+			if err := tx.InsertUser(User{ID: "U123456", Username: "U123456", FirstSeen: time.Now()}); err != nil {
+				return err
+			}
+			if err := tx.InsertMessage(msg("1700000000.000100")); err != nil {
+				return err
+			}
+			return tx.InsertMessage(msg("1700000000.000200"))
+		})
+		if err != nil {
+			t.Fatalf("Batch() error = %v", err)
+		}
+
+		for _, id := range []string{"1700000000.000100", "1700000000.000200"} {
+			exists, err := db.MessageExists(id)
+			if err != nil {
+				t.Fatalf("MessageExists() error = %v", err)
+			}
+			if !exists {
+				t.Errorf("Expected message %s to be committed", id)
+			}
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		wantErr := errors.New("abort")
+		err := db.Batch(func(tx Writer) error {
+			if err := tx.InsertMessage(msg("1700000000.000300")); err != nil {
+				return err
+			}
+			return wantErr
+		})
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("Batch() error = %v, want %v", err, wantErr)
+		}
+
+		exists, err := db.MessageExists("1700000000.000300")
+		if err != nil {
+			t.Fatalf("MessageExists() error = %v", err)
+		}
+		if exists {
+			t.Error("Expected message to be rolled back")
+		}
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		err := db.Batch(func(tx Writer) error {
+			m := msg("1700000000.000400")
+			m.UserID = "UMISSING"
+			return tx.InsertMessage(m)
+		})
+		if err == nil {
+			t.Error("Expected foreign key error for unknown user, got nil")
+		}
+	})
+}
+
+func TestSaveBackupRunConcurrently(t *testing.T) {
+	newTestDB(t) // initializes the logger
+	dbPath := filepath.Join(t.TempDir(), "backup.db")
+
+	// Two processes, e.g. the scheduled backup and a manual one
+	var dbs []*DB
+	for i := 0; i < 2; i++ {
+		db, err := New(dbPath)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+
+	const runs = 10
+	ids := make(chan int64, 2*runs)
+	var wg sync.WaitGroup
+	for _, db := range dbs {
+		wg.Add(1)
+		go func(db *DB) {
+			defer wg.Done()
+			for i := 0; i < runs; i++ {
+				id, err := db.SaveBackupRun(BackupRun{StartedAt: time.Now(), Trigger: "manual", Status: RunRunning})
+				if err != nil {
+					t.Errorf("SaveBackupRun() error = %v", err)
+					return
+				}
+				ids <- id
+			}
+		}(db)
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("Run ID %d assigned twice", id)
+		}
+		seen[id] = true
+	}
+	stored, err := dbs[0].GetBackupRuns(0)
+	if err != nil || len(stored) != 2*runs {
+		t.Errorf("GetBackupRuns() = %d runs, %v, want %d", len(stored), err, 2*runs)
+	}
+}
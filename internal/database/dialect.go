@@ -0,0 +1,73 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect captures the differences between the SQL backends. Queries are
+// written with SQLite's ? placeholders and rewritten for PostgreSQL.
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite3"
+	dialectPostgres dialect = "postgres"
+)
+
+// sqliteTimeLayout is the format messages.timestamp and messages.last_edited
+// are stored in on SQLite. Values are always written in UTC so they compare
+// as strings and read back unchanged.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// rebind converts ? placeholders into the dialect's bind variables
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+
+	var (
+		b       strings.Builder
+		n       int
+		inQuote bool
+	)
+	b.Grow(len(query) + 16)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+			b.WriteRune(r)
+		case r == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// timeArg converts t into the value stored in message timestamp columns
+func (d dialect) timeArg(t time.Time) interface{} {
+	if d == dialectSQLite {
+		return t.UTC().Format(sqliteTimeLayout)
+	}
+	return t.UTC()
+}
+
+// unixSeconds returns an expression evaluating column as Unix seconds
+func (d dialect) unixSeconds(column string) string {
+	if d == dialectPostgres {
+		return "CAST(EXTRACT(EPOCH FROM " + column + ") AS BIGINT)"
+	}
+	return "CAST(strftime('%s', " + column + ") AS INTEGER)"
+}
+
+// timestampType is the column type used for timestamps
+func (d dialect) timestampType() string {
+	if d == dialectPostgres {
+		return "TIMESTAMPTZ"
+	}
+	return "DATETIME"
+}
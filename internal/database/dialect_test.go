@@ -0,0 +1,76 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"no placeholders", "SELECT COUNT(*) FROM messages", "SELECT COUNT(*) FROM messages"},
+		{
+			"placeholders",
+			"SELECT * FROM messages WHERE id = ? AND channel_id IN (?, ?)",
+			"SELECT * FROM messages WHERE id = $1 AND channel_id IN ($2, $3)",
+		},
+		{
+			"quoted question mark",
+			"SELECT * FROM messages WHERE id = ? AND content != '?' AND user_id = ?",
+			"SELECT * FROM messages WHERE id = $1 AND content != '?' AND user_id = $2",
+		},
+		{
+			"escaped quote",
+			"UPDATE messages SET content = 'it''s ?' WHERE id = ?",
+			"UPDATE messages SET content = 'it''s ?' WHERE id = $1",
+		},
+		{
+			"ten or more",
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		},
+		{"non-ASCII", "SELECT * FROM channels WHERE name = 'café' AND id = ?", "SELECT * FROM channels WHERE name = 'café' AND id = $1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dialectSQLite.rebind(tt.query); got != tt.query {
+				t.Errorf("sqlite rebind changed query: %s", got)
+			}
+			if got := dialectPostgres.rebind(tt.query); got != tt.want {
+				t.Errorf("postgres rebind = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeArg(t *testing.T) {
+	local := time.Date(2024, 3, 1, 4, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	if got := dialectSQLite.timeArg(local); got != "2024-03-01 03:30:00" {
+		t.Errorf("sqlite timeArg = %v, want 2024-03-01 03:30:00", got)
+	}
+	got, ok := dialectPostgres.timeArg(local).(time.Time)
+	if !ok || !got.Equal(local) || got.Location() != time.UTC {
+		t.Errorf("postgres timeArg = %v, want %v in UTC", got, local.UTC())
+	}
+}
+
+func TestUnixSeconds(t *testing.T) {
+	tests := []struct {
+		dialect dialect
+		want    string
+	}{
+		{dialectSQLite, "CAST(strftime('%s', m.timestamp) AS INTEGER)"},
+		{dialectPostgres, "CAST(EXTRACT(EPOCH FROM m.timestamp) AS BIGINT)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dialect.unixSeconds("m.timestamp"); got != tt.want {
+			t.Errorf("%s unixSeconds = %s, want %s", tt.dialect, got, tt.want)
+		}
+	}
+}
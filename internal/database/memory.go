@@ -0,0 +1,581 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type reactionKey struct {
+	messageID string
+	userID    string
+	emoji     string
+}
+
+// MemoryStore is an in-memory Store for tests. It mirrors the upsert and
+// foreign key behaviour of the SQLite schema so ordering mistakes in the
+// service layer surface the same way they would against a real database.
+type MemoryStore struct {
+	mu        sync.Mutex
+	channels  map[string]Channel
+	users     map[string]User
+	messages  map[string]Message
+	files     map[string]File
+	reactions map[reactionKey]Reaction
+	members   map[ChannelMember]bool
+	syncState map[string]SyncState
+	runs      map[int64]BackupRun
+}
+
+// memoryTx writes straight into the store while Batch holds its lock
+type memoryTx struct {
+	s *MemoryStore
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		channels:  make(map[string]Channel),
+		users:     make(map[string]User),
+		messages:  make(map[string]Message),
+		files:     make(map[string]File),
+		reactions: make(map[reactionKey]Reaction),
+		members:   make(map[ChannelMember]bool),
+		syncState: make(map[string]SyncState),
+		runs:      make(map[int64]BackupRun),
+	}
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Batch applies the writes made by fn atomically, restoring the previous
+// contents if fn returns an error
+func (s *MemoryStore) Batch(fn func(w Writer) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.clone()
+	if err := fn(memoryTx{s}); err != nil {
+		s.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+func (tx memoryTx) InsertChannel(ch Channel) error         { return tx.s.insertChannel(ch) }
+func (tx memoryTx) InsertUser(user User) error             { return tx.s.insertUser(user) }
+func (tx memoryTx) InsertMessage(msg Message) error        { return tx.s.insertMessage(msg) }
+func (tx memoryTx) InsertFile(file File) error             { return tx.s.insertFile(file) }
+func (tx memoryTx) InsertReaction(reaction Reaction) error { return tx.s.insertReaction(reaction) }
+func (tx memoryTx) InsertChannelMember(member ChannelMember) error {
+	return tx.s.insertChannelMember(member)
+}
+
+func (s *MemoryStore) InsertChannel(ch Channel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertChannel(ch)
+}
+
+func (s *MemoryStore) InsertUser(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertUser(user)
+}
+
+func (s *MemoryStore) InsertMessage(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertMessage(msg)
+}
+
+func (s *MemoryStore) InsertFile(file File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertFile(file)
+}
+
+func (s *MemoryStore) InsertReaction(reaction Reaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertReaction(reaction)
+}
+
+func (s *MemoryStore) InsertChannelMember(member ChannelMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertChannelMember(member)
+}
+
+func (s *MemoryStore) insertChannel(ch Channel) error {
+	if existing, ok := s.channels[ch.ID]; ok {
+		// created_at is not updated on conflict
+		ch.CreatedAt = existing.CreatedAt
+	}
+	s.channels[ch.ID] = ch
+	return nil
+}
+
+func (s *MemoryStore) insertUser(user User) error {
+	existing, ok := s.users[user.ID]
+	if !ok {
+		s.users[user.ID] = user
+		return nil
+	}
+
+	// Placeholder values never overwrite known names
+	if user.Username != user.ID {
+		existing.Username = user.Username
+	}
+	if user.DisplayName != "" {
+		existing.DisplayName = user.DisplayName
+	}
+	if user.AvatarURL != "" {
+		existing.AvatarURL = user.AvatarURL
+	}
+	s.users[user.ID] = existing
+	return nil
+}
+
+func (s *MemoryStore) insertMessage(msg Message) error {
+	if _, ok := s.channels[msg.ChannelID]; !ok {
+		return fmt.Errorf("failed to insert message %s: channel %s does not exist", msg.ID, msg.ChannelID)
+	}
+	if _, ok := s.users[msg.UserID]; !ok {
+		return fmt.Errorf("failed to insert message %s: user %s does not exist", msg.ID, msg.UserID)
+	}
+
+	msg.Timestamp = msg.Timestamp.UTC().Truncate(time.Second)
+	if existing, ok := s.messages[msg.ID]; ok {
+		existing.Content = msg.Content
+		existing.IsDeleted = msg.IsDeleted
+		existing.LastEdited = msg.LastEdited
+		msg = existing
+	}
+	s.messages[msg.ID] = msg
+	return nil
+}
+
+func (s *MemoryStore) insertFile(file File) error {
+	if _, ok := s.messages[file.MessageID]; !ok {
+		return fmt.Errorf("failed to insert file: message %s does not exist", file.MessageID)
+	}
+
+	if existing, ok := s.files[file.ID]; ok {
+		existing.LocalPath = file.LocalPath
+		existing.Checksum = file.Checksum
+		file = existing
+	}
+	s.files[file.ID] = file
+	return nil
+}
+
+func (s *MemoryStore) insertReaction(reaction Reaction) error {
+	if _, ok := s.messages[reaction.MessageID]; !ok {
+		return fmt.Errorf("failed to insert reaction: message %s does not exist", reaction.MessageID)
+	}
+	if _, ok := s.users[reaction.UserID]; !ok {
+		return fmt.Errorf("failed to insert reaction: user %s does not exist", reaction.UserID)
+	}
+
+	key := reactionKey{reaction.MessageID, reaction.UserID, reaction.Emoji}
+	if _, ok := s.reactions[key]; !ok {
+		s.reactions[key] = reaction
+	}
+	return nil
+}
+
+func (s *MemoryStore) insertChannelMember(member ChannelMember) error {
+	if _, ok := s.channels[member.ChannelID]; !ok {
+		return fmt.Errorf("failed to insert channel member: channel %s does not exist", member.ChannelID)
+	}
+	s.members[member] = true
+	return nil
+}
+
+func (s *MemoryStore) GetChannelMembers(channelID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var members []string
+	for m := range s.members {
+		if m.ChannelID == channelID {
+			members = append(members, m.UserID)
+		}
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (s *MemoryStore) GetChannels() ([]Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make([]Channel, 0, len(s.channels))
+	for _, ch := range s.channels {
+		channels = append(channels, ch)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels, nil
+}
+
+func (s *MemoryStore) GetUsers() ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (s *MemoryStore) GetMessages(filter MessageFilter) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.filterMessages(filter)
+	if filter.Limit > 0 && len(messages) > filter.Limit {
+		messages = messages[:filter.Limit]
+	}
+	return messages, nil
+}
+
+func (s *MemoryStore) CountMessages(filter MessageFilter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.filterMessages(filter)), nil
+}
+
+func (s *MemoryStore) GetMessagePage(channelID, before string, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []Message
+	for _, msg := range s.messages {
+		reply := msg.ThreadTS.Valid && msg.ThreadTS.String != "" && msg.ThreadTS.String != msg.ID
+		if msg.ChannelID == channelID && !reply && (before == "" || msg.ID < before) {
+			messages = append(messages, msg)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID > messages[j].ID })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (s *MemoryStore) MessageExists(messageID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.messages[messageID]
+	return ok, nil
+}
+
+func (s *MemoryStore) GetLastMessageTimestamp(channelID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var latest int64
+	for _, msg := range s.messages {
+		if msg.ChannelID == channelID && msg.Timestamp.Unix() > latest {
+			latest = msg.Timestamp.Unix()
+		}
+	}
+	return time.Unix(latest, 0), nil
+}
+
+func (s *MemoryStore) GetFiles(filter MessageFilter) ([]File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var files []File
+	for _, f := range s.files {
+		if msg, ok := s.messages[f.MessageID]; ok && filter.matches(msg) {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].UploadTimestamp.Equal(files[j].UploadTimestamp) {
+			return files[i].UploadTimestamp.Before(files[j].UploadTimestamp)
+		}
+		return files[i].ID < files[j].ID
+	})
+	return files, nil
+}
+
+func (s *MemoryStore) GetDuplicateFiles(checksum string) ([]File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var files []File
+	for _, f := range s.files {
+		if f.Checksum == checksum {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (s *MemoryStore) GetOrphanedFiles() ([]File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var files []File
+	for _, f := range s.files {
+		if _, ok := s.messages[f.MessageID]; !ok {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (s *MemoryStore) DeleteFile(fileID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[fileID]; !ok {
+		return fmt.Errorf("no file found with ID %s", fileID)
+	}
+	delete(s.files, fileID)
+	return nil
+}
+
+func (s *MemoryStore) DeleteReaction(reaction Reaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reactions, reactionKey{reaction.MessageID, reaction.UserID, reaction.Emoji})
+	return nil
+}
+
+func (s *MemoryStore) GetReactions(filter MessageFilter) ([]Reaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reactions []Reaction
+	for _, r := range s.reactions {
+		if msg, ok := s.messages[r.MessageID]; ok && filter.matches(msg) {
+			reactions = append(reactions, r)
+		}
+	}
+	sort.Slice(reactions, func(i, j int) bool {
+		a, b := reactions[i], reactions[j]
+		if a.MessageID != b.MessageID {
+			return a.MessageID < b.MessageID
+		}
+		if a.Emoji != b.Emoji {
+			return a.Emoji < b.Emoji
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	})
+	return reactions, nil
+}
+
+func (s *MemoryStore) GetSyncState(channelID string) (SyncState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.syncState[channelID]; ok {
+		return state, nil
+	}
+	return SyncState{ChannelID: channelID}, nil
+}
+
+func (s *MemoryStore) UpdateSyncState(state SyncState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[state.ChannelID]; !ok {
+		return fmt.Errorf("failed to update sync state: channel %s does not exist", state.ChannelID)
+	}
+	s.syncState[state.ChannelID] = state
+	return nil
+}
+
+func (s *MemoryStore) filterMessages(filter MessageFilter) []Message {
+	var messages []Message
+	for _, msg := range s.messages {
+		if filter.matches(msg) {
+			messages = append(messages, msg)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if filter.AfterID == "" && !messages[i].Timestamp.Equal(messages[j].Timestamp) {
+			return messages[i].Timestamp.Before(messages[j].Timestamp)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+	return messages
+}
+
+func (s *MemoryStore) SaveBackupRun(run BackupRun) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run.ID == 0 {
+		for id := range s.runs {
+			if id > run.ID {
+				run.ID = id
+			}
+		}
+		run.ID++
+	}
+	run.Channels = append([]BackupRunChannel(nil), run.Channels...)
+	sort.Slice(run.Channels, func(i, j int) bool { return run.Channels[i].ChannelID < run.Channels[j].ChannelID })
+	s.runs[run.ID] = run
+	return run.ID, nil
+}
+
+func (s *MemoryStore) GetBackupRuns(limit int) ([]BackupRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var runs []BackupRun
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID > runs[j].ID })
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (s *MemoryStore) GetBackupRun(id int64) (BackupRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return BackupRun{}, ErrRunNotFound
+	}
+	return run, nil
+}
+
+// clone copies every table so Batch can roll back
+func (s *MemoryStore) clone() *MemoryStore {
+	c := NewMemoryStore()
+	for k, v := range s.channels {
+		c.channels[k] = v
+	}
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	for k, v := range s.messages {
+		c.messages[k] = v
+	}
+	for k, v := range s.files {
+		c.files[k] = v
+	}
+	for k, v := range s.reactions {
+		c.reactions[k] = v
+	}
+	for k, v := range s.members {
+		c.members[k] = v
+	}
+	for k, v := range s.syncState {
+		c.syncState[k] = v
+	}
+	for k, v := range s.runs {
+		c.runs[k] = v
+	}
+	return c
+}
+
+func (s *MemoryStore) restore(snapshot *MemoryStore) {
+	s.channels = snapshot.channels
+	s.users = snapshot.users
+	s.messages = snapshot.messages
+	s.files = snapshot.files
+	s.reactions = snapshot.reactions
+	s.members = snapshot.members
+	s.syncState = snapshot.syncState
+	s.runs = snapshot.runs
+}
+
+func (s *MemoryStore) SearchMessages(q SearchQuery) ([]SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	channels := make([]Channel, 0, len(s.channels))
+	for _, ch := range s.channels {
+		channels = append(channels, ch)
+	}
+	f := snippetFormatter(users, channels)
+
+	messages := s.filterMessages(MessageFilter{Since: q.After, Until: q.Before})
+	var results []SearchResult
+	for i := len(messages) - 1; i >= 0 && len(results) < limit; i-- {
+		msg := messages[i]
+		ch := s.channels[msg.ChannelID]
+		user := s.users[msg.UserID]
+
+		if !matchesAll(msg.Content, q.Terms) ||
+			!matchesAny(q.From, msg.UserID, user.Username, user.DisplayName) ||
+			!matchesAny(q.In, msg.ChannelID, ch.Name) ||
+			(q.HasFile && !s.hasFile(msg.ID)) {
+			continue
+		}
+
+		results = append(results, SearchResult{
+			Message:     msg,
+			ChannelName: ch.Name,
+			Username:    user.Username,
+			Snippet:     makeSnippet(f.Text(msg.Content), q.Terms),
+		})
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) hasFile(messageID string) bool {
+	for _, f := range s.files {
+		if f.MessageID == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(content string, terms []string) bool {
+	content = strings.ToLower(content)
+	for _, term := range terms {
+		if !strings.Contains(content, strings.ToLower(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny reports whether any wanted value equals one of values. An empty
+// wanted list matches everything.
+func matchesAny(wanted []string, values ...string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		for _, v := range values {
+			if v != "" && v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,19 +1,35 @@
 package database
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"backup_slack/internal/logger"
 	"database/sql"
 )
 
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary doesn't know about, i.e. it was written by a newer version
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// Migration is a reversible schema change. SQL must never be edited once
+// released; the checksum recorded when it was applied is verified on open.
 type Migration struct {
 	Version int
+	Name    string
 	SQL     string
+	Down    string
 }
 
 var migrations = []Migration{
 	{
 		Version: 1,
+		Name:    "initial schema",
 		SQL: `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version INTEGER PRIMARY KEY,
@@ -74,49 +90,593 @@ var migrations = []Migration{
 			checksum TEXT NOT NULL,
 			FOREIGN KEY (message_id) REFERENCES messages(id)
 		);`,
+		Down: `
+		DROP TABLE IF EXISTS files;
+		DROP TABLE IF EXISTS reactions;
+		DROP TABLE IF EXISTS messages;
+		DROP TABLE IF EXISTS channels;
+		DROP TABLE IF EXISTS users;`,
+	},
+	{
+		Version: 2,
+		Name:    "sync state",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS sync_state (
+			channel_id TEXT PRIMARY KEY,
+			last_sync_at DATETIME NOT NULL,
+			FOREIGN KEY (channel_id) REFERENCES channels(id)
+		);`,
+		Down: `
+		DROP TABLE IF EXISTS sync_state;`,
+	},
+	{
+		Version: 3,
+		Name:    "message indexes",
+		SQL: `
+		CREATE INDEX IF NOT EXISTS idx_messages_channel_timestamp
+			ON messages (channel_id, timestamp);`,
+		Down: `
+		DROP INDEX IF EXISTS idx_messages_channel_timestamp;`,
+	},
+	{
+		Version: 4,
+		Name:    "backup runs",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS backup_runs (
+			id INTEGER PRIMARY KEY,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			triggered_by TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			bytes_downloaded INTEGER NOT NULL DEFAULT 0,
+			api_calls INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS backup_run_channels (
+			run_id INTEGER NOT NULL,
+			channel_id TEXT NOT NULL,
+			messages INTEGER NOT NULL DEFAULT 0,
+			files INTEGER NOT NULL DEFAULT 0,
+			bytes_downloaded INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (run_id, channel_id),
+			FOREIGN KEY (run_id) REFERENCES backup_runs(id)
+		);`,
+		Down: `
+		DROP TABLE IF EXISTS backup_run_channels;
+		DROP TABLE IF EXISTS backup_runs;`,
+	},
+	{
+		// IDs were assigned as MAX(id) + 1, which two processes starting
+		// runs at once could both pick. AUTOINCREMENT can't be added to a
+		// column, so both tables are rebuilt.
+		Version: 5,
+		Name:    "backup run IDs",
+		SQL: `
+		CREATE TABLE backup_runs_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			triggered_by TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			bytes_downloaded INTEGER NOT NULL DEFAULT 0,
+			api_calls INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE backup_run_channels_new (
+			run_id INTEGER NOT NULL,
+			channel_id TEXT NOT NULL,
+			messages INTEGER NOT NULL DEFAULT 0,
+			files INTEGER NOT NULL DEFAULT 0,
+			bytes_downloaded INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (run_id, channel_id),
+			FOREIGN KEY (run_id) REFERENCES backup_runs_new(id)
+		);
+
+		INSERT INTO backup_runs_new SELECT * FROM backup_runs;
+		INSERT INTO backup_run_channels_new SELECT * FROM backup_run_channels;
+		DROP TABLE backup_run_channels;
+		DROP TABLE backup_runs;
+		ALTER TABLE backup_runs_new RENAME TO backup_runs;
+		ALTER TABLE backup_run_channels_new RENAME TO backup_run_channels;`,
+		Down: `
+		CREATE TABLE backup_runs_old (
+			id INTEGER PRIMARY KEY,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			triggered_by TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			bytes_downloaded INTEGER NOT NULL DEFAULT 0,
+			api_calls INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE backup_run_channels_old (
+			run_id INTEGER NOT NULL,
+			channel_id TEXT NOT NULL,
+			messages INTEGER NOT NULL DEFAULT 0,
+			files INTEGER NOT NULL DEFAULT 0,
+			bytes_downloaded INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (run_id, channel_id),
+			FOREIGN KEY (run_id) REFERENCES backup_runs_old(id)
+		);
+
+		INSERT INTO backup_runs_old SELECT * FROM backup_runs;
+		INSERT INTO backup_run_channels_old SELECT * FROM backup_run_channels;
+		DROP TABLE backup_run_channels;
+		DROP TABLE backup_runs;
+		ALTER TABLE backup_runs_old RENAME TO backup_runs;
+		ALTER TABLE backup_run_channels_old RENAME TO backup_run_channels;`,
+	},
+	{
+		// Message times used to be written in the local time of whichever
+		// host ran the backup, without a zone. A message's ID is its Slack
+		// timestamp, so rows whose time is off from it by a whole UTC
+		// offset (a multiple of 15 minutes, at most 14 hours) are moved back
+		// to UTC, and their edit time by the same offset. Edit times on the
+		// other side of a daylight saving change end up an hour out.
+		// Reverting leaves the times in UTC, which is what older versions
+		// expect too.
+		Version: 6,
+		Name:    "UTC message times",
+		SQL: `
+		UPDATE messages SET
+			last_edited = datetime(CAST(strftime('%s', last_edited) AS INTEGER)
+				- (CAST(strftime('%s', timestamp) AS INTEGER) - CAST(id AS INTEGER)), 'unixepoch'),
+			timestamp = datetime(CAST(id AS INTEGER), 'unixepoch')
+		WHERE CAST(strftime('%s', timestamp) AS INTEGER) != CAST(id AS INTEGER)
+			AND ABS(CAST(strftime('%s', timestamp) AS INTEGER) - CAST(id AS INTEGER)) <= 14 * 3600
+			AND (CAST(strftime('%s', timestamp) AS INTEGER) - CAST(id AS INTEGER)) % 900 = 0;`,
+		Down: `
+		SELECT 1;`,
+	},
+	{
+		Version: 7,
+		Name:    "channel members",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS channel_members (
+			channel_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (channel_id, user_id),
+			FOREIGN KEY (channel_id) REFERENCES channels(id)
+		);`,
+		Down: `
+		DROP TABLE IF EXISTS channel_members;`,
 	},
 }
 
-func applyMigrations(db *sql.DB) error {
-	// Create migrations table if it doesn't exist
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
-		version INTEGER PRIMARY KEY,
-		applied_at DATETIME NOT NULL
-	)`)
+// postgresMigrations mirror migrations for PostgreSQL. Versions must stay in
+// step so an archive copied between backends reports the same schema.
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			display_name TEXT,
+			avatar_url TEXT,
+			first_seen TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS channels (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			channel_type TEXT NOT NULL,
+			is_archived BOOLEAN DEFAULT FALSE,
+			created_at TIMESTAMPTZ NOT NULL,
+			topic TEXT,
+			purpose TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS messages (
+			id TEXT PRIMARY KEY,
+			channel_id TEXT NOT NULL REFERENCES channels(id),
+			user_id TEXT NOT NULL REFERENCES users(id),
+			content TEXT,
+			timestamp TIMESTAMPTZ NOT NULL,
+			thread_ts TEXT,
+			message_type TEXT NOT NULL,
+			is_deleted BOOLEAN DEFAULT FALSE,
+			last_edited TIMESTAMPTZ
+		);
+
+		CREATE TABLE IF NOT EXISTS reactions (
+			message_id TEXT NOT NULL REFERENCES messages(id),
+			user_id TEXT NOT NULL REFERENCES users(id),
+			emoji TEXT NOT NULL,
+			timestamp TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (message_id, user_id, emoji)
+		);
+
+		CREATE TABLE IF NOT EXISTS files (
+			id TEXT PRIMARY KEY,
+			message_id TEXT NOT NULL REFERENCES messages(id),
+			original_url TEXT NOT NULL,
+			local_path TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			file_type TEXT NOT NULL,
+			size_bytes BIGINT NOT NULL,
+			upload_timestamp TIMESTAMPTZ NOT NULL,
+			checksum TEXT NOT NULL
+		);`,
+		Down: `
+		DROP TABLE IF EXISTS files;
+		DROP TABLE IF EXISTS reactions;
+		DROP TABLE IF EXISTS messages;
+		DROP TABLE IF EXISTS channels;
+		DROP TABLE IF EXISTS users;`,
+	},
+	{
+		Version: 2,
+		Name:    "sync state",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS sync_state (
+			channel_id TEXT PRIMARY KEY REFERENCES channels(id),
+			last_sync_at TIMESTAMPTZ NOT NULL
+		);`,
+		Down: `
+		DROP TABLE IF EXISTS sync_state;`,
+	},
+	{
+		Version: 3,
+		Name:    "message indexes",
+		SQL: `
+		CREATE INDEX IF NOT EXISTS idx_messages_channel_timestamp
+			ON messages (channel_id, timestamp);
+
+		CREATE INDEX IF NOT EXISTS idx_messages_content_search
+			ON messages USING GIN (to_tsvector('simple', COALESCE(content, '')));`,
+		Down: `
+		DROP INDEX IF EXISTS idx_messages_content_search;
+		DROP INDEX IF EXISTS idx_messages_channel_timestamp;`,
+	},
+	{
+		Version: 4,
+		Name:    "backup runs",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS backup_runs (
+			id BIGINT PRIMARY KEY,
+			started_at TIMESTAMPTZ NOT NULL,
+			finished_at TIMESTAMPTZ,
+			triggered_by TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			bytes_downloaded BIGINT NOT NULL DEFAULT 0,
+			api_calls BIGINT NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS backup_run_channels (
+			run_id BIGINT NOT NULL REFERENCES backup_runs(id),
+			channel_id TEXT NOT NULL,
+			messages INTEGER NOT NULL DEFAULT 0,
+			files INTEGER NOT NULL DEFAULT 0,
+			bytes_downloaded BIGINT NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (run_id, channel_id)
+		);`,
+		Down: `
+		DROP TABLE IF EXISTS backup_run_channels;
+		DROP TABLE IF EXISTS backup_runs;`,
+	},
+	{
+		Version: 5,
+		Name:    "backup run IDs",
+		SQL: `
+		ALTER TABLE backup_runs ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+		SELECT setval('backup_runs_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM backup_runs;`,
+		Down: `
+		ALTER TABLE backup_runs ALTER COLUMN id DROP IDENTITY IF EXISTS;`,
+	},
+	{
+		// PostgreSQL archives have always stored UTC; the version is kept
+		// in step with SQLite
+		Version: 6,
+		Name:    "UTC message times",
+		SQL: `
+		SELECT 1;`,
+		Down: `
+		SELECT 1;`,
+	},
+	{
+		Version: 7,
+		Name:    "channel members",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS channel_members (
+			channel_id TEXT NOT NULL REFERENCES channels(id),
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (channel_id, user_id)
+		);`,
+		Down: `
+		DROP TABLE IF EXISTS channel_members;`,
+	},
+}
+
+// migrations returns the migration list for the dialect
+func (d dialect) migrations() []Migration {
+	if d == dialectPostgres {
+		return postgresMigrations
+	}
+	return migrations
+}
+
+// checksum identifies the SQL of a migration
+func (m Migration) checksum() string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(m.SQL)))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationStatus describes one migration known to the binary or recorded
+// in the database
+type MigrationStatus struct {
+	Version    int
+	Name       string
+	AppliedAt  time.Time // zero if pending
+	Modified   bool      // applied SQL differs from this binary's
+	Unverified bool      // applied before checksums were recorded; checked only from the upgrade on
+	Unknown    bool      // recorded in the database but unknown to this binary
+}
+
+// Migrator applies and reverts schema migrations
+type Migrator struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+type appliedMigration struct {
+	appliedAt  time.Time
+	checksum   sql.NullString
+	backfilled bool
+}
+
+// OpenMigrator connects to the database without applying any migrations, so
+// the schema can be inspected or rolled back
+func OpenMigrator(dbPath, dsn string) (*Migrator, error) {
+	if dsn != "" {
+		db, err := openPostgres(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &Migrator{db: db, dialect: dialectPostgres}, nil
+	}
+
+	db, err := openSQLite(dbPath)
 	if err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
+		return nil, err
 	}
+	return &Migrator{db: db, dialect: dialectSQLite}, nil
+}
 
-	// Apply each migration in transaction
-	for _, migration := range migrations {
-		var version int
-		err := db.QueryRow("SELECT version FROM schema_migrations WHERE version = ?", migration.Version).Scan(&version)
-		if err != nil && err != sql.ErrNoRows {
-			return fmt.Errorf("failed to check migration version: %w", err)
+// Close closes the database connection
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// LatestVersion returns the newest schema version this binary supports
+func (m *Migrator) LatestVersion() int {
+	all := m.dialect.migrations()
+	return all[len(all)-1].Version
+}
+
+// CurrentVersion returns the newest applied schema version, 0 for an empty
+// database
+func (m *Migrator) CurrentVersion() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	current := 0
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
+
+// Status lists every known migration plus any unknown ones recorded in the
+// database, in version order
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	known := make(map[int]bool)
+	for _, migration := range m.dialect.migrations() {
+		known[migration.Version] = true
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			status.AppliedAt = a.appliedAt
+			status.Modified = a.checksum.Valid && a.checksum.String != migration.checksum()
+			status.Unverified = a.backfilled || !a.checksum.Valid
 		}
-		if err == nil {
-			continue // Migration already applied
+		statuses = append(statuses, status)
+	}
+	for version, a := range applied {
+		if !known[version] {
+			statuses = append(statuses, MigrationStatus{Version: version, AppliedAt: a.appliedAt, Unknown: true})
 		}
+	}
 
-		tx, err := db.Begin()
-		if err != nil {
-			return fmt.Errorf("failed to start transaction: %w", err)
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up() error {
+	return m.To(m.LatestVersion())
+}
+
+// Down reverts the given number of most recently applied migrations
+func (m *Migrator) Down(steps int) error {
+	current, err := m.CurrentVersion()
+	if err != nil {
+		return err
+	}
+
+	target := current - steps
+	if target < 0 {
+		target = 0
+	}
+	return m.To(target)
+}
+
+// To migrates up or down until version is the newest applied migration.
+// Applied migrations are verified first: the database must not be newer than
+// the binary and their SQL must match what was applied.
+func (m *Migrator) To(version int) error {
+	if version < 0 || version > m.LatestVersion() {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", version, m.LatestVersion())
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+	if err := m.verify(applied); err != nil {
+		return err
+	}
+
+	all := m.dialect.migrations()
+
+	// Revert newest first
+	for i := len(all) - 1; i >= 0; i-- {
+		migration := all[i]
+		if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+			continue
+		}
+		if err := m.run(migration.Down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+			return fmt.Errorf("failed to revert migration %d: %w", migration.Version, err)
 		}
+		logger.Info.Printf("Reverted migration %d (%s)", migration.Version, migration.Name)
+	}
 
-		if _, err := tx.Exec(migration.SQL); err != nil {
-			tx.Rollback()
+	// Apply oldest first
+	for _, migration := range all {
+		if _, ok := applied[migration.Version]; ok || migration.Version > version {
+			continue
+		}
+		err := m.run(migration.SQL,
+			"INSERT INTO schema_migrations (version, applied_at, checksum) VALUES (?, CURRENT_TIMESTAMP, ?)",
+			migration.Version, migration.checksum())
+		if err != nil {
 			return fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
 		}
+		logger.Info.Printf("Applied migration %d (%s)", migration.Version, migration.Name)
+	}
+
+	return nil
+}
+
+// run executes a migration's SQL and the bookkeeping statement in one
+// transaction
+func (m *Migrator) run(migrationSQL, bookkeeping string, args ...interface{}) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	if _, err := tx.Exec(migrationSQL); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		if _, err := tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, datetime('now'))", migration.Version); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	if _, err := tx.Exec(m.dialect.rebind(bookkeeping), args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// verify refuses databases written by a newer binary and migrations whose
+// SQL changed after being applied. Migrations applied before checksums were
+// recorded get this binary's checksum filled in and are marked as
+// backfilled, since what was actually applied can no longer be checked.
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	known := make(map[int]Migration)
+	for _, migration := range m.dialect.migrations() {
+		known[migration.Version] = migration
+	}
+
+	for version, a := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: database has migration %d, latest supported is %d; upgrade backup_slack",
+				ErrSchemaTooNew, version, m.LatestVersion())
 		}
 
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
+		if !a.checksum.Valid {
+			_, err := m.db.Exec(m.dialect.rebind("UPDATE schema_migrations SET checksum = ?, checksum_backfilled = TRUE WHERE version = ?"),
+				migration.checksum(), version)
+			if err != nil {
+				return fmt.Errorf("failed to record checksum for migration %d: %w", version, err)
+			}
+			logger.Warn.Printf("Migration %d (%s) was applied before checksums were recorded; it is verified from now on",
+				version, migration.Name)
+			continue
+		}
+
+		if a.checksum.String != migration.checksum() {
+			return fmt.Errorf("migration %d (%s) has been modified since it was applied (checksum %s, expected %s)",
+				version, migration.Name, a.checksum.String, migration.checksum())
 		}
 	}
 
 	return nil
 }
+
+// applied returns the migrations recorded in the database, creating the
+// bookkeeping table if needed
+func (m *Migrator) applied() (map[int]appliedMigration, error) {
+	// Create migrations table if it doesn't exist
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at ` + m.dialect.timestampType() + ` NOT NULL,
+		checksum TEXT,
+		checksum_backfilled BOOLEAN NOT NULL DEFAULT FALSE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	// Databases created before checksums were introduced lack the column
+	if _, err := m.db.Exec("SELECT checksum FROM schema_migrations WHERE 1 = 0"); err != nil {
+		if _, err := m.db.Exec("ALTER TABLE schema_migrations ADD COLUMN checksum TEXT"); err != nil {
+			return nil, fmt.Errorf("failed to add checksum column: %w", err)
+		}
+	}
+	if _, err := m.db.Exec("SELECT checksum_backfilled FROM schema_migrations WHERE 1 = 0"); err != nil {
+		if _, err := m.db.Exec("ALTER TABLE schema_migrations ADD COLUMN checksum_backfilled BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+			return nil, fmt.Errorf("failed to add checksum_backfilled column: %w", err)
+		}
+	}
+
+	rows, err := m.db.Query("SELECT version, applied_at, checksum, checksum_backfilled FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var (
+			version int
+			a       appliedMigration
+		)
+		if err := rows.Scan(&version, &a.appliedAt, &a.checksum, &a.backfilled); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = a
+	}
+
+	return applied, rows.Err()
+}
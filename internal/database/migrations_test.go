@@ -0,0 +1,277 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMigrator(t *testing.T) (*Migrator, string) {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "backup.db")
+	newTestDB(t) // initializes the logger
+	m, err := OpenMigrator(dbPath, "")
+	if err != nil {
+		t.Fatalf("OpenMigrator() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, dbPath
+}
+
+func tableExists(t *testing.T, m *Migrator, name string) bool {
+	t.Helper()
+
+	var n int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	if err != nil {
+		t.Fatalf("Failed to check for table %s: %v", name, err)
+	}
+	return n > 0
+}
+
+func TestMigrator(t *testing.T) {
+	m, _ := newTestMigrator(t)
+	latest := m.LatestVersion()
+
+	steps := []struct {
+		name      string
+		run       func() error
+		want      int
+		syncState bool
+		messages  bool
+	}{
+		{"up", m.Up, latest, true, true},
+		{"down", func() error { return m.Down(1) }, latest - 1, true, true},
+		{"to 1", func() error { return m.To(1) }, 1, false, true},
+		{"down past zero", func() error { return m.Down(10) }, 0, false, false},
+		{"up again", m.Up, latest, true, true},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		got, err := m.CurrentVersion()
+		if err != nil {
+			t.Fatalf("%s: CurrentVersion() error = %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("%s: version = %d, want %d", step.name, got, step.want)
+		}
+		if tableExists(t, m, "sync_state") != step.syncState {
+			t.Errorf("%s: sync_state exists = %v, want %v", step.name, !step.syncState, step.syncState)
+		}
+		if tableExists(t, m, "messages") != step.messages {
+			t.Errorf("%s: messages exists = %v, want %v", step.name, !step.messages, step.messages)
+		}
+	}
+
+	if err := m.To(latest + 1); err == nil {
+		t.Error("To() beyond the latest version should fail")
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(statuses) != latest {
+		t.Fatalf("Status() returned %d migrations, want %d", len(statuses), latest)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt.IsZero() || s.Modified || s.Unknown {
+			t.Errorf("Status() = %+v, want applied and unmodified", s)
+		}
+	}
+}
+
+func TestMigratorRejectsModifiedMigration(t *testing.T) {
+	m, _ := newTestMigrator(t)
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	if _, err := m.db.Exec("UPDATE schema_migrations SET checksum = 'tampered' WHERE version = 2"); err != nil {
+		t.Fatalf("Failed to tamper with checksum: %v", err)
+	}
+
+	err := m.Up()
+	if err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("Up() error = %v, want modified migration error", err)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !statuses[1].Modified {
+		t.Errorf("Status() = %+v, want migration 2 marked modified", statuses[1])
+	}
+}
+
+func TestMigratorBackfillsChecksums(t *testing.T) {
+	m, _ := newTestMigrator(t)
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	// Databases migrated before checksums existed have NULLs
+	if _, err := m.db.Exec("UPDATE schema_migrations SET checksum = NULL"); err != nil {
+		t.Fatalf("Failed to clear checksums: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	var missing int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE checksum IS NULL").Scan(&missing); err != nil {
+		t.Fatalf("Failed to count checksums: %v", err)
+	}
+	if missing != 0 {
+		t.Errorf("%d migrations still lack a checksum", missing)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Unverified || s.Modified {
+			t.Errorf("Status() = %+v, want backfilled checksum marked unverified", s)
+		}
+	}
+
+	// Migrations applied with a checksum are verified
+	if err := m.Down(1); err != nil {
+		t.Fatalf("Down(1) error = %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	statuses, err = m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if last := statuses[len(statuses)-1]; last.Unverified {
+		t.Errorf("Status() last = %+v, want verified after being reapplied", last)
+	}
+}
+
+func TestNewRejectsNewerSchema(t *testing.T) {
+	m, dbPath := newTestMigrator(t)
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	_, err := m.db.Exec("INSERT INTO schema_migrations (version, applied_at, checksum) VALUES (?, CURRENT_TIMESTAMP, 'future')",
+		m.LatestVersion()+1)
+	if err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+
+	db, err := New(dbPath)
+	if err == nil {
+		db.Close()
+	}
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("New() error = %v, want ErrSchemaTooNew", err)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if last := statuses[len(statuses)-1]; !last.Unknown {
+		t.Errorf("Status() last = %+v, want unknown migration", last)
+	}
+}
+
+func TestMigrateBackupRunIDs(t *testing.T) {
+	m, dbPath := newTestMigrator(t)
+	if err := m.To(4); err != nil {
+		t.Fatalf("To(4) error = %v", err)
+	}
+	_, err := m.db.Exec(`
+		INSERT INTO backup_runs (id, started_at, triggered_by, status) VALUES (7, '2024-03-01 03:00:00', 'scheduled', 'succeeded');
+		INSERT INTO backup_run_channels (run_id, channel_id, messages) VALUES (7, 'C1', 12);`)
+	if err != nil {
+		t.Fatalf("Failed to insert run: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer db.Close()
+	run, err := db.GetBackupRun(7)
+	if err != nil || run.Messages() != 12 {
+		t.Fatalf("GetBackupRun(7) = %+v, %v, want the run kept with its channels", run, err)
+	}
+	id, err := db.SaveBackupRun(BackupRun{StartedAt: time.Now(), Trigger: "manual", Status: RunRunning})
+	if err != nil || id != 8 {
+		t.Errorf("SaveBackupRun() = %d, %v, want 8", id, err)
+	}
+
+	if err := m.To(4); err != nil {
+		t.Fatalf("To(4) error = %v", err)
+	}
+	if run, err := db.GetBackupRun(7); err != nil || run.Messages() != 12 {
+		t.Errorf("GetBackupRun(7) after To(4) = %+v, %v, want the run kept", run, err)
+	}
+}
+
+func TestMigrateUTCMessageTimes(t *testing.T) {
+	m, dbPath := newTestMigrator(t)
+	if err := m.To(5); err != nil {
+		t.Fatalf("To(5) error = %v", err)
+	}
+	// 1700000100 is 2023-11-14 22:15:00 UTC
+	_, err := m.db.Exec(`
+		INSERT INTO users (id, username, first_seen) VALUES ('U1', 'alice', '2023-11-01 00:00:00');
+		INSERT INTO channels (id, name, channel_type, created_at) VALUES ('C1', 'general', 'public_channel', '2023-11-01 00:00:00');
+		INSERT INTO messages (id, channel_id, user_id, content, message_type, timestamp, last_edited) VALUES
+			('1700000100.000100', 'C1', 'U1', 'east', 'message', '2023-11-15 00:15:00', '2023-11-15 00:20:00'),
+			('1700000200.000100', 'C1', 'U1', 'west', 'message', '2023-11-14 17:46:40', NULL),
+			('1700000300.000100', 'C1', 'U1', 'utc', 'message', '2023-11-14 22:18:20', '2023-11-14 22:20:00'),
+			('imported-1', 'C1', 'U1', 'no ts', 'message', '2023-11-14 22:00:00', NULL);`)
+	if err != nil {
+		t.Fatalf("Failed to insert messages: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer db.Close()
+	msgs, err := db.GetMessages(MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	want := map[string][2]string{
+		"1700000100.000100": {"2023-11-14 22:15:00", "2023-11-14 22:20:00"},
+		"1700000200.000100": {"2023-11-14 22:16:40", ""},
+		"1700000300.000100": {"2023-11-14 22:18:20", "2023-11-14 22:20:00"},
+		"imported-1":        {"2023-11-14 22:00:00", ""},
+	}
+	for _, msg := range msgs {
+		var edited string
+		if msg.LastEdited.Valid {
+			edited = msg.LastEdited.Time.UTC().Format(sqliteTimeLayout)
+		}
+		got := [2]string{msg.Timestamp.UTC().Format(sqliteTimeLayout), edited}
+		if got != want[msg.ID] {
+			t.Errorf("Message %s times = %v, want %v", msg.ID, got, want[msg.ID])
+		}
+	}
+	if len(msgs) != len(want) {
+		t.Errorf("Got %d messages, want %d", len(msgs), len(want))
+	}
+}
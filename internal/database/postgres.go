@@ -0,0 +1,42 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// NewPostgres connects to the PostgreSQL database described by dsn and
+// ensures the schema is up to date
+func NewPostgres(dsn string) (*DB, error) {
+	db, err := openPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply migrations
+	if err := (&Migrator{db: db, dialect: dialectPostgres}).Up(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	return &DB{DB: db, writer: writer{exec: db, dialect: dialectPostgres}}, nil
+}
+
+// openPostgres opens and verifies a PostgreSQL connection without touching
+// the schema
+func openPostgres(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Verify connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPostgresTestDB connects to the server in TEST_POSTGRES_DSN, e.g. a
+// throwaway container started with
+//
+//	docker run --rm -e POSTGRES_PASSWORD=test -p 5432:5432 postgres:16
+//
+// Each test gets its own schema which is dropped afterwards.
+func newPostgresTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("backup_slack_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	db, err := NewPostgres(dsn + sep + "search_path=" + schema)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPostgresStore(t *testing.T) {
+	newTestDB(t) // initializes the logger
+	db := newPostgresTestDB(t)
+
+	if err := db.InsertChannel(Channel{
+		ID:          "C123456",
+		Name:        "general",
+		ChannelType: "public_channel",
+		CreatedAt:   time.Unix(1700000000, 0),
+	}); err != nil {
+		t.Fatalf("Failed to insert channel: %v", err)
+	}
+
+	testStore(t, db)
+}
+
+func TestCopy(t *testing.T) {
+	src := newTestDB(t)
+	testStore(t, src)
+
+	dsts := map[string]func(t *testing.T) Store{
+		"memory":   func(t *testing.T) Store { return NewMemoryStore() },
+		"postgres": func(t *testing.T) Store { return newPostgresTestDB(t) },
+	}
+
+	for name, newStore := range dsts {
+		t.Run(name, func(t *testing.T) {
+			dst := newStore(t)
+
+			stats, err := Copy(dst, src)
+			if err != nil {
+				t.Fatalf("Copy() error = %v", err)
+			}
+			want := CopyStats{Channels: 1, Users: 2, Messages: 3, Reactions: 1, Files: 1, Runs: 2}
+			if stats != want {
+				t.Errorf("Copy() stats = %+v, want %+v", stats, want)
+			}
+
+			// Copying again must be a no-op rather than a conflict
+			if _, err := Copy(dst, src); err != nil {
+				t.Fatalf("second Copy() error = %v", err)
+			}
+
+			msgs, err := dst.GetMessages(MessageFilter{})
+			if err != nil {
+				t.Fatalf("GetMessages() error = %v", err)
+			}
+			if len(msgs) != 3 {
+				t.Errorf("Destination has %d messages, want 3", len(msgs))
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Backup run statuses
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunPartial   = "partial" // some channels failed
+	RunFailed    = "failed"
+)
+
+// ErrRunNotFound is returned by GetBackupRun for unknown run IDs
+var ErrRunNotFound = errors.New("backup run not found")
+
+// BackupRun is the audit record of one backup run. A run left as
+// RunRunning without FinishedAt was interrupted.
+type BackupRun struct {
+	ID              int64
+	StartedAt       time.Time
+	FinishedAt      time.Time // zero until the run ends
+	Trigger         string    // what started the run, e.g. manual or scheduled
+	Status          string
+	Error           string
+	BytesDownloaded int64
+	APICalls        int64
+	Channels        []BackupRunChannel
+}
+
+// BackupRunChannel is what a run backed up from one channel
+type BackupRunChannel struct {
+	ChannelID       string
+	Messages        int
+	Files           int
+	BytesDownloaded int64
+	Error           string
+}
+
+// Messages returns the number of messages stored across all channels
+func (r BackupRun) Messages() int {
+	n := 0
+	for _, ch := range r.Channels {
+		n += ch.Messages
+	}
+	return n
+}
+
+// Files returns the number of files stored across all channels
+func (r BackupRun) Files() int {
+	n := 0
+	for _, ch := range r.Channels {
+		n += ch.Files
+	}
+	return n
+}
+
+// SaveBackupRun inserts or replaces a run along with its channels. A run
+// with ID 0 is inserted with the next ID, which the database assigns and
+// which is returned. Runs with an ID keep it, so Copy can carry them
+// between backends.
+func (db *DB) SaveBackupRun(run BackupRun) (int64, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var finishedAt interface{}
+	if !run.FinishedAt.IsZero() {
+		finishedAt = run.FinishedAt.UTC()
+	}
+	if run.ID == 0 {
+		query := `
+			INSERT INTO backup_runs (
+				started_at, finished_at, triggered_by, status, error, bytes_downloaded, api_calls
+			) VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`
+		if err := tx.QueryRow(db.dialect.rebind(query),
+			run.StartedAt.UTC(), finishedAt, run.Trigger, run.Status, run.Error,
+			run.BytesDownloaded, run.APICalls).Scan(&run.ID); err != nil {
+			return 0, fmt.Errorf("failed to save backup run: %w", err)
+		}
+	} else {
+		query := `
+			INSERT INTO backup_runs (
+				id, started_at, finished_at, triggered_by, status, error, bytes_downloaded, api_calls
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				started_at = excluded.started_at,
+				finished_at = excluded.finished_at,
+				triggered_by = excluded.triggered_by,
+				status = excluded.status,
+				error = excluded.error,
+				bytes_downloaded = excluded.bytes_downloaded,
+				api_calls = excluded.api_calls
+		`
+		if _, err := tx.Exec(db.dialect.rebind(query),
+			run.ID, run.StartedAt.UTC(), finishedAt, run.Trigger, run.Status, run.Error,
+			run.BytesDownloaded, run.APICalls); err != nil {
+			return 0, fmt.Errorf("failed to save backup run %d: %w", run.ID, err)
+		}
+		// Explicit IDs don't advance PostgreSQL's identity sequence, so move
+		// it past copied runs; it is never moved back
+		if db.dialect == dialectPostgres {
+			query := `SELECT setval('backup_runs_id_seq', ?) WHERE ? >= (SELECT last_value FROM backup_runs_id_seq)`
+			if _, err := tx.Exec(db.dialect.rebind(query), run.ID, run.ID); err != nil {
+				return 0, fmt.Errorf("failed to advance backup run IDs past %d: %w", run.ID, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(db.dialect.rebind(`DELETE FROM backup_run_channels WHERE run_id = ?`), run.ID); err != nil {
+		return 0, fmt.Errorf("failed to replace channels of backup run %d: %w", run.ID, err)
+	}
+	for _, ch := range run.Channels {
+		query := `
+			INSERT INTO backup_run_channels (
+				run_id, channel_id, messages, files, bytes_downloaded, error
+			) VALUES (?, ?, ?, ?, ?, ?)
+		`
+		if _, err := tx.Exec(db.dialect.rebind(query),
+			run.ID, ch.ChannelID, ch.Messages, ch.Files, ch.BytesDownloaded, ch.Error); err != nil {
+			return 0, fmt.Errorf("failed to save channel %s of backup run %d: %w", ch.ChannelID, run.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit backup run %d: %w", run.ID, err)
+	}
+	return run.ID, nil
+}
+
+const backupRunColumns = `id, started_at, finished_at, triggered_by, status, error, bytes_downloaded, api_calls`
+
+// GetBackupRuns returns up to limit runs, newest first; 0 is no limit
+func (db *DB) GetBackupRuns(limit int) ([]BackupRun, error) {
+	query := `SELECT ` + backupRunColumns + ` FROM backup_runs ORDER BY id DESC`
+	if limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(limit)
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []BackupRun
+	for rows.Next() {
+		run, err := scanBackupRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get backup runs: %w", err)
+	}
+	rows.Close()
+
+	for i := range runs {
+		if runs[i].Channels, err = db.backupRunChannels(runs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// GetBackupRun returns a run by ID, or ErrRunNotFound
+func (db *DB) GetBackupRun(id int64) (BackupRun, error) {
+	query := `SELECT ` + backupRunColumns + ` FROM backup_runs WHERE id = ?`
+	run, err := scanBackupRun(db.QueryRow(db.dialect.rebind(query), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return BackupRun{}, ErrRunNotFound
+	}
+	if err != nil {
+		return BackupRun{}, err
+	}
+
+	if run.Channels, err = db.backupRunChannels(run.ID); err != nil {
+		return BackupRun{}, err
+	}
+	return run, nil
+}
+
+func (db *DB) backupRunChannels(runID int64) ([]BackupRunChannel, error) {
+	query := `
+		SELECT channel_id, messages, files, bytes_downloaded, error
+		FROM backup_run_channels WHERE run_id = ? ORDER BY channel_id
+	`
+	rows, err := db.Query(db.dialect.rebind(query), runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels of backup run %d: %w", runID, err)
+	}
+	defer rows.Close()
+
+	var channels []BackupRunChannel
+	for rows.Next() {
+		var ch BackupRunChannel
+		if err := rows.Scan(&ch.ChannelID, &ch.Messages, &ch.Files, &ch.BytesDownloaded, &ch.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan backup run channel: %w", err)
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// scanBackupRun reads backupRunColumns from a row
+func scanBackupRun(row interface{ Scan(...interface{}) error }) (BackupRun, error) {
+	var (
+		run        BackupRun
+		finishedAt sql.NullTime
+	)
+	err := row.Scan(&run.ID, &run.StartedAt, &finishedAt, &run.Trigger, &run.Status, &run.Error,
+		&run.BytesDownloaded, &run.APICalls)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, err
+	}
+	if err != nil {
+		return run, fmt.Errorf("failed to scan backup run: %w", err)
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = finishedAt.Time
+	}
+	return run, nil
+}
@@ -0,0 +1,403 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"backup_slack/internal/format"
+	"backup_slack/internal/logger"
+)
+
+// SearchQuery is a parsed search expression. Terms are matched against
+// message content; every other field narrows the results further.
+type SearchQuery struct {
+	Terms   []string  // words and quoted phrases, all of which must match
+	From    []string  // user IDs or names, any of which may match
+	In      []string  // channel IDs or names, any of which may match
+	Before  time.Time // exclusive
+	After   time.Time // inclusive
+	HasFile bool
+	Limit   int
+}
+
+// SearchResult is a message matching a SearchQuery with enough context to
+// display it
+type SearchResult struct {
+	Message     Message
+	ChannelName string
+	Username    string
+	Snippet     string
+}
+
+const defaultSearchLimit = 20
+
+// ParseSearchQuery parses Slack-style search syntax: plain words,
+// "quoted phrases", from:@user, in:#channel, before:YYYY-MM-DD,
+// after:YYYY-MM-DD and has:file. As in Slack, before: and after: exclude
+// the day given.
+func ParseSearchQuery(input string) (SearchQuery, error) {
+	q := SearchQuery{Limit: defaultSearchLimit}
+
+	for _, token := range tokenizeSearch(input) {
+		if token.quoted {
+			q.Terms = append(q.Terms, token.text)
+			continue
+		}
+
+		key, value, found := strings.Cut(token.text, ":")
+		if !found || value == "" {
+			q.Terms = append(q.Terms, token.text)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "from":
+			q.From = append(q.From, strings.TrimPrefix(value, "@"))
+		case "in":
+			q.In = append(q.In, strings.TrimPrefix(value, "#"))
+		case "before":
+			day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return q, fmt.Errorf("invalid date in %q: expected YYYY-MM-DD", token.text)
+			}
+			q.Before = day
+		case "after":
+			day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return q, fmt.Errorf("invalid date in %q: expected YYYY-MM-DD", token.text)
+			}
+			q.After = day.AddDate(0, 0, 1)
+		case "has":
+			if strings.ToLower(value) != "file" {
+				return q, fmt.Errorf("unsupported filter %q: only has:file is supported", token.text)
+			}
+			q.HasFile = true
+		default:
+			// Not a filter we know, e.g. a URL or a time like 10:30
+			q.Terms = append(q.Terms, token.text)
+		}
+	}
+
+	return q, nil
+}
+
+type searchToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeSearch splits on whitespace, keeping quoted phrases together. An
+// unterminated quote runs to the end of the input.
+func tokenizeSearch(input string) []searchToken {
+	var (
+		tokens  []searchToken
+		current strings.Builder
+		inQuote bool
+	)
+
+	flush := func(quoted bool) {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			tokens = append(tokens, searchToken{text: text, quoted: quoted})
+		}
+		current.Reset()
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			flush(inQuote)
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush(false)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush(inQuote)
+
+	return tokens
+}
+
+// ErrSearchIndexUnsupported is returned when opening an archive with a
+// full-text search index for writing from a binary built without FTS5
+var ErrSearchIndexUnsupported = errors.New("database has a full-text search index but this binary was built without FTS5; rebuild it with -tags sqlite_fts5 (make build)")
+
+// setupSearchIndex keeps an FTS5 index of message content in sync through
+// triggers. FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build
+// tag, so builds without it fall back to LIKE queries on archives that have
+// never been indexed. They refuse archives that have been, since every write
+// would fire the index triggers, which fail without the module, and
+// dropping them would leave the index silently out of date.
+func setupSearchIndex(db *sql.DB) (bool, error) {
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return false, fmt.Errorf("failed to check for FTS5 support: %w", err)
+	}
+
+	var triggers int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'messages_fts_%'`).Scan(&triggers)
+	if err != nil {
+		return false, fmt.Errorf("failed to check search triggers: %w", err)
+	}
+
+	if !enabled {
+		if triggers > 0 {
+			return false, ErrSearchIndexUnsupported
+		}
+		logger.Debug.Printf("FTS5 not available, search will use LIKE queries")
+		return false, nil
+	}
+	if triggers == 3 {
+		return true, nil
+	}
+
+	// messages_fts is an external content table over messages, keyed by the
+	// implicit rowid
+	_, err = db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+			content, content='messages', content_rowid='rowid'
+		);
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+			INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+		END;
+
+		INSERT INTO messages_fts(messages_fts) VALUES ('rebuild');
+	`)
+	if err != nil {
+		return false, fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	logger.Info.Printf("Built full-text search index")
+	return true, nil
+}
+
+// searchIndexReady reports whether setupSearchIndex has built the
+// full-text index, without changing anything, for read-only connections
+func searchIndexReady(db *sql.DB) (bool, error) {
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return false, fmt.Errorf("failed to check for FTS5 support: %w", err)
+	}
+	if !enabled {
+		return false, nil
+	}
+
+	var triggers int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'messages_fts_%'`).Scan(&triggers)
+	if err != nil {
+		return false, fmt.Errorf("failed to check search triggers: %w", err)
+	}
+	return triggers == 3, nil
+}
+
+// SearchMessages returns messages matching q, best matches first when FTS5
+// is available and newest first otherwise
+func (db *DB) SearchMessages(q SearchQuery) ([]SearchResult, error) {
+	var (
+		conds []string
+		args  []interface{}
+		from  = "FROM messages m"
+		order = "ORDER BY m.timestamp DESC, m.id DESC"
+	)
+
+	if len(q.Terms) > 0 {
+		switch {
+		case db.fts5:
+			from = "FROM messages_fts JOIN messages m ON m.rowid = messages_fts.rowid"
+			conds = append(conds, "messages_fts MATCH ?")
+			args = append(args, ftsMatchExpr(q.Terms))
+			order = "ORDER BY messages_fts.rank, m.timestamp DESC"
+		case db.dialect == dialectPostgres:
+			for _, term := range q.Terms {
+				conds = append(conds, "to_tsvector('simple', COALESCE(m.content, '')) @@ phraseto_tsquery('simple', ?)")
+				args = append(args, term)
+			}
+		default:
+			for _, term := range q.Terms {
+				conds = append(conds, "m.content LIKE ? ESCAPE '\\'")
+				args = append(args, "%"+escapeLike(term)+"%")
+			}
+		}
+	}
+
+	filterConds, filterArgs := q.filters(db.dialect)
+	conds = append(conds, filterConds...)
+	args = append(args, filterArgs...)
+
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	args = append(args, limit)
+
+	query := `
+		SELECT m.id, m.channel_id, m.user_id, COALESCE(m.content, ''), m.timestamp,
+			   m.thread_ts, m.message_type, COALESCE(m.is_deleted, FALSE), m.last_edited,
+			   COALESCE(c.name, m.channel_id), COALESCE(u.username, m.user_id)
+		` + from + `
+		LEFT JOIN channels c ON c.id = m.channel_id
+		LEFT JOIN users u ON u.id = m.user_id
+		` + where + `
+		` + order + `
+		LIMIT ?
+	`
+
+	users, err := db.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	channels, err := db.GetChannels()
+	if err != nil {
+		return nil, err
+	}
+	f := snippetFormatter(users, channels)
+
+	rows, err := db.Query(db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		m := &r.Message
+		err := rows.Scan(&m.ID, &m.ChannelID, &m.UserID, &m.Content, &m.Timestamp,
+			&m.ThreadTS, &m.MessageType, &m.IsDeleted, &m.LastEdited,
+			&r.ChannelName, &r.Username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		r.Snippet = makeSnippet(f.Text(m.Content), q.Terms)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// filters builds the conditions shared by every search backend. It expects
+// messages aliased as m, channels as c and users as u.
+func (q SearchQuery) filters(d dialect) ([]string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	if len(q.From) > 0 {
+		var or []string
+		for _, user := range q.From {
+			or = append(or, "m.user_id = ? OR u.username = ? OR u.display_name = ?")
+			args = append(args, user, user, user)
+		}
+		conds = append(conds, "("+strings.Join(or, " OR ")+")")
+	}
+	if len(q.In) > 0 {
+		var or []string
+		for _, channel := range q.In {
+			or = append(or, "m.channel_id = ? OR c.name = ?")
+			args = append(args, channel, channel)
+		}
+		conds = append(conds, "("+strings.Join(or, " OR ")+")")
+	}
+	if !q.Before.IsZero() {
+		conds = append(conds, "m.timestamp < ?")
+		args = append(args, d.timeArg(q.Before))
+	}
+	if !q.After.IsZero() {
+		conds = append(conds, "m.timestamp >= ?")
+		args = append(args, d.timeArg(q.After))
+	}
+	if q.HasFile {
+		conds = append(conds, "EXISTS (SELECT 1 FROM files f WHERE f.message_id = m.id)")
+	}
+
+	return conds, args
+}
+
+// ftsMatchExpr quotes every term so user input can't inject FTS5 syntax.
+// Quoted multi-word terms become phrase queries.
+func ftsMatchExpr(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// snippetFormatter renders snippets as readable text, resolving mentions
+// against the archived users and channels
+func snippetFormatter(users []User, channels []Channel) *format.Formatter {
+	names := format.Names{Users: make(map[string]string), Channels: make(map[string]string)}
+	for _, u := range users {
+		names.Users[u.ID] = u.Username
+		if u.DisplayName != "" {
+			names.Users[u.ID] = u.DisplayName
+		}
+	}
+	for _, ch := range channels {
+		names.Channels[ch.ID] = ch.Name
+	}
+	return format.New(names)
+}
+
+// makeSnippet returns the part of content around the first matching term,
+// with the match wrapped in brackets
+func makeSnippet(content string, terms []string) string {
+	const context = 60
+
+	lower := strings.ToLower(content)
+	start, end := -1, -1
+	if len(lower) != len(content) {
+		// Case folding changed byte offsets, so offsets into lower can't be
+		// used to slice content
+		terms = nil
+	}
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (start < 0 || i < start) {
+			start, end = i, i+len(term)
+		}
+	}
+
+	if start < 0 {
+		if len(content) > 2*context {
+			return strings.ToValidUTF8(content[:2*context], "") + "..."
+		}
+		return content
+	}
+
+	from, to := start-context, end+context
+	prefix, suffix := "...", "..."
+	if from <= 0 {
+		from, prefix = 0, ""
+	}
+	if to >= len(content) {
+		to, suffix = len(content), ""
+	}
+
+	return prefix + strings.ToValidUTF8(content[from:start], "") +
+		"[" + content[start:end] + "]" +
+		strings.ToValidUTF8(content[end:to], "") + suffix
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return d
+	}
+
+	tests := []struct {
+		input   string
+		want    SearchQuery
+		wantErr bool
+	}{
+		{
+			input: `deploy "rolled back" from:@alice in:#ops`,
+			want: SearchQuery{
+				Terms: []string{"deploy", "rolled back"},
+				From:  []string{"alice"},
+				In:    []string{"ops"},
+			},
+		},
+		{
+			input: "after:2024-03-01 before:2024-03-10 has:file",
+			want: SearchQuery{
+				After:   day("2024-03-02"),
+				Before:  day("2024-03-10"),
+				HasFile: true,
+			},
+		},
+		{
+			input: "https://example.com 10:30",
+			want:  SearchQuery{Terms: []string{"https://example.com", "10:30"}},
+		},
+		{input: "before:yesterday", wantErr: true},
+		{input: "has:link", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSearchQuery(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSearchQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			tt.want.Limit = defaultSearchLimit
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSearchQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"sqlite": func(t *testing.T) Store { return newTestDB(t) },
+		"memory": func(t *testing.T) Store {
+			s := NewMemoryStore()
+			s.InsertChannel(Channel{ID: "C123456", Name: "general", ChannelType: "public_channel"})
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			// Messages are days apart so the date filters, which use local
+			// time, select the same messages in any timezone
+			base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+			err := s.Batch(func(w Writer) error {
+				w.InsertUser(User{ID: "U1", Username: "alice", FirstSeen: base})
+				w.InsertUser(User{ID: "U2", Username: "bob", FirstSeen: base})
+				msgs := []Message{
+					{ID: "1", UserID: "U1", Content: "The deploy was rolled back", Timestamp: base},
+					{ID: "2", UserID: "U2", Content: "Rolled the deploy back again &amp; told <@U1>", Timestamp: base.AddDate(0, 0, 4)},
+					{ID: "3", UserID: "U2", Content: "lunch?", Timestamp: base.AddDate(0, 0, 8)},
+				}
+				for _, m := range msgs {
+					m.ChannelID, m.MessageType = "C123456", "message"
+					if err := w.InsertMessage(m); err != nil {
+						return err
+					}
+				}
+				return w.InsertFile(File{ID: "F1", MessageID: "2", FileName: "log.txt", FileType: "txt", UploadTimestamp: base})
+			})
+			if err != nil {
+				t.Fatalf("Failed to seed store: %v", err)
+			}
+
+			// Content updates must be reflected in the index
+			if err := s.InsertMessage(Message{ID: "3", ChannelID: "C123456", UserID: "U2", Content: "deploy lunch?", Timestamp: base.AddDate(0, 0, 8), MessageType: "message"}); err != nil {
+				t.Fatalf("Failed to update message: %v", err)
+			}
+
+			tests := []struct {
+				query string
+				want  []string
+			}{
+				{"deploy", []string{"1", "2", "3"}},
+				{`"rolled back"`, []string{"1"}},
+				{"deploy from:@bob", []string{"2", "3"}},
+				{"deploy has:file", []string{"2"}},
+				{"in:#general after:2024-03-06", []string{"3"}},
+				{"deploy before:2024-03-03 in:C123456", []string{"1"}},
+				{"nothing-matches-this", nil},
+			}
+
+			for _, tt := range tests {
+				q, err := ParseSearchQuery(tt.query)
+				if err != nil {
+					t.Fatalf("ParseSearchQuery(%q) error = %v", tt.query, err)
+				}
+				results, err := s.SearchMessages(q)
+				if err != nil {
+					t.Fatalf("SearchMessages(%q) error = %v", tt.query, err)
+				}
+
+				got := map[string]bool{}
+				for _, r := range results {
+					got[r.Message.ID] = true
+					if r.ChannelName != "general" {
+						t.Errorf("SearchMessages(%q) channel name = %q, want general", tt.query, r.ChannelName)
+					}
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("SearchMessages(%q) returned %v, want %v", tt.query, got, tt.want)
+					continue
+				}
+				for _, id := range tt.want {
+					if !got[id] {
+						t.Errorf("SearchMessages(%q) missing message %s", tt.query, id)
+					}
+				}
+			}
+
+			// Snippets are readable text rather than raw mrkdwn
+			q, _ := ParseSearchQuery("told")
+			results, err := s.SearchMessages(q)
+			if err != nil {
+				t.Fatalf("SearchMessages(told) error = %v", err)
+			}
+			if len(results) != 1 || results[0].Snippet != "Rolled the deploy back again & [told] @alice" {
+				t.Errorf("SearchMessages(told) = %+v, want snippet with @alice", results)
+			}
+		})
+	}
+}
+
+func TestMakeSnippet(t *testing.T) {
+	got := makeSnippet("the deploy was rolled back", []string{"Rolled"})
+	want := "the deploy was [rolled] back"
+	if got != want {
+		t.Errorf("makeSnippet() = %q, want %q", got, want)
+	}
+}
+
+func TestSearchIndexWithoutFTS5(t *testing.T) {
+	newTestDB(t) // initializes the logger
+	dbPath := filepath.Join(t.TempDir(), "backup.db")
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if db.fts5 {
+		db.Close()
+		t.Skip("built with FTS5")
+	}
+
+	// Stand in for an index built by a binary with FTS5
+	_, err = db.Exec(`CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN SELECT 1; END`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	if _, err := New(dbPath); !errors.Is(err, ErrSearchIndexUnsupported) {
+		t.Fatalf("New() error = %v, want ErrSearchIndexUnsupported", err)
+	}
+
+	// Browsing never writes, so it still works with LIKE queries
+	ro, err := OpenReadOnly(dbPath, "")
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	ro.Close()
+}
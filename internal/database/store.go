@@ -0,0 +1,118 @@
+package database
+
+import (
+	"time"
+)
+
+// Writer is the set of upserts that can be issued either directly against a
+// Store or inside a Batch
+type Writer interface {
+	InsertChannel(ch Channel) error
+	InsertUser(user User) error
+	InsertMessage(msg Message) error
+	InsertFile(file File) error
+	InsertReaction(reaction Reaction) error
+	InsertChannelMember(member ChannelMember) error
+}
+
+// Store is the storage backend used by the service layer. DB is the SQLite
+// implementation; MemoryStore keeps everything in memory for tests.
+type Store interface {
+	Writer
+
+	// Batch runs fn with a Writer whose writes are committed atomically if fn
+	// returns nil and discarded otherwise. fn must only write through w.
+	Batch(fn func(w Writer) error) error
+
+	GetChannels() ([]Channel, error)
+	// GetChannelMembers returns the user IDs recorded as members of a
+	// channel, which only imports provide
+	GetChannelMembers(channelID string) ([]string, error)
+	GetUsers() ([]User, error)
+	GetMessages(filter MessageFilter) ([]Message, error)
+	GetMessagePage(channelID, before string, limit int) ([]Message, error)
+	// CountMessages counts the messages matching filter, ignoring its Limit
+	CountMessages(filter MessageFilter) (int, error)
+	MessageExists(messageID string) (bool, error)
+	GetLastMessageTimestamp(channelID string) (time.Time, error)
+
+	GetFiles(filter MessageFilter) ([]File, error)
+	GetDuplicateFiles(checksum string) ([]File, error)
+	GetOrphanedFiles() ([]File, error)
+	DeleteFile(fileID string) error
+
+	GetReactions(filter MessageFilter) ([]Reaction, error)
+	// DeleteReaction removes a reaction; removing one never stored is not an error
+	DeleteReaction(reaction Reaction) error
+
+	SearchMessages(query SearchQuery) ([]SearchResult, error)
+
+	// GetSyncState returns a zero LastSyncAt for channels never synced
+	GetSyncState(channelID string) (SyncState, error)
+	UpdateSyncState(state SyncState) error
+
+	// SaveBackupRun inserts or replaces a run and returns its ID, assigning
+	// the next one if run.ID is 0
+	SaveBackupRun(run BackupRun) (int64, error)
+	// GetBackupRuns returns up to limit runs, newest first; 0 is no limit
+	GetBackupRuns(limit int) ([]BackupRun, error)
+	// GetBackupRun returns ErrRunNotFound for unknown IDs
+	GetBackupRun(id int64) (BackupRun, error)
+
+	Close() error
+}
+
+// MessageFilter narrows message, file and reaction queries. Zero values
+// leave the corresponding bound open.
+type MessageFilter struct {
+	ChannelIDs []string
+	MessageIDs []string
+	UserIDs    []string
+	ThreadTS   []string  // whole threads, parents included
+	Since      time.Time // inclusive
+	Until      time.Time // exclusive
+	AfterID    string    // exclusive; a cursor since message IDs sort like their timestamps
+	Limit      int       // caps GetMessages only; 0 is no limit
+}
+
+// matches reports whether msg falls inside the filter
+func (f MessageFilter) matches(msg Message) bool {
+	if len(f.ChannelIDs) > 0 && !contains(f.ChannelIDs, msg.ChannelID) {
+		return false
+	}
+	if len(f.MessageIDs) > 0 && !contains(f.MessageIDs, msg.ID) {
+		return false
+	}
+	if len(f.UserIDs) > 0 && !contains(f.UserIDs, msg.UserID) {
+		return false
+	}
+	if len(f.ThreadTS) > 0 && !contains(f.ThreadTS, msg.ID) &&
+		!(msg.ThreadTS.Valid && contains(f.ThreadTS, msg.ThreadTS.String)) {
+		return false
+	}
+	if !f.Since.IsZero() && msg.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !msg.Timestamp.Before(f.Until) {
+		return false
+	}
+	if f.AfterID != "" && msg.ID <= f.AfterID {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	_ Store  = (*DB)(nil)
+	_ Store  = (*MemoryStore)(nil)
+	_ Writer = (*Tx)(nil)
+)
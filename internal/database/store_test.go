@@ -0,0 +1,424 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStores runs the same checks against every Store implementation so the
+// in-memory store stays faithful to the SQLite one
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"sqlite": func(t *testing.T) Store { return newTestDB(t) },
+		"memory": func(t *testing.T) Store {
+			s := NewMemoryStore()
+			if err := s.InsertChannel(Channel{
+				ID:          "C123456",
+				Name:        "general",
+				ChannelType: "public_channel",
+				CreatedAt:   time.Unix(1700000000, 0),
+			}); err != nil {
+				t.Fatalf("Failed to insert channel: %v", err)
+			}
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, newStore(t))
+		})
+	}
+}
+
+// TestCursorOrder pages with AfterID through messages whose times are out
+// of step with their IDs, which must follow the cursor's ID order
+func TestCursorOrder(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"sqlite": func(t *testing.T) Store { return newTestDB(t) },
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+	}
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			err := s.Batch(func(w Writer) error {
+				if err := w.InsertChannel(Channel{ID: "C654321", Name: "random", ChannelType: "public_channel", CreatedAt: base}); err != nil {
+					return err
+				}
+				if err := w.InsertUser(User{ID: "U1", Username: "U1", FirstSeen: base}); err != nil {
+					return err
+				}
+				for _, msg := range []Message{
+					{ID: "1709300000.000100", Timestamp: base.Add(3 * time.Hour)},
+					{ID: "1709300060.000100", Timestamp: base.Add(2 * time.Hour)},
+				} {
+					msg.ChannelID, msg.UserID, msg.MessageType = "C654321", "U1", "message"
+					if err := w.InsertMessage(msg); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Batch() error = %v", err)
+			}
+
+			var ids []string
+			cursor := "0"
+			for i := 0; i < 3; i++ {
+				msgs, err := s.GetMessages(MessageFilter{ChannelIDs: []string{"C654321"}, AfterID: cursor, Limit: 1})
+				if err != nil {
+					t.Fatalf("GetMessages() error = %v", err)
+				}
+				if len(msgs) == 0 {
+					break
+				}
+				ids = append(ids, msgs[0].ID)
+				cursor = msgs[0].ID
+			}
+			if !reflect.DeepEqual(ids, []string{"1709300000.000100", "1709300060.000100"}) {
+				t.Errorf("Paged through %v, want both messages in ID order", ids)
+			}
+		})
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	err := s.Batch(func(w Writer) error {
+		for _, id := range []string{"U1", "U2"} {
+			if err := w.InsertUser(User{ID: id, Username: id, FirstSeen: base}); err != nil {
+				return err
+			}
+		}
+		for i, id := range []string{"1709294400.000100", "1709294460.000100", "1709294520.000100"} {
+			msg := Message{
+				ID:          id,
+				ChannelID:   "C123456",
+				UserID:      "U1",
+				Content:     "message",
+				Timestamp:   base.Add(time.Duration(i) * time.Minute),
+				MessageType: "message",
+			}
+			if i > 0 {
+				msg.ThreadTS = sql.NullString{String: "1709294400.000100", Valid: true}
+			}
+			if err := w.InsertMessage(msg); err != nil {
+				return err
+			}
+		}
+		if err := w.InsertReaction(Reaction{MessageID: "1709294400.000100", UserID: "U2", Emoji: "tada", Timestamp: base}); err != nil {
+			return err
+		}
+		return w.InsertFile(File{
+			ID:              "F1",
+			MessageID:       "1709294460.000100",
+			OriginalURL:     "https://files.slack.com/F1",
+			LocalPath:       "/tmp/F1.png",
+			FileName:        "F1.png",
+			FileType:        "png",
+			SizeBytes:       42,
+			UploadTimestamp: base.Add(time.Minute),
+			Checksum:        "abc",
+		})
+	})
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+
+	t.Run("Messages", func(t *testing.T) {
+		msgs, err := s.GetMessages(MessageFilter{ChannelIDs: []string{"C123456"}})
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		if len(msgs) != 3 {
+			t.Fatalf("GetMessages() returned %d messages, want 3", len(msgs))
+		}
+		if !msgs[0].Timestamp.Equal(base) {
+			t.Errorf("First message timestamp = %v, want %v", msgs[0].Timestamp, base)
+		}
+		if !msgs[1].ThreadTS.Valid || msgs[1].ThreadTS.String != "1709294400.000100" {
+			t.Errorf("Second message thread_ts = %+v, want parent ts", msgs[1].ThreadTS)
+		}
+
+		msgs, err = s.GetMessages(MessageFilter{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)})
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		if len(msgs) != 1 || msgs[0].ID != "1709294460.000100" {
+			t.Errorf("GetMessages() with time range = %+v, want only the second message", msgs)
+		}
+
+		for _, tt := range []struct {
+			filter MessageFilter
+			want   int
+		}{
+			{MessageFilter{ChannelIDs: []string{"C123456"}}, 3},
+			{MessageFilter{ChannelIDs: []string{"C999"}}, 0},
+			{MessageFilter{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}, 1},
+		} {
+			if n, err := s.CountMessages(tt.filter); err != nil || n != tt.want {
+				t.Errorf("CountMessages(%+v) = %d, %v, want %d", tt.filter, n, err, tt.want)
+			}
+		}
+	})
+
+	t.Run("Pages and threads", func(t *testing.T) {
+		page, err := s.GetMessagePage("C123456", "", 10)
+		if err != nil {
+			t.Fatalf("GetMessagePage() error = %v", err)
+		}
+		if len(page) != 1 || page[0].ID != "1709294400.000100" {
+			t.Fatalf("GetMessagePage() = %+v, want only the thread parent", page)
+		}
+		page, err = s.GetMessagePage("C123456", page[0].ID, 10)
+		if err != nil {
+			t.Fatalf("GetMessagePage() error = %v", err)
+		}
+		if len(page) != 0 {
+			t.Errorf("GetMessagePage() before the oldest = %+v, want none", page)
+		}
+
+		msgs, err := s.GetMessages(MessageFilter{ThreadTS: []string{"1709294400.000100"}})
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		if len(msgs) != 3 || msgs[0].ID != "1709294400.000100" {
+			t.Errorf("GetMessages() by thread = %+v, want parent and two replies", msgs)
+		}
+
+		msgs, err = s.GetMessages(MessageFilter{UserIDs: []string{"U1"}, AfterID: "1709294400.000100", Limit: 1})
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		if len(msgs) != 1 || msgs[0].ID != "1709294460.000100" {
+			t.Errorf("GetMessages() after cursor = %+v, want only the first reply", msgs)
+		}
+		msgs, err = s.GetMessages(MessageFilter{UserIDs: []string{"U2"}})
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		if len(msgs) != 0 {
+			t.Errorf("GetMessages() by U2 = %+v, want none", msgs)
+		}
+
+		reactions, err := s.GetReactions(MessageFilter{MessageIDs: []string{"1709294400.000100", "1709294460.000100"}})
+		if err != nil {
+			t.Fatalf("GetReactions() error = %v", err)
+		}
+		if len(reactions) != 1 || reactions[0].Emoji != "tada" {
+			t.Errorf("GetReactions() by message = %+v, want tada", reactions)
+		}
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		err := s.InsertMessage(Message{
+			ID:          "1709294400.000100",
+			ChannelID:   "C123456",
+			UserID:      "U1",
+			Content:     "edited",
+			Timestamp:   base,
+			MessageType: "message",
+			LastEdited:  sql.NullTime{Time: base.Add(time.Hour), Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("InsertMessage() error = %v", err)
+		}
+		msgs, err := s.GetMessages(MessageFilter{Until: base.Add(time.Second)})
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		if len(msgs) != 1 || msgs[0].Content != "edited" || !msgs[0].LastEdited.Valid {
+			t.Errorf("GetMessages() after upsert = %+v, want edited content", msgs)
+		}
+	})
+
+	t.Run("User names", func(t *testing.T) {
+		if err := s.InsertUser(User{ID: "U2", Username: "bob", DisplayName: "Bob", FirstSeen: base}); err != nil {
+			t.Fatalf("InsertUser() error = %v", err)
+		}
+		// A later placeholder insert must not clobber the known name
+		if err := s.InsertUser(User{ID: "U2", Username: "U2", FirstSeen: base}); err != nil {
+			t.Fatalf("InsertUser() error = %v", err)
+		}
+
+		users, err := s.GetUsers()
+		if err != nil {
+			t.Fatalf("GetUsers() error = %v", err)
+		}
+		for _, u := range users {
+			if u.ID == "U2" && (u.Username != "bob" || u.DisplayName != "Bob") {
+				t.Errorf("User U2 = %+v, want bob/Bob", u)
+			}
+		}
+	})
+
+	t.Run("Reactions and files", func(t *testing.T) {
+		reactions, err := s.GetReactions(MessageFilter{})
+		if err != nil {
+			t.Fatalf("GetReactions() error = %v", err)
+		}
+		if len(reactions) != 1 || reactions[0].Emoji != "tada" {
+			t.Errorf("GetReactions() = %+v, want one tada", reactions)
+		}
+
+		eyes := Reaction{MessageID: "1709294400.000100", UserID: "U1", Emoji: "eyes", Timestamp: base}
+		if err := s.InsertReaction(eyes); err != nil {
+			t.Fatalf("InsertReaction() error = %v", err)
+		}
+		if err := s.DeleteReaction(eyes); err != nil {
+			t.Fatalf("DeleteReaction() error = %v", err)
+		}
+		// Removing a reaction that was never stored is not an error
+		if err := s.DeleteReaction(eyes); err != nil {
+			t.Errorf("DeleteReaction() of a missing reaction error = %v", err)
+		}
+		reactions, err = s.GetReactions(MessageFilter{})
+		if err != nil {
+			t.Fatalf("GetReactions() error = %v", err)
+		}
+		if len(reactions) != 1 || reactions[0].Emoji != "tada" {
+			t.Errorf("GetReactions() after delete = %+v, want only tada", reactions)
+		}
+
+		files, err := s.GetFiles(MessageFilter{ChannelIDs: []string{"C123456"}})
+		if err != nil {
+			t.Fatalf("GetFiles() error = %v", err)
+		}
+		if len(files) != 1 || files[0].ID != "F1" {
+			t.Errorf("GetFiles() = %+v, want F1", files)
+		}
+
+		dups, err := s.GetDuplicateFiles("abc")
+		if err != nil {
+			t.Fatalf("GetDuplicateFiles() error = %v", err)
+		}
+		if len(dups) != 1 {
+			t.Errorf("GetDuplicateFiles() returned %d files, want 1", len(dups))
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		wantErr := errors.New("abort")
+		err := s.Batch(func(w Writer) error {
+			if err := w.InsertUser(User{ID: "U3", Username: "U3", FirstSeen: base}); err != nil {
+				return err
+			}
+			return wantErr
+		})
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("Batch() error = %v, want %v", err, wantErr)
+		}
+		users, err := s.GetUsers()
+		if err != nil {
+			t.Fatalf("GetUsers() error = %v", err)
+		}
+		if len(users) != 2 {
+			t.Errorf("GetUsers() returned %d users after rollback, want 2", len(users))
+		}
+	})
+
+	t.Run("Sync state", func(t *testing.T) {
+		state, err := s.GetSyncState("C123456")
+		if err != nil {
+			t.Fatalf("GetSyncState() error = %v", err)
+		}
+		if !state.LastSyncAt.IsZero() {
+			t.Errorf("GetSyncState() before sync = %v, want zero time", state.LastSyncAt)
+		}
+
+		if err := s.UpdateSyncState(SyncState{ChannelID: "C123456", LastSyncAt: base}); err != nil {
+			t.Fatalf("UpdateSyncState() error = %v", err)
+		}
+		state, err = s.GetSyncState("C123456")
+		if err != nil {
+			t.Fatalf("GetSyncState() error = %v", err)
+		}
+		if !state.LastSyncAt.Equal(base) {
+			t.Errorf("GetSyncState() = %v, want %v", state.LastSyncAt, base)
+		}
+	})
+
+	t.Run("Channel members", func(t *testing.T) {
+		for _, id := range []string{"U2", "U1", "U2"} {
+			if err := s.InsertChannelMember(ChannelMember{ChannelID: "C123456", UserID: id}); err != nil {
+				t.Fatalf("InsertChannelMember(%s) error = %v", id, err)
+			}
+		}
+		members, err := s.GetChannelMembers("C123456")
+		if err != nil {
+			t.Fatalf("GetChannelMembers() error = %v", err)
+		}
+		if !reflect.DeepEqual(members, []string{"U1", "U2"}) {
+			t.Errorf("GetChannelMembers() = %v, want [U1 U2]", members)
+		}
+	})
+
+	t.Run("Backup runs", func(t *testing.T) {
+		if _, err := s.GetBackupRun(1); !errors.Is(err, ErrRunNotFound) {
+			t.Fatalf("GetBackupRun() before any run error = %v, want %v", err, ErrRunNotFound)
+		}
+
+		run := BackupRun{StartedAt: base, Trigger: "scheduled", Status: RunRunning}
+		id, err := s.SaveBackupRun(run)
+		if err != nil {
+			t.Fatalf("SaveBackupRun() error = %v", err)
+		}
+		if id != 1 {
+			t.Errorf("SaveBackupRun() ID = %d, want 1", id)
+		}
+
+		run.ID = id
+		run.FinishedAt = base.Add(time.Minute)
+		run.Status = RunPartial
+		run.Error = "1 of 2 channels failed"
+		run.BytesDownloaded = 2048
+		run.APICalls = 12
+		run.Channels = []BackupRunChannel{
+			{ChannelID: "C999999", Error: "channel_not_found"},
+			{ChannelID: "C123456", Messages: 3, Files: 1, BytesDownloaded: 2048},
+		}
+		if _, err := s.SaveBackupRun(run); err != nil {
+			t.Fatalf("SaveBackupRun() update error = %v", err)
+		}
+
+		second, err := s.SaveBackupRun(BackupRun{StartedAt: base.Add(time.Hour), Trigger: "manual", Status: RunRunning})
+		if err != nil {
+			t.Fatalf("SaveBackupRun() error = %v", err)
+		}
+		if second != 2 {
+			t.Errorf("SaveBackupRun() ID = %d, want 2", second)
+		}
+
+		got, err := s.GetBackupRun(id)
+		if err != nil {
+			t.Fatalf("GetBackupRun() error = %v", err)
+		}
+		if !got.StartedAt.Equal(run.StartedAt) || !got.FinishedAt.Equal(run.FinishedAt) {
+			t.Errorf("GetBackupRun() times = %v to %v, want %v to %v",
+				got.StartedAt, got.FinishedAt, run.StartedAt, run.FinishedAt)
+		}
+		got.StartedAt, got.FinishedAt = run.StartedAt, run.FinishedAt
+		run.Channels[0], run.Channels[1] = run.Channels[1], run.Channels[0] // sorted by channel
+		if !reflect.DeepEqual(got, run) {
+			t.Errorf("GetBackupRun() = %+v, want %+v", got, run)
+		}
+		if got.Messages() != 3 || got.Files() != 1 {
+			t.Errorf("GetBackupRun() totals = %d messages, %d files, want 3 and 1", got.Messages(), got.Files())
+		}
+
+		runs, err := s.GetBackupRuns(1)
+		if err != nil {
+			t.Fatalf("GetBackupRuns() error = %v", err)
+		}
+		if len(runs) != 1 || runs[0].ID != second || !runs[0].FinishedAt.IsZero() {
+			t.Errorf("GetBackupRuns(1) = %+v, want only the unfinished run %d", runs, second)
+		}
+	})
+}
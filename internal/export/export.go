@@ -0,0 +1,255 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/format"
+)
+
+// Options selects what to export
+type Options struct {
+	Filter database.MessageFilter
+}
+
+// Format is an archive format that can be written from a Store
+type Format struct {
+	Name        string
+	Description string
+	Ext         string // extension of the default output name, empty for directories
+	Write       func(s database.Store, opts Options, out string) error
+}
+
+var formats = []Format{
+	{"slack", "Slack workspace export ZIP", ".zip", WriteSlack},
+	{"html", "Static HTML site with client-side search", "", WriteHTML},
+	{"markdown", "Markdown transcript per channel per month", "", WriteMarkdown},
+	{"text", "Plain-text transcript per channel per month", "", WriteText},
+	{"jsonl", "One JSON object per message, for analytics", ".jsonl", WriteJSONL},
+	{"csv", "One CSV row per message, for analytics", ".csv", WriteCSV},
+	{"parquet", "Parquet dataset partitioned by channel and month", "", WriteParquet},
+	{"mbox", "mbox per channel, one email per conversation-day, for eDiscovery", "", WriteMbox},
+	{"eml", "RFC 5322 message per conversation-day, for eDiscovery", "", WriteEML},
+	{"mattermost", "Mattermost bulk import ZIP", ".zip", WriteMattermost},
+	{"matrix", "Matrix room events per channel, for replaying into a homeserver", "", WriteMatrix},
+}
+
+// Formats lists the supported export formats
+func Formats() []Format {
+	return formats
+}
+
+// Lookup returns the named export format
+func Lookup(name string) (Format, error) {
+	for _, f := range formats {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return Format{}, fmt.Errorf("unknown export format %q (supported: %s)", name, strings.Join(names, ", "))
+}
+
+// archive is everything an exporter needs, loaded once up front
+type archive struct {
+	channels  []database.Channel
+	names     map[string]string // every channel's name by ID, for resolving links
+	users     map[string]database.User
+	messages  map[string][]database.Message  // by channel ID, oldest first
+	reactions map[string][]database.Reaction // by message ID
+	files     map[string][]database.File     // by message ID
+	format    *format.Formatter
+}
+
+// load reads the channels selected by filter along with their messages,
+// reactions and files
+func load(s database.Store, filter database.MessageFilter) (*archive, error) {
+	a, err := loadDirectory(s, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.loadMessages(s, filter); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// loadDirectory reads the channels selected by filter and all users, but no
+// messages, for exporters that read those a slice at a time
+func loadDirectory(s database.Store, filter database.MessageFilter) (*archive, error) {
+	a := &archive{
+		names: make(map[string]string),
+		users: make(map[string]database.User),
+	}
+
+	channels, err := s.GetChannels()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read channels: %w", err)
+	}
+	for _, ch := range channels {
+		a.names[ch.ID] = ch.Name
+		if len(filter.ChannelIDs) == 0 || contains(filter.ChannelIDs, ch.ID) {
+			a.channels = append(a.channels, ch)
+		}
+	}
+	sort.Slice(a.channels, func(i, j int) bool { return a.channels[i].Name < a.channels[j].Name })
+
+	users, err := s.GetUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	for _, u := range users {
+		a.users[u.ID] = u
+	}
+
+	names := format.Names{Users: make(map[string]string), Channels: a.names}
+	for id := range a.users {
+		names.Users[id] = a.userName(id)
+	}
+	a.format = format.New(names)
+
+	return a, nil
+}
+
+// loadMessages replaces the archive's messages, reactions and files with
+// those matching filter
+func (a *archive) loadMessages(s database.Store, filter database.MessageFilter) error {
+	a.messages = make(map[string][]database.Message)
+	a.reactions = make(map[string][]database.Reaction)
+	a.files = make(map[string][]database.File)
+
+	messages, err := s.GetMessages(filter)
+	if err != nil {
+		return fmt.Errorf("failed to read messages: %w", err)
+	}
+	for _, msg := range messages {
+		a.messages[msg.ChannelID] = append(a.messages[msg.ChannelID], msg)
+	}
+
+	reactions, err := s.GetReactions(filter)
+	if err != nil {
+		return fmt.Errorf("failed to read reactions: %w", err)
+	}
+	// Oldest first, so exports list reactions in a stable order
+	sort.SliceStable(reactions, func(i, j int) bool {
+		if !reactions[i].Timestamp.Equal(reactions[j].Timestamp) {
+			return reactions[i].Timestamp.Before(reactions[j].Timestamp)
+		}
+		return reactions[i].UserID < reactions[j].UserID
+	})
+	for _, r := range reactions {
+		a.reactions[r.MessageID] = append(a.reactions[r.MessageID], r)
+	}
+
+	files, err := s.GetFiles(filter)
+	if err != nil {
+		return fmt.Errorf("failed to read files: %w", err)
+	}
+	for _, f := range files {
+		a.files[f.MessageID] = append(a.files[f.MessageID], f)
+	}
+
+	return nil
+}
+
+// threads splits a channel's messages into top-level messages and replies
+// keyed by thread parent. Replies whose parent isn't in the archive, e.g.
+// because it falls outside the export's time range, are returned as
+// top-level messages.
+func (a *archive) threads(channelID string) ([]database.Message, map[string][]database.Message) {
+	present := make(map[string]bool)
+	for _, msg := range a.messages[channelID] {
+		present[msg.ID] = true
+	}
+
+	var top []database.Message
+	replies := make(map[string][]database.Message)
+	for _, msg := range a.messages[channelID] {
+		if isReply(msg) && present[msg.ThreadTS.String] {
+			replies[msg.ThreadTS.String] = append(replies[msg.ThreadTS.String], msg)
+			continue
+		}
+		top = append(top, msg)
+	}
+	return top, replies
+}
+
+// userName returns the best available name for a user ID
+func (a *archive) userName(id string) string {
+	u, ok := a.users[id]
+	switch {
+	case !ok:
+		return id
+	case u.DisplayName != "":
+		return u.DisplayName
+	case u.Username != "":
+		return u.Username
+	}
+	return id
+}
+
+// channelDir is the directory or file name used for a channel, falling back
+// to its ID for unnamed conversations such as DMs
+func channelDir(ch database.Channel) string {
+	name := ch.Name
+	if name == "" {
+		name = ch.ID
+	}
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+}
+
+// createFile creates out and its parent directories
+func createFile(out string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", out, err)
+	}
+	return f, nil
+}
+
+// checkEmptyDir fails unless out is missing or an empty directory, so an
+// export never mixes with the files of an earlier one
+func checkEmptyDir(out string) error {
+	entries, err := os.ReadDir(out)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read output directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("output directory %s is not empty", out)
+	}
+	return nil
+}
+
+// slackTime converts a Slack timestamp such as "1700000100.000100" into a
+// time, keeping the microseconds that database timestamps drop
+func slackTime(ts string) time.Time {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, _ := strconv.ParseInt(sec, 10, 64)
+	us, _ := strconv.ParseInt((frac + "000000")[:6], 10, 64)
+	return time.Unix(s, us*1000)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
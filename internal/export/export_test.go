@@ -0,0 +1,95 @@
+package export
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// base is in local time so the day each message lands on doesn't depend on
+// the machine's timezone
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+
+// tsAt returns the Slack timestamp of a message posted offset after base
+func tsAt(offset time.Duration) string {
+	return strconv.FormatInt(base.Add(offset).Unix(), 10) + ".000100"
+}
+
+// newTestStore returns a store holding a small archive: a thread with two
+// replies, an edited message with a reaction and a file on the next day, a
+// deleted message, and an empty private channel
+func newTestStore(t *testing.T) database.Store {
+	t.Helper()
+
+	if err := logger.Init(filepath.Join(t.TempDir(), "logs"), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	s := database.NewMemoryStore()
+	err := s.Batch(func(w database.Writer) error {
+		channels := []database.Channel{
+			{ID: "C1", Name: "general", ChannelType: "public_channel", CreatedAt: base.AddDate(-1, 0, 0), Topic: "Company news"},
+			{ID: "G1", Name: "secret", ChannelType: "private_channel", CreatedAt: base.AddDate(-1, 0, 0)},
+		}
+		for _, ch := range channels {
+			if err := w.InsertChannel(ch); err != nil {
+				return err
+			}
+		}
+
+		users := []database.User{
+			{ID: "U1", Username: "alice", DisplayName: "Alice", AvatarURL: "https://avatars.example/alice.png", FirstSeen: base},
+			{ID: "U2", Username: "bob", FirstSeen: base},
+		}
+		for _, u := range users {
+			if err := w.InsertUser(u); err != nil {
+				return err
+			}
+		}
+
+		thread := sql.NullString{String: tsAt(0), Valid: true}
+		messages := []database.Message{
+			{ID: tsAt(0), UserID: "U1", Content: "Lunch?", ThreadTS: thread},
+			{ID: tsAt(time.Minute), UserID: "U2", Content: "Sure, *pizza*", ThreadTS: thread},
+			{ID: tsAt(2 * time.Minute), UserID: "U1", Content: "See <@U2> there", ThreadTS: thread},
+			{ID: tsAt(3 * time.Minute), UserID: "U2", Content: "oops", IsDeleted: true},
+			{ID: tsAt(24 * time.Hour), UserID: "U2", Content: "Notes attached",
+				LastEdited: sql.NullTime{Time: base.Add(25 * time.Hour), Valid: true}},
+		}
+		for _, msg := range messages {
+			msg.ChannelID = "C1"
+			msg.MessageType = "message"
+			msg.Timestamp = slackTime(msg.ID)
+			if err := w.InsertMessage(msg); err != nil {
+				return err
+			}
+		}
+
+		for _, userID := range []string{"U1", "U2"} {
+			if err := w.InsertReaction(database.Reaction{MessageID: tsAt(24 * time.Hour), UserID: userID, Emoji: "thumbsup", Timestamp: base}); err != nil {
+				return err
+			}
+		}
+
+		return w.InsertFile(database.File{
+			ID:              "F1",
+			MessageID:       tsAt(24 * time.Hour),
+			OriginalURL:     "https://files.slack.com/files-pri/T1-F1/notes.txt",
+			LocalPath:       "/archive/files/2024/03/02/C1/F1.txt",
+			FileName:        "notes.txt",
+			FileType:        "text",
+			SizeBytes:       12,
+			UploadTimestamp: base.Add(24 * time.Hour),
+			Checksum:        "abc",
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate store: %v", err)
+	}
+	return s
+}
@@ -0,0 +1,317 @@
+package export
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/page"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var htmlTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"initial": page.Initial,
+	"last": func(list []string) string {
+		return list[len(list)-1]
+	},
+}).ParseFS(templateFS, "templates/*.html"))
+
+type htmlChannel struct {
+	Name     string
+	Dir      string
+	Private  bool
+	Archived bool
+	Topic    string
+	Messages int
+	Days     []string
+}
+
+type htmlMessage struct {
+	Anchor    string
+	Author    string
+	AvatarURL string
+	Time      time.Time
+	Text      string        // plain text, for the search index
+	HTML      template.HTML // rendered message
+	EditedAt  time.Time
+	Deleted   bool
+	Orphan    bool // reply whose thread parent isn't in the export
+	Reactions []page.Reaction
+	Files     []htmlFile
+	Replies   []htmlMessage
+}
+
+type htmlFile struct {
+	Name     string
+	Href     string
+	Image    bool
+	Size     string
+	Archived bool // contents copied into the export rather than linked to Slack
+}
+
+// searchEntry is one message in the client-side search index. Field names
+// are short since the index holds every message.
+type searchEntry struct {
+	Channel string `json:"c"`
+	Author  string `json:"a"`
+	Time    string `json:"d"`
+	Text    string `json:"t"`
+	Href    string `json:"h"`
+}
+
+// WriteHTML writes a static site to the directory out: an index page with
+// client-side search, and a page per channel per day with threads nested
+// under their parent. Archived files are copied into out/files so the
+// directory can be browsed offline or handed on as is.
+func WriteHTML(s database.Store, opts Options, out string) error {
+	a, err := load(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(out, "files"), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "style.css"), page.Stylesheet, 0644); err != nil {
+		return fmt.Errorf("failed to write style.css: %w", err)
+	}
+	if err := copyAsset("search.js", filepath.Join(out, "search.js")); err != nil {
+		return err
+	}
+
+	var (
+		channels []htmlChannel
+		index    []searchEntry
+		total    int
+	)
+	for _, ch := range a.channels {
+		hc := htmlChannel{
+			Name:     ch.Name,
+			Dir:      channelDir(ch),
+			Private:  ch.ChannelType == "private_channel",
+			Archived: ch.IsArchived,
+			Topic:    ch.Topic,
+			Messages: len(a.messages[ch.ID]),
+		}
+		if hc.Name == "" {
+			hc.Name = ch.ID
+		}
+
+		days, order := a.htmlDays(ch.ID, out)
+		hc.Days = order
+		if err := os.MkdirAll(filepath.Join(out, hc.Dir), 0755); err != nil {
+			return fmt.Errorf("failed to create channel directory: %w", err)
+		}
+
+		for i, day := range order {
+			page := map[string]interface{}{
+				"Root":     "../",
+				"Channel":  hc,
+				"Day":      day,
+				"Messages": days[day],
+			}
+			if i > 0 {
+				page["Prev"] = order[i-1]
+			}
+			if i < len(order)-1 {
+				page["Next"] = order[i+1]
+			}
+			if err := renderHTML(filepath.Join(out, hc.Dir, day+".html"), "day.html", page); err != nil {
+				return err
+			}
+
+			href := hc.Dir + "/" + day + ".html"
+			for _, msg := range days[day] {
+				index = append(index, searchEntries(hc.Name, href, msg)...)
+			}
+		}
+
+		if err := renderHTML(filepath.Join(out, hc.Dir, "index.html"), "channel.html",
+			map[string]interface{}{"Root": "../", "Channel": hc}); err != nil {
+			return err
+		}
+
+		channels = append(channels, hc)
+		total += hc.Messages
+	}
+
+	// search.js walks the index backwards to list the newest matches first
+	sort.SliceStable(index, func(i, j int) bool { return index[i].Time < index[j].Time })
+	if err := writeSearchIndex(filepath.Join(out, "search-index.js"), index); err != nil {
+		return err
+	}
+	if err := renderHTML(filepath.Join(out, "index.html"), "index.html", map[string]interface{}{
+		"Root":      "",
+		"Channels":  channels,
+		"Messages":  total,
+		"Generated": time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	logger.Info.Printf("Exported %d channels and %d messages to %s", len(channels), total, out)
+	return nil
+}
+
+// htmlDays groups a channel's top-level messages by local day, with replies
+// nested under their parent's day
+func (a *archive) htmlDays(channelID, out string) (map[string][]htmlMessage, []string) {
+	top, replies := a.threads(channelID)
+
+	days := make(map[string][]htmlMessage)
+	var order []string
+	for _, msg := range top {
+		hm := a.htmlMessage(msg, out)
+		hm.Orphan = isReply(msg)
+		for _, reply := range replies[msg.ID] {
+			hm.Replies = append(hm.Replies, a.htmlMessage(reply, out))
+		}
+
+		day := msg.Timestamp.Local().Format("2006-01-02")
+		if _, ok := days[day]; !ok {
+			order = append(order, day)
+		}
+		days[day] = append(days[day], hm)
+	}
+	return days, order
+}
+
+func (a *archive) htmlMessage(msg database.Message, out string) htmlMessage {
+	hm := htmlMessage{
+		Anchor:    "m" + strings.ReplaceAll(msg.ID, ".", ""),
+		Author:    a.userName(msg.UserID),
+		AvatarURL: a.users[msg.UserID].AvatarURL,
+		Time:      msg.Timestamp.Local(),
+		Text:      a.format.Text(msg.Content),
+		HTML:      a.format.HTML(msg.Content),
+		Deleted:   msg.IsDeleted,
+	}
+	if msg.LastEdited.Valid {
+		hm.EditedAt = msg.LastEdited.Time.Local()
+	}
+
+	hm.Reactions = page.GroupReactions(a.reactions[msg.ID], a.userName)
+
+	for _, f := range a.files[msg.ID] {
+		hf := htmlFile{
+			Name:  f.FileName,
+			Href:  f.OriginalURL,
+			Image: page.IsImage(f.FileType),
+			Size:  page.HumanSize(f.SizeBytes),
+		}
+		if name, err := copyArchivedFile(f, filepath.Join(out, "files")); err != nil {
+			logger.Warn.Printf("Failed to copy file %s into export, linking to Slack instead: %v", f.ID, err)
+		} else if name != "" {
+			hf.Href = "../files/" + name
+			hf.Archived = true
+		}
+		hm.Files = append(hm.Files, hf)
+	}
+
+	return hm
+}
+
+func searchEntries(channel, href string, msg htmlMessage) []searchEntry {
+	entries := []searchEntry{{
+		Channel: channel,
+		Author:  msg.Author,
+		Time:    msg.Time.Format("2006-01-02 15:04"),
+		Text:    msg.Text,
+		Href:    href + "#" + msg.Anchor,
+	}}
+	for _, reply := range msg.Replies {
+		entries = append(entries, searchEntries(channel, href, reply)...)
+	}
+	return entries
+}
+
+// writeSearchIndex writes the index as a script rather than JSON so that
+// pages opened from disk can load it without fetch
+func writeSearchIndex(path string, index []searchEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to encode search index: %w", err)
+	}
+	content := "var SEARCH_INDEX = " + string(data) + ";\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	return nil
+}
+
+func renderHTML(path, name string, data interface{}) (err error) {
+	f, err := createFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if err := htmlTemplates.ExecuteTemplate(f, name, data); err != nil {
+		return fmt.Errorf("failed to render %s: %w", path, err)
+	}
+	return nil
+}
+
+func copyAsset(name, dest string) error {
+	data, err := templateFS.ReadFile("templates/" + name)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+	return nil
+}
+
+// copyArchivedFile places a downloaded file in dir, hard linking when
+// possible, and returns its name there. It returns an empty name if the file
+// was never downloaded.
+func copyArchivedFile(f database.File, dir string) (string, error) {
+	if f.LocalPath == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(f.LocalPath); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	name := f.ID + filepath.Ext(f.LocalPath)
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil {
+		return name, nil
+	}
+	if err := os.Link(f.LocalPath, dest); err == nil {
+		return name, nil
+	}
+
+	src, err := os.Open(f.LocalPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dest)
+		return "", err
+	}
+	return name, dst.Close()
+}
@@ -0,0 +1,103 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backup_slack/internal/database"
+)
+
+func TestWriteHTML(t *testing.T) {
+	s := newTestStore(t)
+
+	// An image that was downloaded, which should be copied and shown inline
+	image := filepath.Join(t.TempDir(), "F2.png")
+	if err := os.WriteFile(image, []byte("png"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	if err := s.InsertFile(database.File{
+		ID:              "F2",
+		MessageID:       tsAt(0),
+		OriginalURL:     "https://files.slack.com/files-pri/T1-F2/menu.png",
+		LocalPath:       image,
+		FileName:        "menu.png",
+		FileType:        "png",
+		SizeBytes:       3,
+		UploadTimestamp: base,
+		Checksum:        "def",
+	}); err != nil {
+		t.Fatalf("Failed to insert file: %v", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "site")
+	if err := WriteHTML(s, Options{}, out); err != nil {
+		t.Fatalf("WriteHTML() error = %v", err)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(data)
+	}
+
+	for _, name := range []string{"style.css", "search.js", "secret/index.html", "files/F2.png"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("Missing %s: %v", name, err)
+		}
+	}
+
+	index := read("index.html")
+	for _, want := range []string{`href="general/index.html"`, "Company news", "2024-03-01 to 2024-03-02"} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html missing %q", want)
+		}
+	}
+
+	if channel := read("general/index.html"); !strings.Contains(channel, `href="2024-03-02.html"`) {
+		t.Error("general/index.html doesn't link to 2024-03-02")
+	}
+
+	day1 := read("general/2024-03-01.html")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"thread nested", "2 replies"},
+		{"deleted marker", "(deleted)"},
+		{"avatar", `src="https://avatars.example/alice.png"`},
+		{"initial without avatar", `<span class="avatar">B</span>`},
+		{"inline image", `<img class="inline" src="../files/F2.png"`},
+		{"mention resolved", `See <span class="mention">@bob</span> there`},
+		{"formatting rendered", "Sure, <strong>pizza</strong>"},
+		{"next day", `href="2024-03-02.html"`},
+	}
+	for _, tt := range tests {
+		if !strings.Contains(day1, tt.want) {
+			t.Errorf("%s: 2024-03-01.html missing %q", tt.name, tt.want)
+		}
+	}
+	// Replies are nested in their parent, not listed again
+	if n := strings.Count(day1, `class="message`); n != 4 {
+		t.Errorf("2024-03-01.html has %d messages, want 4", n)
+	}
+
+	day2 := read("general/2024-03-02.html")
+	for _, want := range []string{"(edited)", "👍 2", `title=":thumbsup: Alice, bob"`, `href="https://files.slack.com/files-pri/T1-F1/notes.txt"`, "on Slack"} {
+		if !strings.Contains(day2, want) {
+			t.Errorf("2024-03-02.html missing %q", want)
+		}
+	}
+
+	search := read("search-index.js")
+	if !strings.HasPrefix(search, "var SEARCH_INDEX = [") || !strings.Contains(search, `"h":"general/2024-03-02.html#m`) {
+		t.Errorf("search-index.js = %s, want entries linking to message anchors", search)
+	}
+	if strings.Index(search, "Lunch?") > strings.Index(search, "Notes attached") {
+		t.Error("search index is not sorted oldest first")
+	}
+}
@@ -0,0 +1,427 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// mailDomain is used for message IDs and participant addresses. The .invalid
+// TLD guarantees nobody can mistake them for deliverable addresses.
+const mailDomain = "backup-slack.invalid"
+
+// conversation is one email: a channel's top-level messages for a day, or
+// a day of replies in one thread
+type conversation struct {
+	id         string
+	inReplyTo  string
+	references []string
+	subject    string
+	name       string             // file name stem for EML exports
+	parent     *database.Message  // thread parent quoted at the top of replies
+	messages   []database.Message // oldest first
+}
+
+// renderFunc writes the email for a conversation to w
+type renderFunc func(c conversation, w io.Writer) error
+
+// WriteMbox writes an mbox file per channel to the directory out, e.g.
+// out/general.mbox, with one email per conversation-day
+func WriteMbox(s database.Store, opts Options, out string) error {
+	return writeMail(s, opts, out, func(ch database.Channel, convs []conversation, render renderFunc) error {
+		path := filepath.Join(out, channelDir(ch)+".mbox")
+		f, err := createFile(path)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		for _, c := range convs {
+			mw := newMboxWriter(w, c)
+			if err := render(c, mw); err != nil {
+				f.Close()
+				return err
+			}
+			mw.Close()
+		}
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		return f.Close()
+	})
+}
+
+// WriteEML writes one RFC 5322 message per conversation-day to the
+// directory out, e.g. out/general/2024-03-01.eml
+func WriteEML(s database.Store, opts Options, out string) error {
+	return writeMail(s, opts, out, func(ch database.Channel, convs []conversation, render renderFunc) error {
+		for _, c := range convs {
+			if err := writeEMLFile(filepath.Join(out, channelDir(ch), c.name+".eml"), c, render); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeEMLFile renders a conversation straight into the file at path,
+// removing it if rendering fails
+func writeEMLFile(path string, c conversation, render renderFunc) (err error) {
+	f, err := createFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to write %s: %w", path, cerr)
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	if err := render(c, w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeMail(s database.Store, opts Options, out string,
+	write func(ch database.Channel, convs []conversation, render renderFunc) error) error {
+	a, err := load(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var total int
+	for _, ch := range a.channels {
+		convs := a.conversations(ch)
+		if len(convs) == 0 {
+			continue
+		}
+		render := func(c conversation, w io.Writer) error { return a.renderMail(ch, c, w) }
+		if err := write(ch, convs, render); err != nil {
+			return err
+		}
+		total += len(convs)
+	}
+
+	logger.Info.Printf("Exported %d conversations from %d channels to %s", total, len(a.channels), out)
+	return nil
+}
+
+// conversations groups a channel into emails: one per day of top-level
+// messages, and one per day of each thread's replies. Each day of a thread
+// replies to the previous one, starting from the day its parent was posted,
+// so mail clients show threads as In-Reply-To chains.
+func (a *archive) conversations(ch database.Channel) []conversation {
+	top, replies := a.threads(ch.ID)
+	title := "#" + ch.Name
+	if ch.Name == "" {
+		title = ch.ID
+	}
+
+	var convs []conversation
+	dayIDs := make(map[string]string)
+	for _, msg := range top {
+		day := msg.Timestamp.Local().Format("2006-01-02")
+		if n := len(convs); n > 0 && convs[n-1].name == day {
+			convs[n-1].messages = append(convs[n-1].messages, msg)
+			continue
+		}
+		id := fmt.Sprintf("<%s.%s@%s>", ch.ID, day, mailDomain)
+		dayIDs[day] = id
+		convs = append(convs, conversation{
+			id:       id,
+			subject:  title + " " + day,
+			name:     day,
+			messages: []database.Message{msg},
+		})
+	}
+
+	var threads []conversation
+	for _, parent := range top {
+		parent := parent
+		parentDay := parent.Timestamp.Local().Format("2006-01-02")
+		refs := []string{dayIDs[parentDay]}
+		for _, reply := range replies[parent.ID] {
+			day := reply.Timestamp.Local().Format("2006-01-02")
+			name := parentDay + "-thread-" + parent.ID + "-" + day
+			if n := len(threads); n > 0 && threads[n-1].name == name {
+				threads[n-1].messages = append(threads[n-1].messages, reply)
+				continue
+			}
+			id := fmt.Sprintf("<%s.%s.%s@%s>", ch.ID, parent.ID, day, mailDomain)
+			threads = append(threads, conversation{
+				id:         id,
+				inReplyTo:  refs[len(refs)-1],
+				references: append([]string(nil), refs...),
+				subject:    "Re: " + title + " " + parentDay,
+				name:       name,
+				parent:     &parent,
+				messages:   []database.Message{reply},
+			})
+			refs = append(refs, id)
+		}
+	}
+
+	convs = append(convs, threads...)
+	sort.SliceStable(convs, func(i, j int) bool {
+		return convs[i].messages[0].Timestamp.Before(convs[j].messages[0].Timestamp)
+	})
+	return convs
+}
+
+// renderMail writes the RFC 5322 message for a conversation to w, with the
+// transcript as a text part and downloaded files as attachments. Files are
+// encoded as they are read, so attachments of any size never sit in memory.
+func (a *archive) renderMail(ch database.Channel, c conversation, w io.Writer) error {
+	// From is whoever spoke first, To everyone else, or the channel itself
+	// if nobody else took part
+	var participants []string
+	seen := make(map[string]bool)
+	for _, msg := range c.messages {
+		if !seen[msg.UserID] {
+			seen[msg.UserID] = true
+			participants = append(participants, msg.UserID)
+		}
+	}
+	channelName := ch.Name
+	if channelName == "" {
+		channelName = ch.ID
+	}
+	to := []string{(&mail.Address{Name: channelName, Address: ch.ID + "@" + mailDomain}).String()}
+	if len(participants) > 1 {
+		to = to[:0]
+		for _, id := range participants[1:] {
+			to = append(to, a.mailAddress(id))
+		}
+	}
+
+	var body strings.Builder
+	if c.parent != nil {
+		a.writeTranscriptMessage(&body, *c.parent, "> ", textTranscript)
+		body.WriteString("\n")
+	}
+	for i, msg := range c.messages {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		a.writeTranscriptMessage(&body, msg, "", textTranscript)
+	}
+
+	var attachments []database.File
+	for _, msg := range c.messages {
+		for _, f := range a.files[msg.ID] {
+			if f.LocalPath == "" {
+				continue
+			}
+			if _, err := os.Stat(f.LocalPath); err != nil {
+				continue
+			}
+			attachments = append(attachments, f)
+		}
+	}
+
+	var head strings.Builder
+	header := func(key, value string) { fmt.Fprintf(&head, "%s: %s\r\n", key, value) }
+	header("Message-ID", c.id)
+	if c.inReplyTo != "" {
+		header("In-Reply-To", c.inReplyTo)
+		header("References", strings.Join(c.references, " "))
+	}
+	header("Date", c.messages[0].Timestamp.Format(time.RFC1123Z))
+	header("From", a.mailAddress(participants[0]))
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", c.subject))
+	header("X-Slack-Channel", ch.ID)
+	header("MIME-Version", "1.0")
+
+	if len(attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		head.WriteString("\r\n")
+		if _, err := io.WriteString(w, head.String()); err != nil {
+			return err
+		}
+		return writeQuotedPrintable(w, []byte(body.String()))
+	}
+
+	mw := multipart.NewWriter(w)
+	// A boundary derived from the message ID keeps exports reproducible
+	sum := sha256.Sum256([]byte(c.id))
+	if err := mw.SetBoundary(fmt.Sprintf("%x", sum[:16])); err != nil {
+		return err
+	}
+	header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	head.WriteString("\r\n")
+	if _, err := io.WriteString(w, head.String()); err != nil {
+		return err
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeQuotedPrintable(part, []byte(body.String())); err != nil {
+		return err
+	}
+
+	for _, f := range attachments {
+		contentType := mime.TypeByExtension(filepath.Ext(f.FileName))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": f.FileName})},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeBase64File(part, f.LocalPath); err != nil {
+			return fmt.Errorf("failed to attach file %s: %w", f.ID, err)
+		}
+	}
+	return mw.Close()
+}
+
+// mailAddress returns a display-name address for a user
+func (a *archive) mailAddress(userID string) string {
+	return (&mail.Address{Name: a.userName(userID), Address: userID + "@" + mailDomain}).String()
+}
+
+// mboxWriter appends a message to an mbox in mboxrd style, a line at a
+// time: a From_ separator line, LF line endings and any line starting with
+// ">*From " quoted with one more ">". Write errors surface when w is
+// flushed.
+type mboxWriter struct {
+	w    *bufio.Writer
+	line []byte
+}
+
+// newMboxWriter starts a message for c with its From_ line
+func newMboxWriter(w *bufio.Writer, c conversation) *mboxWriter {
+	fmt.Fprintf(w, "From %s@%s %s\n", c.messages[0].UserID, mailDomain,
+		c.messages[0].Timestamp.UTC().Format(time.ANSIC))
+	return &mboxWriter{w: w}
+}
+
+func (m *mboxWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			m.line = append(m.line, p...)
+			return n, nil
+		}
+		m.line = append(m.line, p[:i]...)
+		m.writeLine()
+		p = p[i+1:]
+	}
+}
+
+// writeLine writes the buffered line without its CR
+func (m *mboxWriter) writeLine() {
+	line := bytes.TrimSuffix(m.line, []byte("\r"))
+	if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+		m.w.WriteByte('>')
+	}
+	m.w.Write(line)
+	m.w.WriteByte('\n')
+	m.line = m.line[:0]
+}
+
+// Close ends the message with any unterminated last line and the blank
+// line separating it from the next
+func (m *mboxWriter) Close() {
+	if len(m.line) > 0 {
+		m.writeLine()
+	}
+	m.w.WriteByte('\n')
+}
+
+// writeQuotedPrintable encodes text with CRLF line endings
+func writeQuotedPrintable(w io.Writer, text []byte) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write(bytes.ReplaceAll(text, []byte("\n"), []byte("\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64File encodes the file at path in 76-character lines
+func writeBase64File(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: w})
+	if _, err := io.Copy(enc, f); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\r\n")
+	return err
+}
+
+// lineWrapper inserts a CRLF every 76 bytes written through it
+type lineWrapper struct {
+	w io.Writer
+	n int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.n == 76 {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+			l.n = 0
+		}
+		chunk := p
+		if len(chunk) > 76-l.n {
+			chunk = chunk[:76-l.n]
+		}
+		n, err := l.w.Write(chunk)
+		written += n
+		l.n += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,187 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+// newMailTestStore adds a message with a downloaded file to the test archive
+func newMailTestStore(t *testing.T) database.Store {
+	t.Helper()
+	s := newTestStore(t)
+
+	local := filepath.Join(t.TempDir(), "F2.txt")
+	if err := os.WriteFile(local, []byte("meeting notes"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	err := s.Batch(func(w database.Writer) error {
+		msg := database.Message{ID: tsAt(24*time.Hour + time.Minute), ChannelID: "C1", UserID: "U1",
+			Content: "Minutes attached", MessageType: "message"}
+		msg.Timestamp = slackTime(msg.ID)
+		if err := w.InsertMessage(msg); err != nil {
+			return err
+		}
+		return w.InsertFile(database.File{ID: "F2", MessageID: msg.ID, LocalPath: local,
+			FileName: "minutes.txt", FileType: "text", SizeBytes: 13, UploadTimestamp: msg.Timestamp})
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate store: %v", err)
+	}
+	return s
+}
+
+func TestWriteEML(t *testing.T) {
+	s := newMailTestStore(t)
+	out := t.TempDir()
+
+	if err := WriteEML(s, Options{}, out); err != nil {
+		t.Fatalf("WriteEML() error = %v", err)
+	}
+
+	day := base.Format("2006-01-02")
+	dayMsg := readEML(t, filepath.Join(out, "general", day+".eml"))
+	if got := dayMsg.Header.Get("Message-ID"); got != "<C1."+day+"@backup-slack.invalid>" {
+		t.Errorf("Message-ID = %q", got)
+	}
+	if got := dayMsg.Header.Get("From"); got != `"Alice" <U1@backup-slack.invalid>` {
+		t.Errorf("From = %q, want Alice", got)
+	}
+	if got := dayMsg.Header.Get("To"); got != `"bob" <U2@backup-slack.invalid>` {
+		t.Errorf("To = %q, want bob", got)
+	}
+	if got := dayMsg.Header.Get("Subject"); got != "#general "+day {
+		t.Errorf("Subject = %q", got)
+	}
+	body, _ := io.ReadAll(dayMsg.Body)
+	if !strings.Contains(string(body), "Lunch?") || !strings.Contains(string(body), "(deleted): oops") {
+		t.Errorf("Day body = %q, want both top-level messages", body)
+	}
+	if strings.Contains(string(body), "pizza") {
+		t.Errorf("Day body = %q, want replies left to the thread message", body)
+	}
+
+	thread := readEML(t, filepath.Join(out, "general", day+"-thread-"+tsAt(0)+"-"+day+".eml"))
+	if got := thread.Header.Get("In-Reply-To"); got != dayMsg.Header.Get("Message-ID") {
+		t.Errorf("Thread In-Reply-To = %q, want the day's message", got)
+	}
+	if got := thread.Header.Get("Subject"); got != "Re: #general "+day {
+		t.Errorf("Thread subject = %q", got)
+	}
+	body, _ = io.ReadAll(thread.Body)
+	if !strings.Contains(string(body), "> [") || !strings.Contains(string(body), "See @bob there") {
+		t.Errorf("Thread body = %q, want quoted parent and replies", body)
+	}
+
+	next := readEML(t, filepath.Join(out, "general", base.Add(24*time.Hour).Format("2006-01-02")+".eml"))
+	mediaType, params, err := mime.ParseMediaType(next.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, want multipart/mixed", next.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(next.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		data, _ := io.ReadAll(p)
+		parts = append(parts, p.FileName()+"="+strings.TrimSpace(string(data)))
+	}
+	// F1 was never downloaded, so only F2 is attached; multipart decodes
+	// the quoted-printable text but not base64
+	if len(parts) != 2 || !strings.Contains(parts[0], "notes.txt") || parts[1] != "minutes.txt=bWVldGluZyBub3Rlcw==" {
+		t.Errorf("Parts = %q, want text and minutes.txt", parts)
+	}
+
+	if _, err := os.Stat(filepath.Join(out, "secret")); !os.IsNotExist(err) {
+		t.Errorf("Stat(secret) error = %v, want empty channel skipped", err)
+	}
+}
+
+func TestWriteMbox(t *testing.T) {
+	s := newMailTestStore(t)
+	out := t.TempDir()
+
+	if err := WriteMbox(s, Options{}, out); err != nil {
+		t.Fatalf("WriteMbox() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "general.mbox"))
+	if err != nil {
+		t.Fatalf("Failed to read mbox: %v", err)
+	}
+	mbox := string(data)
+
+	if !strings.HasPrefix(mbox, "From U1@backup-slack.invalid ") {
+		t.Errorf("mbox starts %q, want a From_ line", mbox[:40])
+	}
+	if n := strings.Count(mbox, "\nFrom U"); n != 2 {
+		t.Errorf("Found %d more From_ lines, want 2 (thread and next day)", n)
+	}
+	if strings.Contains(mbox, "\r\n") {
+		t.Error("mbox contains CRLF line endings")
+	}
+	if !strings.Contains(mbox, "\nbWVldGluZyBub3Rlcw==\n") {
+		t.Error("mbox is missing the base64-encoded minutes.txt")
+	}
+}
+
+func TestMboxWriter(t *testing.T) {
+	c := conversation{messages: []database.Message{{UserID: "U1", Timestamp: time.Date(2024, 3, 1, 9, 5, 0, 0, time.UTC)}}}
+	want := "From U1@backup-slack.invalid Fri Mar  1 09:05:00 2024\nSubject: x\n\n>From here\n>>From there\nend\n\n"
+
+	tests := []struct {
+		name   string
+		writes []string
+	}{
+		{"one write", []string{"Subject: x\r\n\r\nFrom here\r\n>From there\r\nend"}},
+		{"split lines", []string{"Subject: x\r", "\n\r\nFr", "om here\r\n>", "From there\r\nend\r\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			w := bufio.NewWriter(&b)
+			mw := newMboxWriter(w, c)
+			for _, s := range tt.writes {
+				if _, err := mw.Write([]byte(s)); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			mw.Close()
+			w.Flush()
+
+			if b.String() != want {
+				t.Errorf("mbox = %q, want %q", b.String(), want)
+			}
+		})
+	}
+}
+
+func readEML(t *testing.T, path string) *mail.Message {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	t.Cleanup(func() { f.Close() })
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("ReadMessage(%s) error = %v", path, err)
+	}
+	return msg
+}
@@ -0,0 +1,263 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/format"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/page"
+)
+
+// matrixServer is the server name in exported room, event and user IDs.
+// Replay tools map it to the target homeserver.
+const matrixServer = "backup-slack.invalid"
+
+// matrixRoom is the file written for each channel
+type matrixRoom struct {
+	RoomID  string         `json:"room_id"`
+	Name    string         `json:"name"`
+	Topic   string         `json:"topic,omitempty"`
+	Private bool           `json:"private"`
+	Direct  bool           `json:"direct"`
+	Members []matrixMember `json:"members"`
+	Events  []matrixEvent  `json:"events"`
+}
+
+type matrixMember struct {
+	UserID      string `json:"user_id"`
+	DisplayName string `json:"displayname"`
+	AvatarURL   string `json:"avatar_url,omitempty"` // the Slack URL, not an mxc:// URI
+}
+
+// matrixEvent is a timeline event in the client-server API's format
+type matrixEvent struct {
+	Type           string                 `json:"type"`
+	EventID        string                 `json:"event_id"`
+	Sender         string                 `json:"sender"`
+	RoomID         string                 `json:"room_id"`
+	OriginServerTS int64                  `json:"origin_server_ts"`
+	Content        map[string]interface{} `json:"content"`
+}
+
+// WriteMatrix writes a JSON file of Matrix events per channel to the
+// directory out, e.g. out/general.json, for replaying into a homeserver.
+// Messages become m.room.message events, thread replies relate to their
+// parent with m.thread, reactions become m.reaction annotations and files
+// become m.file or m.image events. Downloaded files are copied to
+// out/media and referenced by mxc://backup-slack.invalid/<file ID> URIs
+// plus a backup_slack.local_path key holding the path under out. Deleted
+// messages are left out.
+func WriteMatrix(s database.Store, opts Options, out string) error {
+	a, err := load(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(out, "media"), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var total int
+	for _, ch := range a.channels {
+		room := a.matrixRoom(ch, out)
+		if err := writeJSONFile(filepath.Join(out, channelDir(ch)+".json"), room); err != nil {
+			return err
+		}
+		total += len(room.Events)
+	}
+
+	logger.Info.Printf("Exported %d events from %d channels to %s", total, len(a.channels), out)
+	return nil
+}
+
+func (a *archive) matrixRoom(ch database.Channel, out string) matrixRoom {
+	room := matrixRoom{
+		RoomID:  "!" + ch.ID + ":" + matrixServer,
+		Name:    ch.Name,
+		Topic:   ch.Topic,
+		Private: ch.ChannelType != "public_channel",
+		Direct:  ch.ChannelType == "im" || ch.ChannelType == "mpim",
+		Members: []matrixMember{},
+		Events:  []matrixEvent{},
+	}
+	if room.Name == "" {
+		room.Name = ch.ID
+	}
+	for _, id := range a.members(ch.ID) {
+		room.Members = append(room.Members, matrixMember{
+			UserID:      matrixUserID(id),
+			DisplayName: a.userName(id),
+			AvatarURL:   a.users[id].AvatarURL,
+		})
+	}
+
+	top, replies := a.threads(ch.ID)
+	for _, msg := range top {
+		// Replies to a deleted parent are kept, outside any thread
+		var root *string
+		if !msg.IsDeleted {
+			room.Events = append(room.Events, a.matrixEvents(room.RoomID, msg, nil, "", out)...)
+			id := matrixEventID(ch.ID, msg.ID)
+			root = &id
+		}
+
+		latest := ""
+		if root != nil {
+			latest = *root
+		}
+		for _, reply := range replies[msg.ID] {
+			if reply.IsDeleted {
+				continue
+			}
+			room.Events = append(room.Events, a.matrixEvents(room.RoomID, reply, root, latest, out)...)
+			if root != nil {
+				latest = matrixEventID(ch.ID, reply.ID)
+			}
+		}
+	}
+	return room
+}
+
+// matrixEvents returns the message event for msg followed by events for
+// its files and reactions. Replies pass the thread root, and the latest
+// event in the thread for clients without thread support to show as the
+// replied-to message.
+func (a *archive) matrixEvents(roomID string, msg database.Message, root *string, latest, out string) []matrixEvent {
+	eventID := matrixEventID(msg.ChannelID, msg.ID)
+	sender := matrixUserID(msg.UserID)
+	ts := slackTime(msg.ID).UnixMilli()
+
+	relatesTo := func() map[string]interface{} {
+		if root == nil {
+			return nil
+		}
+		return map[string]interface{}{
+			"rel_type":        "m.thread",
+			"event_id":        *root,
+			"is_falling_back": true,
+			"m.in_reply_to":   map[string]interface{}{"event_id": latest},
+		}
+	}
+
+	var events []matrixEvent
+	if msg.Content != "" || len(a.files[msg.ID]) == 0 {
+		content := map[string]interface{}{
+			"msgtype":        "m.text",
+			"body":           strings.TrimSuffix(a.format.Markdown(msg.Content), "\n"),
+			"format":         "org.matrix.custom.html",
+			"formatted_body": string(a.format.HTML(msg.Content)),
+		}
+		if rel := relatesTo(); rel != nil {
+			content["m.relates_to"] = rel
+		}
+		events = append(events, matrixEvent{
+			Type:           "m.room.message",
+			EventID:        eventID,
+			Sender:         sender,
+			RoomID:         roomID,
+			OriginServerTS: ts,
+			Content:        content,
+		})
+	}
+
+	for i, f := range a.files[msg.ID] {
+		msgtype := "m.file"
+		if page.IsImage(f.FileType) {
+			msgtype = "m.image"
+		}
+		info := map[string]interface{}{"size": f.SizeBytes}
+		if t := mime.TypeByExtension(path.Ext(f.FileName)); t != "" {
+			info["mimetype"] = t
+		}
+		content := map[string]interface{}{
+			"msgtype":  msgtype,
+			"body":     f.FileName,
+			"filename": f.FileName,
+			"info":     info,
+		}
+		if name, err := copyArchivedFile(f, filepath.Join(out, "media")); err != nil {
+			logger.Warn.Printf("Failed to copy file %s into export, linking to Slack instead: %v", f.ID, err)
+			content["external_url"] = f.OriginalURL
+		} else if name != "" {
+			content["url"] = "mxc://" + matrixServer + "/" + f.ID
+			content["backup_slack.local_path"] = "media/" + name
+		} else {
+			content["external_url"] = f.OriginalURL
+		}
+		if rel := relatesTo(); rel != nil {
+			content["m.relates_to"] = rel
+		}
+
+		// The first file of a file-only message takes the message's ID so
+		// reactions and replies still point at something
+		id := fmt.Sprintf("$%s-%s-%s:%s", msg.ChannelID, msg.ID, f.ID, matrixServer)
+		if i == 0 && len(events) == 0 {
+			id = eventID
+		}
+		events = append(events, matrixEvent{
+			Type:           "m.room.message",
+			EventID:        id,
+			Sender:         sender,
+			RoomID:         roomID,
+			OriginServerTS: ts,
+			Content:        content,
+		})
+	}
+
+	for _, r := range a.reactions[msg.ID] {
+		events = append(events, matrixEvent{
+			Type:           "m.reaction",
+			EventID:        fmt.Sprintf("$%s-%s-%s-%s:%s", msg.ChannelID, msg.ID, r.UserID, r.Emoji, matrixServer),
+			Sender:         matrixUserID(r.UserID),
+			RoomID:         roomID,
+			OriginServerTS: r.Timestamp.UnixMilli(),
+			Content: map[string]interface{}{
+				"m.relates_to": map[string]interface{}{
+					"rel_type": "m.annotation",
+					"event_id": eventID,
+					"key":      format.EmojiOrShortcode(r.Emoji),
+				},
+			},
+		})
+	}
+
+	return events
+}
+
+// matrixUserID returns a Matrix user ID for a Slack user ID. Localparts
+// must be lowercase.
+func matrixUserID(id string) string {
+	return "@" + strings.ToLower(id) + ":" + matrixServer
+}
+
+func matrixEventID(channelID, ts string) string {
+	return "$" + channelID + "-" + ts + ":" + matrixServer
+}
+
+// writeJSONFile writes v as indented JSON to path, creating its directory
+func writeJSONFile(path string, v interface{}) (err error) {
+	f, err := createFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
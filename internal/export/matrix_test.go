@@ -0,0 +1,91 @@
+package export
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteMatrix(t *testing.T) {
+	s := newMailTestStore(t)
+	out := t.TempDir()
+
+	if err := WriteMatrix(s, Options{}, out); err != nil {
+		t.Fatalf("WriteMatrix() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "general.json"))
+	if err != nil {
+		t.Fatalf("Failed to read room: %v", err)
+	}
+	var room matrixRoom
+	if err := json.Unmarshal(data, &room); err != nil {
+		t.Fatalf("Room is not JSON: %v", err)
+	}
+
+	if room.RoomID != "!C1:backup-slack.invalid" || room.Topic != "Company news" || room.Private {
+		t.Errorf("Room = %+v, want public general", room)
+	}
+	if len(room.Members) != 2 || room.Members[0].UserID != "@u1:backup-slack.invalid" || room.Members[0].DisplayName != "Alice" {
+		t.Errorf("Members = %+v, want alice and bob", room.Members)
+	}
+
+	// Parent, two replies, the edited message with its F1 file event and
+	// two reactions, then the message with F2 and its file event
+	var types []string
+	for _, e := range room.Events {
+		types = append(types, e.Type)
+	}
+	want := []string{"m.room.message", "m.room.message", "m.room.message",
+		"m.room.message", "m.room.message", "m.reaction", "m.reaction",
+		"m.room.message", "m.room.message"}
+	if len(types) != len(want) {
+		t.Fatalf("Event types = %v, want %v", types, want)
+	}
+
+	parent := room.Events[0]
+	if parent.Sender != "@u1:backup-slack.invalid" || parent.Content["body"] != "Lunch?" || parent.OriginServerTS != base.UnixMilli() {
+		t.Errorf("Parent = %+v", parent)
+	}
+
+	second := room.Events[2].Content["m.relates_to"].(map[string]interface{})
+	if second["rel_type"] != "m.thread" || second["event_id"] != parent.EventID {
+		t.Errorf("Reply relation = %v, want thread on %s", second, parent.EventID)
+	}
+	if inReplyTo := second["m.in_reply_to"].(map[string]interface{}); inReplyTo["event_id"] != room.Events[1].EventID {
+		t.Errorf("Reply fallback = %v, want the previous reply", inReplyTo)
+	}
+	if body := room.Events[2].Content["formatted_body"]; body != `See <span class="mention">@bob</span> there` {
+		t.Errorf("formatted_body = %v", body)
+	}
+
+	f1 := room.Events[4].Content
+	if f1["msgtype"] != "m.file" || f1["url"] != nil || f1["external_url"] != "https://files.slack.com/files-pri/T1-F1/notes.txt" {
+		t.Errorf("F1 event = %v, want an external link as it was never downloaded", f1)
+	}
+	reaction := room.Events[5]
+	rel := reaction.Content["m.relates_to"].(map[string]interface{})
+	if rel["rel_type"] != "m.annotation" || rel["key"] != "👍" || rel["event_id"] != room.Events[3].EventID {
+		t.Errorf("Reaction = %+v, want 👍 on the edited message", reaction)
+	}
+
+	f2 := room.Events[8].Content
+	if f2["url"] != "mxc://backup-slack.invalid/F2" || f2["backup_slack.local_path"] != "media/F2.txt" {
+		t.Errorf("F2 event = %v, want local media", f2)
+	}
+	media, err := os.ReadFile(filepath.Join(out, "media", "F2.txt"))
+	if err != nil || string(media) != "meeting notes" {
+		t.Errorf("Media = %q, %v, want the stored file", media, err)
+	}
+
+	for _, e := range room.Events {
+		if e.Content["body"] == "oops" {
+			t.Error("Deleted message was exported")
+		}
+		if e.OriginServerTS < base.UnixMilli() || e.OriginServerTS > base.Add(48*time.Hour).UnixMilli() {
+			t.Errorf("Event %s has timestamp %d", e.EventID, e.OriginServerTS)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/format"
+	"backup_slack/internal/logger"
+)
+
+// mattermostTeam is the team everything is imported into. It can be renamed
+// in Mattermost afterwards.
+const mattermostTeam = "slack"
+
+// mattermostReserved are usernames Mattermost refuses to import
+var mattermostReserved = map[string]bool{
+	"all": true, "channel": true, "here": true, "matterbot": true, "system": true,
+}
+
+// Lines of Mattermost's bulk import format. Only the fields the archive can
+// fill are included.
+type (
+	mattermostLine struct {
+		Type          string                   `json:"type"`
+		Version       int                      `json:"version,omitempty"`
+		Team          *mattermostTeamData      `json:"team,omitempty"`
+		Channel       *mattermostChannel       `json:"channel,omitempty"`
+		User          *mattermostUser          `json:"user,omitempty"`
+		Post          *mattermostPost          `json:"post,omitempty"`
+		DirectChannel *mattermostDirectChannel `json:"direct_channel,omitempty"`
+		DirectPost    *mattermostPost          `json:"direct_post,omitempty"`
+	}
+
+	mattermostTeamData struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+		Type        string `json:"type"`
+	}
+
+	mattermostChannel struct {
+		Team        string `json:"team"`
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+		Type        string `json:"type"` // O for public, P for private
+		Header      string `json:"header,omitempty"`
+		Purpose     string `json:"purpose,omitempty"`
+	}
+
+	mattermostUser struct {
+		Username string                 `json:"username"`
+		Email    string                 `json:"email"`
+		Nickname string                 `json:"nickname,omitempty"`
+		Teams    []mattermostMembership `json:"teams"`
+	}
+
+	mattermostMembership struct {
+		Name     string                 `json:"name"`
+		Roles    string                 `json:"roles"`
+		Channels []mattermostMembership `json:"channels,omitempty"`
+	}
+
+	mattermostDirectChannel struct {
+		Members []string `json:"members"`
+		Header  string   `json:"header,omitempty"`
+	}
+
+	// mattermostPost is used for posts, direct posts and replies, which
+	// differ only in how the channel is identified
+	mattermostPost struct {
+		Team           string                 `json:"team,omitempty"`
+		Channel        string                 `json:"channel,omitempty"`
+		ChannelMembers []string               `json:"channel_members,omitempty"`
+		User           string                 `json:"user"`
+		Message        string                 `json:"message"`
+		CreateAt       int64                  `json:"create_at"`
+		EditAt         int64                  `json:"edit_at,omitempty"`
+		Reactions      []mattermostReaction   `json:"reactions,omitempty"`
+		Attachments    []mattermostAttachment `json:"attachments,omitempty"`
+		Replies        []mattermostPost       `json:"replies,omitempty"`
+	}
+
+	mattermostReaction struct {
+		User      string `json:"user"`
+		EmojiName string `json:"emoji_name"`
+		CreateAt  int64  `json:"create_at"`
+	}
+
+	mattermostAttachment struct {
+		Path string `json:"path"`
+	}
+)
+
+// mattermostExport holds the names Mattermost will know users and channels
+// by, which must be unique and follow its naming rules
+type mattermostExport struct {
+	*archive
+	zw           *zip.Writer
+	usernames    map[string]string   // by user ID
+	channelNames map[string]string   // by channel ID, public and private channels only
+	directUsers  map[string][]string // user IDs by channel ID, direct channels only
+	formatter    *format.Formatter
+	attached     map[string]string // file ID to path in the ZIP
+}
+
+// WriteMattermost writes a ZIP for Mattermost's bulk import (mmctl import
+// upload) holding import.jsonl and the downloaded files under data/.
+// Everything is imported into a single team. Deleted messages are left out;
+// replies to them are imported as standalone posts.
+func WriteMattermost(s database.Store, opts Options, out string) (err error) {
+	a, err := load(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	f, err := createFile(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+
+	m := &mattermostExport{
+		archive:      a,
+		zw:           zip.NewWriter(f),
+		usernames:    make(map[string]string),
+		channelNames: make(map[string]string),
+		directUsers:  make(map[string][]string),
+		attached:     make(map[string]string),
+	}
+	if err := m.loadDirectUsers(s); err != nil {
+		return err
+	}
+	m.assignNames()
+
+	w, err := m.zw.Create("import.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to add import.jsonl: %w", err)
+	}
+	// Attachments are added to the ZIP after import.jsonl is complete, as
+	// only one entry can be written at a time
+	lines, files := m.lines()
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return fmt.Errorf("failed to write import.jsonl: %w", err)
+		}
+	}
+	for _, file := range files {
+		if err := m.addFile(file); err != nil {
+			return err
+		}
+	}
+
+	if err := m.zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish ZIP: %w", err)
+	}
+
+	logger.Info.Printf("Exported %d channels, %d users and %d attachments for Mattermost to %s",
+		len(m.channelNames), len(m.usernames), len(files), out)
+	return nil
+}
+
+// loadDirectUsers collects the members of each direct conversation: those
+// recorded by an import, plus anyone who spoke in it
+func (m *mattermostExport) loadDirectUsers(s database.Store) error {
+	for _, ch := range m.channels {
+		if !isDirect(ch) {
+			continue
+		}
+		stored, err := s.GetChannelMembers(ch.ID)
+		if err != nil {
+			return fmt.Errorf("failed to read members of channel %s: %w", ch.ID, err)
+		}
+		seen := make(map[string]bool)
+		var ids []string
+		for _, id := range append(stored, m.members(ch.ID)...) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		m.directUsers[ch.ID] = ids
+	}
+	return nil
+}
+
+// assignNames picks a valid, unique Mattermost name for every user and
+// channel, and a formatter that mentions users by those names. Authors
+// missing from the users table get a placeholder user, as posts can only
+// be imported for existing users.
+func (m *mattermostExport) assignNames() {
+	for _, ch := range m.channels {
+		for _, msg := range m.messages[ch.ID] {
+			m.addPlaceholderUser(msg.UserID)
+			for _, r := range m.reactions[msg.ID] {
+				m.addPlaceholderUser(r.UserID)
+			}
+		}
+	}
+	for _, ids := range m.directUsers {
+		for _, id := range ids {
+			m.addPlaceholderUser(id)
+		}
+	}
+
+	ids := make([]string, 0, len(m.users))
+	for id := range m.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	taken := make(map[string]bool)
+	for _, id := range ids {
+		name := m.users[id].Username
+		if name == "" {
+			name = id
+		}
+		m.usernames[id] = uniqueName(mattermostName(name, 22), 22, taken)
+	}
+
+	taken = make(map[string]bool)
+	for _, ch := range m.channels {
+		if isDirect(ch) {
+			continue
+		}
+		name := ch.Name
+		if name == "" {
+			name = ch.ID
+		}
+		m.channelNames[ch.ID] = uniqueName(mattermostName(name, 64), 64, taken)
+	}
+
+	m.formatter = format.New(format.Names{Users: m.usernames, Channels: m.names})
+}
+
+func (m *mattermostExport) addPlaceholderUser(id string) {
+	if _, ok := m.users[id]; !ok {
+		m.users[id] = database.User{ID: id, Username: id}
+	}
+}
+
+// lines returns the import lines in the order Mattermost requires: version,
+// team, channels, users, then posts. It also returns the files to attach.
+func (m *mattermostExport) lines() ([]mattermostLine, []database.File) {
+	lines := []mattermostLine{
+		{Type: "version", Version: 1},
+		{Type: "team", Team: &mattermostTeamData{Name: mattermostTeam, DisplayName: "Slack", Type: "O"}},
+	}
+
+	memberships := make(map[string][]mattermostMembership) // by user ID
+	for _, ch := range m.channels {
+		if isDirect(ch) {
+			continue
+		}
+		channelType := "O"
+		if ch.ChannelType == "private_channel" {
+			channelType = "P"
+		}
+		displayName := ch.Name
+		if displayName == "" {
+			displayName = ch.ID
+		}
+		lines = append(lines, mattermostLine{Type: "channel", Channel: &mattermostChannel{
+			Team:        mattermostTeam,
+			Name:        m.channelNames[ch.ID],
+			DisplayName: displayName,
+			Type:        channelType,
+			Header:      ch.Topic,
+			Purpose:     ch.Purpose,
+		}})
+		for _, id := range m.members(ch.ID) {
+			memberships[id] = append(memberships[id], mattermostMembership{Name: m.channelNames[ch.ID], Roles: "channel_user"})
+		}
+	}
+
+	ids := make([]string, 0, len(m.users))
+	for id := range m.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		u := m.users[id]
+		lines = append(lines, mattermostLine{Type: "user", User: &mattermostUser{
+			Username: m.usernames[id],
+			Email:    m.usernames[id] + "@" + mailDomain,
+			Nickname: u.DisplayName,
+			Teams: []mattermostMembership{{
+				Name:     mattermostTeam,
+				Roles:    "team_user",
+				Channels: memberships[id],
+			}},
+		}})
+	}
+
+	var files []database.File
+	dropped := 0
+	for _, ch := range m.channels {
+		var members []string
+		if isDirect(ch) {
+			for _, id := range m.directUsers[ch.ID] {
+				members = append(members, m.usernames[id])
+			}
+			// Direct channels must have two to eight members
+			if len(members) < 2 || len(members) > 8 {
+				dropped++
+				continue
+			}
+			lines = append(lines, mattermostLine{Type: "direct_channel", DirectChannel: &mattermostDirectChannel{
+				Members: members,
+				Header:  ch.Topic,
+			}})
+		}
+
+		emit := func(post mattermostPost) {
+			if members != nil {
+				post.ChannelMembers = members
+				lines = append(lines, mattermostLine{Type: "direct_post", DirectPost: &post})
+				return
+			}
+			post.Team = mattermostTeam
+			post.Channel = m.channelNames[ch.ID]
+			lines = append(lines, mattermostLine{Type: "post", Post: &post})
+		}
+
+		top, replies := m.threads(ch.ID)
+		for _, msg := range top {
+			var thread []mattermostPost
+			for _, reply := range replies[msg.ID] {
+				if reply.IsDeleted {
+					continue
+				}
+				r, attached := m.post(reply)
+				files = append(files, attached...)
+				thread = append(thread, r)
+			}
+
+			// Without its parent a thread can't be rebuilt, so its
+			// replies become posts of their own
+			if msg.IsDeleted {
+				for _, r := range thread {
+					emit(r)
+				}
+				continue
+			}
+			post, attached := m.post(msg)
+			files = append(files, attached...)
+			post.Replies = thread
+			emit(post)
+		}
+	}
+	if dropped > 0 {
+		logger.Warn.Printf("Left out %d direct conversations without two to eight members, which Mattermost can't import", dropped)
+	}
+
+	return lines, files
+}
+
+// post converts a message, returning the downloaded files it attaches
+func (m *mattermostExport) post(msg database.Message) (mattermostPost, []database.File) {
+	p := mattermostPost{
+		User:     m.usernames[msg.UserID],
+		Message:  strings.TrimSuffix(m.formatter.Markdown(msg.Content), "\n"),
+		CreateAt: slackTime(msg.ID).UnixMilli(),
+	}
+	if msg.LastEdited.Valid {
+		p.EditAt = msg.LastEdited.Time.UnixMilli()
+	}
+	for _, r := range m.reactions[msg.ID] {
+		p.Reactions = append(p.Reactions, mattermostReaction{
+			User:      m.usernames[r.UserID],
+			EmojiName: r.Emoji,
+			CreateAt:  r.Timestamp.UnixMilli(),
+		})
+	}
+
+	var files []database.File
+	for _, f := range m.files[msg.ID] {
+		if f.LocalPath == "" {
+			continue
+		}
+		if _, err := os.Stat(f.LocalPath); err != nil {
+			continue
+		}
+		name := path.Join("data", f.ID+"-"+strings.NewReplacer("/", "_", `\`, "_").Replace(f.FileName))
+		m.attached[f.ID] = name
+		p.Attachments = append(p.Attachments, mattermostAttachment{Path: name})
+		files = append(files, f)
+	}
+	return p, files
+}
+
+// addFile copies a downloaded file into the ZIP
+func (m *mattermostExport) addFile(f database.File) error {
+	src, err := os.Open(f.LocalPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", f.ID, err)
+	}
+	defer src.Close()
+
+	w, err := m.zw.Create(m.attached[f.ID])
+	if err != nil {
+		return fmt.Errorf("failed to add file %s: %w", f.ID, err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("failed to add file %s: %w", f.ID, err)
+	}
+	return nil
+}
+
+func isDirect(ch database.Channel) bool {
+	return ch.ChannelType == "im" || ch.ChannelType == "mpim"
+}
+
+// mattermostName lowercases name and replaces anything Mattermost doesn't
+// allow in user and channel names, making sure it starts with a letter
+func mattermostName(name string, max int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	s := b.String()
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		s = "u" + s
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+// uniqueName returns name, or name with a numeric suffix if it's already
+// taken or reserved, and marks the result as taken
+func uniqueName(name string, max int, taken map[string]bool) string {
+	candidate := name
+	for i := 2; taken[candidate] || mattermostReserved[candidate]; i++ {
+		suffix := "-" + strconv.Itoa(i)
+		base := name
+		if len(base)+len(suffix) > max {
+			base = base[:max-len(suffix)]
+		}
+		candidate = base + suffix
+	}
+	taken[candidate] = true
+	return candidate
+}
@@ -0,0 +1,180 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+func TestWriteMattermost(t *testing.T) {
+	s := newMailTestStore(t)
+	err := s.Batch(func(w database.Writer) error {
+		// Only one person spoke in D2 and D3, but D2's members are known
+		for _, id := range []string{"D1", "D2", "D3"} {
+			if err := w.InsertChannel(database.Channel{ID: id, ChannelType: "im"}); err != nil {
+				return err
+			}
+		}
+		for _, userID := range []string{"U1", "U2"} {
+			if err := w.InsertChannelMember(database.ChannelMember{ChannelID: "D2", UserID: userID}); err != nil {
+				return err
+			}
+		}
+		messages := []database.Message{
+			{ID: tsAt(10 * time.Hour), ChannelID: "D1", UserID: "U1", Content: "hi"},
+			{ID: tsAt(10*time.Hour + time.Second), ChannelID: "D1", UserID: "U2", Content: "hi"},
+			{ID: tsAt(11 * time.Hour), ChannelID: "D2", UserID: "U1", Content: "ping"},
+			{ID: tsAt(12 * time.Hour), ChannelID: "D3", UserID: "U2", Content: "note to self"},
+			// A reply to the deleted message
+			{ID: tsAt(4 * time.Minute), ChannelID: "C1", UserID: "U1", Content: "Still here",
+				ThreadTS: sql.NullString{String: tsAt(3 * time.Minute), Valid: true}},
+		}
+		for _, msg := range messages {
+			msg.MessageType = "message"
+			msg.Timestamp = slackTime(msg.ID)
+			if err := w.InsertMessage(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate store: %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "mattermost.zip")
+
+	if err := WriteMattermost(s, Options{}, out); err != nil {
+		t.Fatalf("WriteMattermost() error = %v", err)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Failed to open ZIP: %v", err)
+	}
+	defer zr.Close()
+
+	entries := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	if _, ok := entries["data/F2-minutes.txt"]; !ok || len(entries) != 2 {
+		t.Errorf("ZIP entries = %v, want import.jsonl and data/F2-minutes.txt", entries)
+	}
+
+	rc, err := entries["import.jsonl"].Open()
+	if err != nil {
+		t.Fatalf("Failed to open import.jsonl: %v", err)
+	}
+	defer rc.Close()
+
+	var lines []mattermostLine
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		var line mattermostLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Line %d is not JSON: %v", len(lines)+1, err)
+		}
+		lines = append(lines, line)
+	}
+
+	var types []string
+	for _, line := range lines {
+		types = append(types, line.Type)
+	}
+	// The unnamed DMs sort first, and D3 is left out
+	want := []string{"version", "team", "channel", "channel", "user", "user",
+		"direct_channel", "direct_post", "direct_post", "direct_channel", "direct_post",
+		"post", "post", "post", "post"}
+	if len(types) != len(want) {
+		t.Fatalf("Line types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("Line types = %v, want %v", types, want)
+		}
+	}
+
+	if ch := lines[3].Channel; ch.Name != "secret" || ch.Type != "P" {
+		t.Errorf("Second channel = %+v, want private secret", ch)
+	}
+	alice := lines[4].User
+	if alice.Username != "alice" || alice.Nickname != "Alice" || len(alice.Teams) != 1 ||
+		len(alice.Teams[0].Channels) != 1 || alice.Teams[0].Channels[0].Name != "general" {
+		t.Errorf("User alice = %+v, want member of general", alice)
+	}
+
+	thread := lines[11].Post
+	if thread.Channel != "general" || thread.User != "alice" || len(thread.Replies) != 2 {
+		t.Fatalf("Thread post = %+v, want two replies", thread)
+	}
+	if thread.Replies[1].Message != "See @bob there" || thread.Replies[0].Message != "Sure, **pizza**" {
+		t.Errorf("Replies = %+v", thread.Replies)
+	}
+	if thread.CreateAt != base.UnixMilli() {
+		t.Errorf("CreateAt = %d, want %d", thread.CreateAt, base.UnixMilli())
+	}
+
+	// The deleted message is left out, but its reply is kept on its own
+	if orphan := lines[12].Post; orphan.Message != "Still here" || orphan.Channel != "general" {
+		t.Errorf("Reply to deleted post = %+v, want a standalone post", orphan)
+	}
+	edited := lines[13].Post
+	if edited.EditAt == 0 || len(edited.Reactions) != 2 || edited.Reactions[0].EmojiName != "thumbsup" || len(edited.Attachments) != 0 {
+		t.Errorf("Edited post = %+v, want edit time, two reactions and no attachments", edited)
+	}
+	if attached := lines[14].Post; len(attached.Attachments) != 1 || attached.Attachments[0].Path != "data/F2-minutes.txt" {
+		t.Errorf("Post attachments = %+v, want F2", attached.Attachments)
+	}
+
+	if dm := lines[6].DirectChannel; len(dm.Members) != 2 {
+		t.Errorf("Direct channel = %+v, want alice and bob", dm)
+	}
+	if dp := lines[8].DirectPost; dp.User != "bob" || len(dp.ChannelMembers) != 2 || dp.Channel != "" {
+		t.Errorf("Direct post = %+v", dp)
+	}
+	if dm := lines[9].DirectChannel; len(dm.Members) != 2 {
+		t.Errorf("Direct channel with stored members = %+v, want alice and bob", dm)
+	}
+
+	rc2, _ := entries["data/F2-minutes.txt"].Open()
+	data, _ := io.ReadAll(rc2)
+	rc2.Close()
+	if string(data) != "meeting notes" {
+		t.Errorf("Attachment = %q, want the stored file", data)
+	}
+}
+
+func TestMattermostName(t *testing.T) {
+	tests := []struct {
+		name  string
+		taken []string
+		want  string
+	}{
+		{"alice", nil, "alice"},
+		{"Alice Smith", nil, "alice-smith"},
+		{"U0123", nil, "u0123"},
+		{"42", nil, "u42"},
+		{"here", nil, "here-2"},
+		{"bob", []string{"bob", "bob-2"}, "bob-3"},
+		{"averyveryverylongusername", nil, "averyveryverylongusern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taken := make(map[string]bool)
+			for _, name := range tt.taken {
+				taken[name] = true
+			}
+			if got := uniqueName(mattermostName(tt.name, 22), 22, taken); got != tt.want {
+				t.Errorf("name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// ParquetSchemaVersion is stored in every Parquet file's key-value metadata
+// under backup_slack.schema_version. Columns are only ever appended; any
+// other change to the row types below bumps it.
+const ParquetSchemaVersion = 1
+
+// parquetChannel is a row of channels.parquet
+type parquetChannel struct {
+	ID         string    `parquet:"id"`
+	Name       string    `parquet:"name"`
+	Type       string    `parquet:"type,dict"` // public_channel, private_channel, im or mpim
+	IsArchived bool      `parquet:"is_archived"`
+	CreatedAt  time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Topic      string    `parquet:"topic"`
+	Purpose    string    `parquet:"purpose"`
+}
+
+// parquetUser is a row of users.parquet
+type parquetUser struct {
+	ID          string    `parquet:"id"`
+	Username    string    `parquet:"username"`
+	DisplayName string    `parquet:"display_name"`
+	AvatarURL   string    `parquet:"avatar_url"`
+	FirstSeen   time.Time `parquet:"first_seen,timestamp(millisecond)"`
+}
+
+// parquetMessage is a row of the messages dataset
+type parquetMessage struct {
+	ID            string     `parquet:"id"` // Slack ts, unique within a channel
+	ChannelID     string     `parquet:"channel_id,dict"`
+	UserID        string     `parquet:"user_id,dict"`
+	Timestamp     time.Time  `parquet:"timestamp,timestamp(millisecond)"`
+	ThreadTS      *string    `parquet:"thread_ts,optional"` // thread parent, null outside threads
+	IsReply       bool       `parquet:"is_reply"`
+	MessageType   string     `parquet:"message_type,dict"`
+	Text          string     `parquet:"text"`       // raw Slack mrkdwn
+	TextPlain     string     `parquet:"text_plain"` // mentions and formatting resolved
+	ReactionCount int32      `parquet:"reaction_count"`
+	FileCount     int32      `parquet:"file_count"`
+	EditedAt      *time.Time `parquet:"edited_at,optional"`
+	Deleted       bool       `parquet:"deleted"`
+}
+
+// parquetReaction is a row of the reactions dataset
+type parquetReaction struct {
+	MessageID string    `parquet:"message_id"`
+	ChannelID string    `parquet:"channel_id,dict"`
+	UserID    string    `parquet:"user_id,dict"`
+	Emoji     string    `parquet:"emoji,dict"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+}
+
+// parquetFile is a row of the files dataset
+type parquetFile struct {
+	ID              string    `parquet:"id"`
+	MessageID       string    `parquet:"message_id"`
+	ChannelID       string    `parquet:"channel_id,dict"`
+	Name            string    `parquet:"name"`
+	Type            string    `parquet:"type,dict"`
+	SizeBytes       int64     `parquet:"size_bytes"`
+	UploadTimestamp time.Time `parquet:"upload_timestamp,timestamp(millisecond)"`
+	LocalPath       string    `parquet:"local_path"`
+	URL             string    `parquet:"url"`
+	Checksum        string    `parquet:"checksum"`
+}
+
+// parquetPartition holds one channel-month of the partitioned datasets
+type parquetPartition struct {
+	messages  []parquetMessage
+	reactions []parquetReaction
+	files     []parquetFile
+}
+
+// WriteParquet writes a Parquet dataset to the directory out:
+// channels.parquet and users.parquet, plus messages, reactions and files
+// partitioned Hive-style by channel and UTC month of the message, e.g.
+// out/messages/channel=C123/month=2024-03/part-0.parquet. Partitions are
+// read and written one at a time, so memory use is bounded by the busiest
+// channel-month rather than the whole archive. out must not exist or be
+// empty, since stale partitions left from an earlier export would be read
+// as part of this one.
+func WriteParquet(s database.Store, opts Options, out string) error {
+	if err := checkEmptyDir(out); err != nil {
+		return err
+	}
+	a, err := loadDirectory(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	channels := make([]parquetChannel, len(a.channels))
+	for i, ch := range a.channels {
+		channels[i] = parquetChannel{
+			ID:         ch.ID,
+			Name:       ch.Name,
+			Type:       ch.ChannelType,
+			IsArchived: ch.IsArchived,
+			CreatedAt:  ch.CreatedAt.UTC(),
+			Topic:      ch.Topic,
+			Purpose:    ch.Purpose,
+		}
+	}
+	if err := writeParquet(filepath.Join(out, "channels.parquet"), channels); err != nil {
+		return err
+	}
+
+	users := make([]parquetUser, 0, len(a.users))
+	for _, u := range a.users {
+		users = append(users, parquetUser{
+			ID:          u.ID,
+			Username:    u.Username,
+			DisplayName: u.DisplayName,
+			AvatarURL:   u.AvatarURL,
+			FirstSeen:   u.FirstSeen.UTC(),
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if err := writeParquet(filepath.Join(out, "users.parquet"), users); err != nil {
+		return err
+	}
+
+	var total int
+	for _, ch := range a.channels {
+		n, err := a.writeParquetChannel(s, opts.Filter, ch.ID, out)
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+
+	logger.Info.Printf("Exported %d messages from %d channels to %s", total, len(a.channels), out)
+	return nil
+}
+
+// writeParquetChannel writes a channel's partitions month by month from its
+// oldest message matching filter to its newest, returning the number of
+// messages written
+func (a *archive) writeParquetChannel(s database.Store, filter database.MessageFilter, channelID, out string) (int, error) {
+	filter.ChannelIDs = []string{channelID}
+	filter.Limit = 0
+
+	oldest := filter
+	oldest.Limit = 1
+	first, err := s.GetMessages(oldest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read messages: %w", err)
+	}
+	if len(first) == 0 {
+		return 0, nil
+	}
+	last, err := s.GetLastMessageTimestamp(channelID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	var total int
+	t := first[0].Timestamp.UTC()
+	for month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(last); month = month.AddDate(0, 1, 0) {
+		if !filter.Until.IsZero() && !month.Before(filter.Until) {
+			break
+		}
+
+		part := filter
+		part.Since, part.Until = month, month.AddDate(0, 1, 0)
+		if filter.Since.After(part.Since) {
+			part.Since = filter.Since
+		}
+		if !filter.Until.IsZero() && filter.Until.Before(part.Until) {
+			part.Until = filter.Until
+		}
+		if err := a.loadMessages(s, part); err != nil {
+			return total, err
+		}
+		messages := a.messages[channelID]
+		if len(messages) == 0 {
+			continue
+		}
+
+		p := &parquetPartition{}
+		for _, msg := range messages {
+			a.addParquetRows(p, msg)
+		}
+		dir := filepath.Join("channel="+channelID, "month="+month.Format("2006-01"), "part-0.parquet")
+		if err := writeParquet(filepath.Join(out, "messages", dir), p.messages); err != nil {
+			return total, err
+		}
+		if len(p.reactions) > 0 {
+			if err := writeParquet(filepath.Join(out, "reactions", dir), p.reactions); err != nil {
+				return total, err
+			}
+		}
+		if len(p.files) > 0 {
+			if err := writeParquet(filepath.Join(out, "files", dir), p.files); err != nil {
+				return total, err
+			}
+		}
+		total += len(messages)
+	}
+	return total, nil
+}
+
+// addParquetRows appends a message and its reactions and files to p
+func (a *archive) addParquetRows(p *parquetPartition, msg database.Message) {
+	row := parquetMessage{
+		ID:            msg.ID,
+		ChannelID:     msg.ChannelID,
+		UserID:        msg.UserID,
+		Timestamp:     msg.Timestamp.UTC(),
+		IsReply:       isReply(msg),
+		MessageType:   msg.MessageType,
+		Text:          msg.Content,
+		TextPlain:     a.format.Text(msg.Content),
+		ReactionCount: int32(len(a.reactions[msg.ID])),
+		FileCount:     int32(len(a.files[msg.ID])),
+		Deleted:       msg.IsDeleted,
+	}
+	if msg.ThreadTS.Valid {
+		threadTS := msg.ThreadTS.String
+		row.ThreadTS = &threadTS
+	}
+	if msg.LastEdited.Valid {
+		edited := msg.LastEdited.Time.UTC()
+		row.EditedAt = &edited
+	}
+	p.messages = append(p.messages, row)
+
+	for _, r := range a.reactions[msg.ID] {
+		p.reactions = append(p.reactions, parquetReaction{
+			MessageID: msg.ID,
+			ChannelID: msg.ChannelID,
+			UserID:    r.UserID,
+			Emoji:     r.Emoji,
+			Timestamp: r.Timestamp.UTC(),
+		})
+	}
+	for _, f := range a.files[msg.ID] {
+		p.files = append(p.files, parquetFile{
+			ID:              f.ID,
+			MessageID:       msg.ID,
+			ChannelID:       msg.ChannelID,
+			Name:            f.FileName,
+			Type:            f.FileType,
+			SizeBytes:       f.SizeBytes,
+			UploadTimestamp: f.UploadTimestamp.UTC(),
+			LocalPath:       f.LocalPath,
+			URL:             f.OriginalURL,
+			Checksum:        f.Checksum,
+		})
+	}
+}
+
+// writeParquet writes rows to a zstd-compressed Parquet file at path,
+// tagged with the schema version
+func writeParquet[T any](path string, rows []T) (err error) {
+	f, err := createFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	err = parquet.Write(f, rows,
+		parquet.Compression(&parquet.Zstd),
+		parquet.KeyValueMetadata("backup_slack.schema_version", strconv.Itoa(ParquetSchemaVersion)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
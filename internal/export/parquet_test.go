@@ -0,0 +1,170 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"backup_slack/internal/database"
+)
+
+func TestWriteParquet(t *testing.T) {
+	s := newTestStore(t)
+	out := t.TempDir()
+
+	if err := WriteParquet(s, Options{}, out); err != nil {
+		t.Fatalf("WriteParquet() error = %v", err)
+	}
+
+	channels, err := parquet.ReadFile[parquetChannel](filepath.Join(out, "channels.parquet"))
+	if err != nil {
+		t.Fatalf("Failed to read channels: %v", err)
+	}
+	if len(channels) != 2 || channels[0].ID != "C1" || channels[0].Topic != "Company news" {
+		t.Errorf("Channels = %+v, want general then secret", channels)
+	}
+
+	users, err := parquet.ReadFile[parquetUser](filepath.Join(out, "users.parquet"))
+	if err != nil {
+		t.Fatalf("Failed to read users: %v", err)
+	}
+	if len(users) != 2 || users[0].DisplayName != "Alice" {
+		t.Errorf("Users = %+v, want alice and bob", users)
+	}
+
+	partition := filepath.Join("channel=C1", "month="+base.UTC().Format("2006-01"), "part-0.parquet")
+	messages, err := parquet.ReadFile[parquetMessage](filepath.Join(out, "messages", partition))
+	if err != nil {
+		t.Fatalf("Failed to read messages: %v", err)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("Read %d messages, want 5 (deleted messages included)", len(messages))
+	}
+	if messages[0].ThreadTS == nil || messages[0].IsReply {
+		t.Errorf("Thread parent = %+v, want thread_ts and not a reply", messages[0])
+	}
+	if !messages[2].IsReply || messages[2].TextPlain != "See @bob there" {
+		t.Errorf("Reply = %+v", messages[2])
+	}
+	if !messages[3].Deleted {
+		t.Errorf("Message %s not marked deleted", messages[3].ID)
+	}
+	last := messages[4]
+	if last.EditedAt == nil || last.ReactionCount != 2 || last.FileCount != 1 || !last.Timestamp.Equal(base.Add(24*time.Hour)) {
+		t.Errorf("Edited message = %+v, want edit time, two reactions and a file", last)
+	}
+
+	reactions, err := parquet.ReadFile[parquetReaction](filepath.Join(out, "reactions", partition))
+	if err != nil {
+		t.Fatalf("Failed to read reactions: %v", err)
+	}
+	if len(reactions) != 2 || reactions[0].Emoji != "thumbsup" || reactions[0].ChannelID != "C1" {
+		t.Errorf("Reactions = %+v, want two thumbsup", reactions)
+	}
+
+	files, err := parquet.ReadFile[parquetFile](filepath.Join(out, "files", partition))
+	if err != nil {
+		t.Fatalf("Failed to read files: %v", err)
+	}
+	if len(files) != 1 || files[0].ID != "F1" || files[0].MessageID != last.ID {
+		t.Errorf("Files = %+v, want F1", files)
+	}
+
+	// The private channel has no messages, so no partitions are written for it
+	if _, err := os.Stat(filepath.Join(out, "messages", "channel=G1")); !os.IsNotExist(err) {
+		t.Errorf("Stat(channel=G1) error = %v, want not exist", err)
+	}
+
+	f, err := os.Open(filepath.Join(out, "messages", partition))
+	if err != nil {
+		t.Fatalf("Failed to open messages: %v", err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if v, _ := pf.Lookup("backup_slack.schema_version"); v != strconv.Itoa(ParquetSchemaVersion) {
+		t.Errorf("Schema version = %q, want %d", v, ParquetSchemaVersion)
+	}
+}
+
+func TestWriteParquetPartitions(t *testing.T) {
+	later := base.AddDate(0, 2, 14)
+
+	tests := []struct {
+		name   string
+		filter database.MessageFilter
+		want   map[string]int // messages per month partition of C1
+	}{
+		{"all", database.MessageFilter{}, map[string]int{
+			base.UTC().Format("2006-01"):  5,
+			later.UTC().Format("2006-01"): 1,
+		}},
+		{"since", database.MessageFilter{Since: base.Add(12 * time.Hour)}, map[string]int{
+			base.UTC().Format("2006-01"):  1,
+			later.UTC().Format("2006-01"): 1,
+		}},
+		{"until", database.MessageFilter{Until: later.Add(-time.Hour)}, map[string]int{
+			base.UTC().Format("2006-01"): 5,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			err := s.InsertMessage(database.Message{ID: tsAt(later.Sub(base)), ChannelID: "C1", UserID: "U1",
+				Content: "Later", MessageType: "message", Timestamp: later})
+			if err != nil {
+				t.Fatalf("InsertMessage() error = %v", err)
+			}
+			out := t.TempDir()
+
+			if err := WriteParquet(s, Options{Filter: tt.filter}, out); err != nil {
+				t.Fatalf("WriteParquet() error = %v", err)
+			}
+
+			dirs, err := filepath.Glob(filepath.Join(out, "messages", "channel=C1", "month=*"))
+			if err != nil {
+				t.Fatalf("Glob() error = %v", err)
+			}
+			got := make(map[string]int)
+			for _, dir := range dirs {
+				messages, err := parquet.ReadFile[parquetMessage](filepath.Join(dir, "part-0.parquet"))
+				if err != nil {
+					t.Fatalf("Failed to read %s: %v", dir, err)
+				}
+				got[strings.TrimPrefix(filepath.Base(dir), "month=")] = len(messages)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Partitions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteParquetRefusesNonEmptyDir(t *testing.T) {
+	s := newTestStore(t)
+	out := t.TempDir()
+	stale := filepath.Join(out, "messages", "channel=C9", "month=2020-01", "part-0.parquet")
+	if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteParquet(s, Options{}, out); err == nil {
+		t.Error("WriteParquet() into a non-empty directory should fail")
+	}
+	if _, err := os.Stat(filepath.Join(out, "channels.parquet")); !os.IsNotExist(err) {
+		t.Errorf("Stat(channels.parquet) error = %v, want nothing written", err)
+	}
+}
@@ -0,0 +1,210 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// messageRecord is the flat, one-row-per-message view used by the analytics
+// formats. Field order is the column order and must only ever be appended
+// to, so downstream loaders keep working.
+type messageRecord struct {
+	ID            string         `json:"id"`
+	ChannelID     string         `json:"channel_id"`
+	ChannelName   string         `json:"channel_name"`
+	UserID        string         `json:"user_id"`
+	UserName      string         `json:"user_name"`
+	Timestamp     time.Time      `json:"timestamp"`
+	ThreadTS      string         `json:"thread_ts"` // thread parent, empty outside threads
+	IsReply       bool           `json:"is_reply"`
+	Text          string         `json:"text"`       // raw Slack mrkdwn
+	TextPlain     string         `json:"text_plain"` // mentions and formatting resolved
+	ReactionCount int            `json:"reaction_count"`
+	Reactions     map[string]int `json:"reactions"` // emoji name to count
+	FileCount     int            `json:"file_count"`
+	Files         []fileRecord   `json:"files"`
+	Edited        bool           `json:"edited"`
+	EditedAt      *time.Time     `json:"edited_at"`
+	Deleted       bool           `json:"deleted"`
+}
+
+type fileRecord struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	SizeBytes int64  `json:"size_bytes"`
+	LocalPath string `json:"local_path"`
+	URL       string `json:"url"`
+	Checksum  string `json:"checksum"`
+}
+
+var csvColumns = []string{
+	"id", "channel_id", "channel_name", "user_id", "user_name", "timestamp",
+	"thread_ts", "is_reply", "text", "text_plain", "reaction_count", "reactions",
+	"file_count", "files", "edited", "edited_at", "deleted",
+}
+
+// WriteJSONL writes one JSON object per message to the file out
+func WriteJSONL(s database.Store, opts Options, out string) error {
+	return writeRecords(s, opts, out, func(w io.Writer) (func(messageRecord) error, func() error) {
+		enc := json.NewEncoder(w)
+		return func(r messageRecord) error { return enc.Encode(r) }, func() error { return nil }
+	})
+}
+
+// WriteCSV writes one row per message to the file out. Reactions are
+// written as emoji:count pairs and files as their IDs, both separated by
+// semicolons.
+func WriteCSV(s database.Store, opts Options, out string) error {
+	return writeRecords(s, opts, out, func(w io.Writer) (func(messageRecord) error, func() error) {
+		cw := csv.NewWriter(w)
+		cw.Write(csvColumns) // errors are reported by flush
+		write := func(r messageRecord) error { return cw.Write(r.csvRow()) }
+		flush := func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		return write, flush
+	})
+}
+
+// writeRecords streams every message's record to out through the writer
+// returned by newWriter
+func writeRecords(s database.Store, opts Options, out string,
+	newWriter func(w io.Writer) (write func(messageRecord) error, flush func() error)) (err error) {
+	a, err := load(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	f, err := createFile(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+
+	buf := bufio.NewWriter(f)
+	write, flush := newWriter(buf)
+
+	var count int
+	for _, ch := range a.channels {
+		for _, msg := range a.messages[ch.ID] {
+			if err := write(a.record(ch, msg)); err != nil {
+				return fmt.Errorf("failed to write message %s: %w", msg.ID, err)
+			}
+			count++
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+
+	logger.Info.Printf("Exported %d messages from %d channels to %s", count, len(a.channels), out)
+	return nil
+}
+
+func (a *archive) record(ch database.Channel, msg database.Message) messageRecord {
+	r := messageRecord{
+		ID:          msg.ID,
+		ChannelID:   ch.ID,
+		ChannelName: ch.Name,
+		UserID:      msg.UserID,
+		UserName:    a.userName(msg.UserID),
+		Timestamp:   msg.Timestamp.UTC(),
+		ThreadTS:    msg.ThreadTS.String,
+		IsReply:     isReply(msg),
+		Text:        msg.Content,
+		TextPlain:   a.format.Text(msg.Content),
+		Reactions:   make(map[string]int),
+		Files:       []fileRecord{},
+		Edited:      msg.LastEdited.Valid,
+		Deleted:     msg.IsDeleted,
+	}
+	if msg.LastEdited.Valid {
+		edited := msg.LastEdited.Time.UTC()
+		r.EditedAt = &edited
+	}
+
+	for _, reaction := range a.reactions[msg.ID] {
+		r.Reactions[reaction.Emoji]++
+		r.ReactionCount++
+	}
+	for _, f := range a.files[msg.ID] {
+		r.Files = append(r.Files, fileRecord{
+			ID:        f.ID,
+			Name:      f.FileName,
+			Type:      f.FileType,
+			SizeBytes: f.SizeBytes,
+			LocalPath: f.LocalPath,
+			URL:       f.OriginalURL,
+			Checksum:  f.Checksum,
+		})
+	}
+	r.FileCount = len(r.Files)
+
+	return r
+}
+
+// csvRow returns the record's fields in csvColumns order
+func (r messageRecord) csvRow() []string {
+	emojis := make([]string, 0, len(r.Reactions))
+	for emoji := range r.Reactions {
+		emojis = append(emojis, emoji)
+	}
+	sort.Strings(emojis)
+	reactions := make([]string, len(emojis))
+	for i, emoji := range emojis {
+		reactions[i] = emoji + ":" + strconv.Itoa(r.Reactions[emoji])
+	}
+
+	fileIDs := make([]string, len(r.Files))
+	for i, f := range r.Files {
+		fileIDs[i] = f.ID
+	}
+
+	editedAt := ""
+	if r.EditedAt != nil {
+		editedAt = r.EditedAt.Format(time.RFC3339)
+	}
+
+	return []string{
+		r.ID,
+		r.ChannelID,
+		r.ChannelName,
+		r.UserID,
+		r.UserName,
+		r.Timestamp.Format(time.RFC3339),
+		r.ThreadTS,
+		strconv.FormatBool(r.IsReply),
+		r.Text,
+		r.TextPlain,
+		strconv.Itoa(r.ReactionCount),
+		strings.Join(reactions, ";"),
+		strconv.Itoa(r.FileCount),
+		strings.Join(fileIDs, ";"),
+		strconv.FormatBool(r.Edited),
+		editedAt,
+		strconv.FormatBool(r.Deleted),
+	}
+}
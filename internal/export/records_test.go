@@ -0,0 +1,133 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+func TestWriteJSONL(t *testing.T) {
+	s := newTestStore(t)
+	out := filepath.Join(t.TempDir(), "messages.jsonl")
+
+	if err := WriteJSONL(s, Options{}, out); err != nil {
+		t.Fatalf("WriteJSONL() error = %v", err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer f.Close()
+
+	var records []messageRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r messageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Line %d is not JSON: %v", len(records)+1, err)
+		}
+		records = append(records, r)
+	}
+
+	if len(records) != 5 {
+		t.Fatalf("Wrote %d records, want 5 (deleted messages included)", len(records))
+	}
+
+	reply := records[2]
+	if !reply.IsReply || reply.ThreadTS != tsAt(0) || reply.TextPlain != "See @bob there" || reply.UserName != "Alice" {
+		t.Errorf("Reply record = %+v", reply)
+	}
+	if !records[3].Deleted {
+		t.Errorf("Record %s not marked deleted", records[3].ID)
+	}
+
+	last := records[4]
+	if !last.Edited || last.EditedAt == nil || last.ReactionCount != 2 || last.Reactions["thumbsup"] != 2 {
+		t.Errorf("Edited record = %+v, want edit time and two thumbsup", last)
+	}
+	if last.FileCount != 1 || last.Files[0].ID != "F1" || last.Files[0].LocalPath == "" {
+		t.Errorf("Edited record files = %+v, want F1", last.Files)
+	}
+	if last.ChannelName != "general" || last.Timestamp.Location() != time.UTC {
+		t.Errorf("Edited record = %+v, want general and UTC time", last)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	s := newTestStore(t)
+	out := filepath.Join(t.TempDir(), "messages.csv")
+
+	opts := Options{Filter: database.MessageFilter{
+		ChannelIDs: []string{"C1"},
+		Since:      base.Add(24 * time.Hour),
+	}}
+	if err := WriteCSV(s, opts, out); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Output is not CSV: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Wrote %d rows, want header and one message", len(rows))
+	}
+
+	for i, col := range csvColumns {
+		if rows[0][i] != col {
+			t.Fatalf("Header = %v, want %v", rows[0], csvColumns)
+		}
+	}
+
+	row := make(map[string]string)
+	for i, col := range csvColumns {
+		row[col] = rows[1][i]
+	}
+	want := map[string]string{
+		"id":             tsAt(24 * time.Hour),
+		"channel_name":   "general",
+		"user_name":      "bob",
+		"reaction_count": "2",
+		"reactions":      "thumbsup:2",
+		"files":          "F1",
+		"edited":         "true",
+		"deleted":        "false",
+		"is_reply":       "false",
+	}
+	for col, v := range want {
+		if row[col] != v {
+			t.Errorf("Column %s = %q, want %q", col, row[col], v)
+		}
+	}
+}
+
+func TestWriteCSVEmpty(t *testing.T) {
+	s := newTestStore(t)
+	out := filepath.Join(t.TempDir(), "messages.csv")
+
+	// Even with no matching messages the header is written
+	if err := WriteCSV(s, Options{Filter: database.MessageFilter{ChannelIDs: []string{"G1"}}}, out); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(data) != "id,channel_id,channel_name,user_id,user_name,timestamp,thread_ts,is_reply,text,text_plain,"+
+		"reaction_count,reactions,file_count,files,edited,edited_at,deleted\n" {
+		t.Errorf("Output = %q, want only the header", data)
+	}
+}
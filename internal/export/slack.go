@@ -0,0 +1,329 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// Types mirroring the JSON in Slack's workspace exports. Only the fields we
+// can fill from the archive are included.
+
+type slackChannel struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Created    int64        `json:"created"`
+	IsArchived bool         `json:"is_archived"`
+	IsGeneral  bool         `json:"is_general"`
+	Members    []string     `json:"members"`
+	Topic      slackPurpose `json:"topic"`
+	Purpose    slackPurpose `json:"purpose"`
+}
+
+type slackPurpose struct {
+	Value   string `json:"value"`
+	Creator string `json:"creator"`
+	LastSet int64  `json:"last_set"`
+}
+
+type slackUser struct {
+	ID       string           `json:"id"`
+	Name     string           `json:"name"`
+	RealName string           `json:"real_name,omitempty"`
+	Deleted  bool             `json:"deleted"`
+	IsBot    bool             `json:"is_bot"`
+	Profile  slackUserProfile `json:"profile"`
+}
+
+type slackUserProfile struct {
+	RealName    string `json:"real_name,omitempty"`
+	DisplayName string `json:"display_name"`
+	Name        string `json:"name,omitempty"`
+	Image72     string `json:"image_72,omitempty"`
+}
+
+type slackMessage struct {
+	Type            string            `json:"type"`
+	User            string            `json:"user"`
+	Text            string            `json:"text"`
+	TS              string            `json:"ts"`
+	UserProfile     *slackUserProfile `json:"user_profile,omitempty"`
+	ThreadTS        string            `json:"thread_ts,omitempty"`
+	ParentUserID    string            `json:"parent_user_id,omitempty"`
+	ReplyCount      int               `json:"reply_count,omitempty"`
+	ReplyUsersCount int               `json:"reply_users_count,omitempty"`
+	LatestReply     string            `json:"latest_reply,omitempty"`
+	ReplyUsers      []string          `json:"reply_users,omitempty"`
+	Replies         []slackReply      `json:"replies,omitempty"`
+	Edited          *slackEdited      `json:"edited,omitempty"`
+	Reactions       []slackReaction   `json:"reactions,omitempty"`
+	Files           []slackFile       `json:"files,omitempty"`
+}
+
+type slackReply struct {
+	User string `json:"user"`
+	TS   string `json:"ts"`
+}
+
+type slackEdited struct {
+	User string `json:"user"`
+	TS   string `json:"ts"`
+}
+
+type slackReaction struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+	Count int      `json:"count"`
+}
+
+type slackFile struct {
+	ID                 string `json:"id"`
+	Created            int64  `json:"created"`
+	Timestamp          int64  `json:"timestamp"`
+	Name               string `json:"name"`
+	Title              string `json:"title"`
+	Filetype           string `json:"filetype"`
+	Size               int64  `json:"size"`
+	URLPrivate         string `json:"url_private"`
+	URLPrivateDownload string `json:"url_private_download"`
+}
+
+// WriteSlack writes a ZIP laid out like Slack's workspace export:
+// channels.json and groups.json for public and private channels, users.json,
+// and a directory per channel holding one JSON file of messages per local
+// day. As in Slack's exports, deleted messages are left out and files are
+// referenced by URL rather than included.
+func WriteSlack(s database.Store, opts Options, out string) (err error) {
+	a, err := load(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	f, err := createFile(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+
+	zw := zip.NewWriter(f)
+
+	var public, private []slackChannel
+	for _, ch := range a.channels {
+		sc := slackChannel{
+			ID:         ch.ID,
+			Name:       ch.Name,
+			Created:    ch.CreatedAt.Unix(),
+			IsArchived: ch.IsArchived,
+			IsGeneral:  ch.Name == "general",
+			Members:    a.members(ch.ID),
+			Topic:      slackPurpose{Value: ch.Topic},
+			Purpose:    slackPurpose{Value: ch.Purpose},
+		}
+		if ch.ChannelType == "private_channel" {
+			private = append(private, sc)
+		} else {
+			public = append(public, sc)
+		}
+	}
+	if err := writeJSON(zw, "channels.json", nonNil(public)); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "groups.json", nonNil(private)); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(a.users))
+	for id := range a.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	users := make([]slackUser, 0, len(ids))
+	for _, id := range ids {
+		u := a.users[id]
+		users = append(users, slackUser{
+			ID:       u.ID,
+			Name:     u.Username,
+			RealName: u.DisplayName,
+			IsBot:    len(u.ID) > 0 && u.ID[0] == 'B',
+			Profile:  a.profile(u.ID),
+		})
+	}
+	if err := writeJSON(zw, "users.json", users); err != nil {
+		return err
+	}
+
+	var total int
+	for _, ch := range a.channels {
+		days := make(map[string][]slackMessage)
+		var order []string
+		for _, msg := range a.slackMessages(ch.ID) {
+			day := slackTime(msg.TS).Local().Format("2006-01-02")
+			if _, ok := days[day]; !ok {
+				order = append(order, day)
+			}
+			days[day] = append(days[day], msg)
+		}
+
+		for _, day := range order {
+			name := path.Join(channelDir(ch), day+".json")
+			if err := writeJSON(zw, name, days[day]); err != nil {
+				return err
+			}
+			total += len(days[day])
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish ZIP: %w", err)
+	}
+
+	logger.Info.Printf("Exported %d channels and %d messages to %s", len(a.channels), total, out)
+	return nil
+}
+
+// slackMessages converts a channel's messages, oldest first, filling in the
+// thread summaries Slack puts on parent messages
+func (a *archive) slackMessages(channelID string) []slackMessage {
+	var (
+		msgs    []database.Message
+		replies = make(map[string][]database.Message)
+		authors = make(map[string]string)
+	)
+	for _, msg := range a.messages[channelID] {
+		if msg.IsDeleted {
+			continue
+		}
+		msgs = append(msgs, msg)
+		authors[msg.ID] = msg.UserID
+		if isReply(msg) {
+			replies[msg.ThreadTS.String] = append(replies[msg.ThreadTS.String], msg)
+		}
+	}
+
+	out := make([]slackMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		profile := a.profile(msg.UserID)
+		sm := slackMessage{
+			Type:        msg.MessageType,
+			User:        msg.UserID,
+			Text:        msg.Content,
+			TS:          msg.ID,
+			UserProfile: &profile,
+			ThreadTS:    msg.ThreadTS.String,
+		}
+
+		if isReply(msg) {
+			sm.ParentUserID = authors[msg.ThreadTS.String]
+		} else if thread := replies[msg.ID]; len(thread) > 0 {
+			sm.ThreadTS = msg.ID
+			sm.ReplyCount = len(thread)
+			sm.LatestReply = thread[len(thread)-1].ID
+			for _, reply := range thread {
+				sm.Replies = append(sm.Replies, slackReply{User: reply.UserID, TS: reply.ID})
+				if !contains(sm.ReplyUsers, reply.UserID) {
+					sm.ReplyUsers = append(sm.ReplyUsers, reply.UserID)
+				}
+			}
+			sm.ReplyUsersCount = len(sm.ReplyUsers)
+		}
+
+		if msg.LastEdited.Valid {
+			sm.Edited = &slackEdited{User: msg.UserID, TS: fmt.Sprintf("%d.000000", msg.LastEdited.Time.Unix())}
+		}
+
+		byEmoji := make(map[string]int)
+		for _, r := range a.reactions[msg.ID] {
+			i, ok := byEmoji[r.Emoji]
+			if !ok {
+				i = len(sm.Reactions)
+				byEmoji[r.Emoji] = i
+				sm.Reactions = append(sm.Reactions, slackReaction{Name: r.Emoji})
+			}
+			sm.Reactions[i].Users = append(sm.Reactions[i].Users, r.UserID)
+			sm.Reactions[i].Count++
+		}
+
+		for _, f := range a.files[msg.ID] {
+			sm.Files = append(sm.Files, slackFile{
+				ID:                 f.ID,
+				Created:            f.UploadTimestamp.Unix(),
+				Timestamp:          f.UploadTimestamp.Unix(),
+				Name:               f.FileName,
+				Title:              f.FileName,
+				Filetype:           f.FileType,
+				Size:               f.SizeBytes,
+				URLPrivate:         f.OriginalURL,
+				URLPrivateDownload: f.OriginalURL,
+			})
+		}
+
+		out = append(out, sm)
+	}
+	return out
+}
+
+// members approximates channel membership with everyone who posted in it,
+// since the archive doesn't record membership
+func (a *archive) members(channelID string) []string {
+	members := []string{}
+	for _, msg := range a.messages[channelID] {
+		if !contains(members, msg.UserID) {
+			members = append(members, msg.UserID)
+		}
+	}
+	return members
+}
+
+func (a *archive) profile(userID string) slackUserProfile {
+	u := a.users[userID]
+	name := u.Username
+	if name == "" {
+		name = userID
+	}
+	return slackUserProfile{
+		RealName:    u.DisplayName,
+		DisplayName: u.DisplayName,
+		Name:        name,
+		Image72:     u.AvatarURL,
+	}
+}
+
+// isReply reports whether msg is a thread reply rather than a top-level
+// message or thread parent
+func isReply(msg database.Message) bool {
+	return msg.ThreadTS.Valid && msg.ThreadTS.String != "" && msg.ThreadTS.String != msg.ID
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// nonNil makes empty lists encode as [] rather than null
+func nonNil(channels []slackChannel) []slackChannel {
+	if channels == nil {
+		return []slackChannel{}
+	}
+	return channels
+}
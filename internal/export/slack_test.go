@@ -0,0 +1,109 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWriteSlack(t *testing.T) {
+	s := newTestStore(t)
+	out := filepath.Join(t.TempDir(), "export.zip")
+
+	if err := WriteSlack(s, Options{}, out); err != nil {
+		t.Fatalf("WriteSlack() error = %v", err)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Failed to open ZIP: %v", err)
+	}
+	defer zr.Close()
+
+	entries := make(map[string]*zip.File)
+	var names []string
+	for _, f := range zr.File {
+		entries[f.Name] = f
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	want := []string{"channels.json", "general/2024-03-01.json", "general/2024-03-02.json", "groups.json", "users.json"}
+	if len(names) != len(want) {
+		t.Fatalf("ZIP contains %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("ZIP contains %v, want %v", names, want)
+		}
+	}
+
+	read := func(name string, v interface{}) {
+		t.Helper()
+		rc, err := entries[name].Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", name, err)
+		}
+		defer rc.Close()
+		if err := json.NewDecoder(rc).Decode(v); err != nil {
+			t.Fatalf("Failed to decode %s: %v", name, err)
+		}
+	}
+
+	var channels, groups []slackChannel
+	read("channels.json", &channels)
+	read("groups.json", &groups)
+	if len(channels) != 1 || channels[0].ID != "C1" || channels[0].Topic.Value != "Company news" {
+		t.Errorf("channels.json = %+v, want general", channels)
+	}
+	if len(groups) != 1 || groups[0].ID != "G1" {
+		t.Errorf("groups.json = %+v, want secret", groups)
+	}
+
+	var users []slackUser
+	read("users.json", &users)
+	if len(users) != 2 || users[0].Name != "alice" || users[0].Profile.Image72 == "" {
+		t.Errorf("users.json = %+v, want alice and bob", users)
+	}
+
+	var day1 []slackMessage
+	read("general/2024-03-01.json", &day1)
+	if len(day1) != 3 {
+		t.Fatalf("2024-03-01.json has %d messages, want 3 (deleted message left out)", len(day1))
+	}
+	parent := day1[0]
+	if parent.ReplyCount != 2 || parent.LatestReply != tsAt(2*time.Minute) || parent.ReplyUsersCount != 2 {
+		t.Errorf("Thread parent = %+v, want 2 replies from 2 users", parent)
+	}
+	if reply := day1[1]; reply.ThreadTS != tsAt(0) || reply.ParentUserID != "U1" {
+		t.Errorf("Reply = %+v, want thread_ts and parent_user_id set", reply)
+	}
+
+	var day2 []slackMessage
+	read("general/2024-03-02.json", &day2)
+	if len(day2) != 1 {
+		t.Fatalf("2024-03-02.json has %d messages, want 1", len(day2))
+	}
+	msg := day2[0]
+	if msg.Edited == nil {
+		t.Error("Edited message has no edited field")
+	}
+	if len(msg.Reactions) != 1 || msg.Reactions[0].Count != 2 {
+		t.Errorf("Reactions = %+v, want one thumbsup from two users", msg.Reactions)
+	}
+	if len(msg.Files) != 1 || msg.Files[0].Name != "notes.txt" {
+		t.Errorf("Files = %+v, want notes.txt", msg.Files)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if _, err := Lookup("slack"); err != nil {
+		t.Errorf("Lookup(slack) error = %v", err)
+	}
+	if _, err := Lookup("docx"); err == nil {
+		t.Error("Lookup(docx) should fail")
+	}
+}
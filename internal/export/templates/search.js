@@ -0,0 +1,45 @@
+// Client-side search over SEARCH_INDEX, loaded from search-index.js. Every
+// word must appear in the message, author or channel name. The index is
+// sorted oldest first, so it is walked backwards to show recent matches first.
+(function () {
+  var input = document.getElementById("search");
+  var results = document.getElementById("results");
+  var channels = document.getElementById("channels");
+  var maxResults = 200;
+
+  function search() {
+    var terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+    results.innerHTML = "";
+    channels.hidden = terms.length > 0;
+    if (terms.length === 0) {
+      return;
+    }
+
+    var found = 0;
+    for (var i = SEARCH_INDEX.length - 1; i >= 0 && found < maxResults; i--) {
+      var entry = SEARCH_INDEX[i];
+      var haystack = (entry.t + " " + entry.a + " " + entry.c).toLowerCase();
+      if (!terms.every(function (term) { return haystack.indexOf(term) >= 0; })) {
+        continue;
+      }
+      found++;
+
+      var li = document.createElement("li");
+      var link = document.createElement("a");
+      link.href = entry.h;
+      link.textContent = "#" + entry.c + "  " + entry.a + "  " + entry.d;
+      var text = document.createElement("div");
+      text.className = "text";
+      text.textContent = entry.t;
+      li.appendChild(link);
+      li.appendChild(text);
+      results.appendChild(li);
+    }
+
+    if (found === 0) {
+      results.innerHTML = "<li>No messages found</li>";
+    }
+  }
+
+  input.addEventListener("input", search);
+})();
@@ -0,0 +1,199 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/format"
+	"backup_slack/internal/logger"
+)
+
+// transcriptStyle selects between Markdown and plain-text transcripts
+type transcriptStyle struct {
+	markdown bool
+	ext      string
+}
+
+var (
+	markdownTranscript = transcriptStyle{markdown: true, ext: ".md"}
+	textTranscript     = transcriptStyle{markdown: false, ext: ".txt"}
+)
+
+// WriteMarkdown writes a Markdown transcript per channel per month to the
+// directory out, e.g. out/general/2024-03.md
+func WriteMarkdown(s database.Store, opts Options, out string) error {
+	return writeTranscripts(s, opts, out, markdownTranscript)
+}
+
+// WriteText writes a plain-text transcript per channel per month to the
+// directory out, e.g. out/general/2024-03.txt
+func WriteText(s database.Store, opts Options, out string) error {
+	return writeTranscripts(s, opts, out, textTranscript)
+}
+
+func writeTranscripts(s database.Store, opts Options, out string, style transcriptStyle) error {
+	a, err := load(s, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	var written int
+	for _, ch := range a.channels {
+		top, replies := a.threads(ch.ID)
+
+		months := make(map[string][]database.Message)
+		var order []string
+		for _, msg := range top {
+			month := msg.Timestamp.Local().Format("2006-01")
+			if _, ok := months[month]; !ok {
+				order = append(order, month)
+			}
+			months[month] = append(months[month], msg)
+		}
+
+		for _, month := range order {
+			var b strings.Builder
+			a.writeTranscript(&b, ch, months[month], replies, style)
+
+			path := filepath.Join(out, channelDir(ch), month+style.ext)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+			if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			written++
+		}
+	}
+
+	logger.Info.Printf("Exported %d transcripts for %d channels to %s", written, len(a.channels), out)
+	return nil
+}
+
+// writeTranscript writes one month of a channel, with a heading per day and
+// replies indented under their parent
+func (a *archive) writeTranscript(b *strings.Builder, ch database.Channel, messages []database.Message,
+	replies map[string][]database.Message, style transcriptStyle) {
+	title := "#" + ch.Name
+	if ch.Name == "" {
+		title = ch.ID
+	}
+	month := messages[0].Timestamp.Local().Format("January 2006")
+
+	if style.markdown {
+		fmt.Fprintf(b, "# %s, %s\n", title, month)
+	} else {
+		fmt.Fprintf(b, "%s, %s\n", title, month)
+	}
+
+	day := ""
+	for _, msg := range messages {
+		if d := msg.Timestamp.Local().Format("2006-01-02 (Monday)"); d != day {
+			day = d
+			if style.markdown {
+				fmt.Fprintf(b, "\n## %s\n", day)
+			} else {
+				fmt.Fprintf(b, "\n--- %s ---\n", day)
+			}
+		}
+
+		b.WriteString("\n")
+		a.writeTranscriptMessage(b, msg, "", style)
+		for _, reply := range replies[msg.ID] {
+			if style.markdown {
+				b.WriteString(">\n")
+				a.writeTranscriptMessage(b, reply, "> ", style)
+			} else {
+				a.writeTranscriptMessage(b, reply, "    ", style)
+			}
+		}
+	}
+}
+
+func (a *archive) writeTranscriptMessage(b *strings.Builder, msg database.Message, indent string, style transcriptStyle) {
+	var notes []string
+	if isReply(msg) && indent == "" {
+		notes = append(notes, "reply in thread")
+	}
+	if msg.LastEdited.Valid {
+		notes = append(notes, "edited")
+	}
+	if msg.IsDeleted {
+		notes = append(notes, "deleted")
+	}
+	suffix := ""
+	if len(notes) > 0 {
+		suffix = " (" + strings.Join(notes, ", ") + ")"
+	}
+
+	name := a.userName(msg.UserID)
+	clock := msg.Timestamp.Local().Format("15:04")
+	text := a.format.Text(msg.Content)
+	if style.markdown {
+		text = a.format.Markdown(msg.Content)
+	}
+	text = strings.TrimSuffix(text, "\n")
+
+	var lines []string
+	if style.markdown {
+		lines = append(lines, fmt.Sprintf("**%s** %s%s", name, clock, suffix))
+		// The formatter already ends lines with Markdown breaks
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimSuffix(line, "  "))
+		}
+	} else {
+		// Continuation lines are indented to line up with the first
+		textLines := strings.Split(text, "\n")
+		prefix := fmt.Sprintf("[%s] %s%s: ", clock, name, suffix)
+		lines = append(lines, prefix+textLines[0])
+		for _, line := range textLines[1:] {
+			lines = append(lines, strings.Repeat(" ", len(prefix))+line)
+		}
+	}
+
+	for _, f := range a.files[msg.ID] {
+		if style.markdown {
+			lines = append(lines, fmt.Sprintf("📎 [%s](%s)", f.FileName, f.OriginalURL))
+		} else {
+			lines = append(lines, fmt.Sprintf("  [file: %s %s]", f.FileName, f.OriginalURL))
+		}
+	}
+
+	if reactions := a.reactionSummary(msg.ID); reactions != "" {
+		if style.markdown {
+			lines = append(lines, "_"+reactions+"_")
+		} else {
+			lines = append(lines, "  "+reactions)
+		}
+	}
+
+	// Markdown needs two trailing spaces for a line break inside a paragraph
+	sep := "\n" + indent
+	if style.markdown {
+		sep = "  " + sep
+	}
+	b.WriteString(indent + strings.Join(lines, sep) + "\n")
+}
+
+// reactionSummary returns e.g. "👍 2  🎉 1"
+func (a *archive) reactionSummary(messageID string) string {
+	var (
+		order  []string
+		counts = make(map[string]int)
+	)
+	for _, r := range a.reactions[messageID] {
+		if counts[r.Emoji] == 0 {
+			order = append(order, r.Emoji)
+		}
+		counts[r.Emoji]++
+	}
+
+	parts := make([]string, len(order))
+	for i, emoji := range order {
+		parts[i] = fmt.Sprintf("%s %d", format.EmojiOrShortcode(emoji), counts[emoji])
+	}
+	return strings.Join(parts, "  ")
+}
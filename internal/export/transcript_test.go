@@ -0,0 +1,72 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backup_slack/internal/database"
+)
+
+func TestWriteTranscripts(t *testing.T) {
+	s := newTestStore(t)
+
+	tests := []struct {
+		name  string
+		write func(s database.Store, opts Options, out string) error
+		file  string
+		want  []string
+	}{
+		{
+			name:  "markdown",
+			write: WriteMarkdown,
+			file:  "general/2024-03.md",
+			want: []string{
+				"# #general, March 2024\n",
+				"## 2024-03-01 (Friday)\n",
+				"**Alice** 12:00  \nLunch?\n",
+				">\n> **bob** 12:01  \n> Sure, **pizza**\n",
+				"> **Alice** 12:02  \n> See @bob there\n",
+				"**bob** 12:03 (deleted)  \noops\n",
+				"## 2024-03-02 (Saturday)\n",
+				"**bob** 12:00 (edited)  \nNotes attached  \n📎 [notes.txt](https://files.slack.com/files-pri/T1-F1/notes.txt)  \n_👍 2_\n",
+			},
+		},
+		{
+			name:  "text",
+			write: WriteText,
+			file:  "general/2024-03.txt",
+			want: []string{
+				"#general, March 2024\n",
+				"--- 2024-03-01 (Friday) ---\n",
+				"[12:00] Alice: Lunch?\n    [12:01] bob: Sure, pizza\n    [12:02] Alice: See @bob there\n",
+				"[12:00] bob (edited): Notes attached\n  [file: notes.txt https://files.slack.com/files-pri/T1-F1/notes.txt]\n  👍 2\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			if err := tt.write(s, Options{}, out); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(out, tt.file))
+			if err != nil {
+				t.Fatalf("Failed to read transcript: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("Transcript missing %q\n\n%s", want, data)
+				}
+			}
+
+			// The private channel has no messages, so no transcript
+			if _, err := os.Stat(filepath.Join(out, "secret")); !os.IsNotExist(err) {
+				t.Errorf("Empty channel got a transcript directory: %v", err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package files
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -77,6 +78,51 @@ func (fs *FileStorage) CheckDiskSpace(requiredBytes int64) error {
 	return nil
 }
 
+// DiskUsage returns the bytes available to unprivileged users and the total
+// size of the filesystem holding path
+func DiskUsage(path string) (available, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, fmt.Errorf("failed to check disk space: %w", err)
+	}
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
+
+// DirSize returns the bytes taken by the files under path, counting hard
+// links to the same file, as duplicates are stored, only once. A path that
+// doesn't exist yet is empty.
+func DirSize(path string) (int64, error) {
+	seen := make(map[uint64]bool)
+	var size int64
+	err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			if seen[st.Ino] {
+				return nil
+			}
+			seen[st.Ino] = true
+		}
+		size += info.Size()
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) && size == 0 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure storage: %w", err)
+	}
+	return size, nil
+}
+
 // FileExists checks if a file exists at the given path
 func (fs *FileStorage) FileExists(path string) bool {
 	_, err := os.Stat(path)
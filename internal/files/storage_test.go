@@ -150,3 +150,33 @@ func TestIsImageType(t *testing.T) {
 		})
 	}
 }
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "C1", "2024"), 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	first := filepath.Join(dir, "C1", "2024", "F1.png")
+	if err := os.WriteFile(first, make([]byte, 300), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "C1", "F2.txt"), make([]byte, 50), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	// A duplicate stored as a hard link takes no extra space
+	if err := os.Link(first, filepath.Join(dir, "C1", "F3.png")); err != nil {
+		t.Fatalf("Failed to link file: %v", err)
+	}
+
+	size, err := DirSize(dir)
+	if err != nil {
+		t.Fatalf("DirSize() error = %v", err)
+	}
+	if size != 350 {
+		t.Errorf("DirSize() = %d, want 350", size)
+	}
+
+	if size, err := DirSize(filepath.Join(dir, "missing")); err != nil || size != 0 {
+		t.Errorf("DirSize() of a missing directory = %d, %v, want 0", size, err)
+	}
+}
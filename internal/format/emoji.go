@@ -0,0 +1,89 @@
+package format
+
+import "strings"
+
+// emoji maps the most common Slack shortcodes to Unicode. Custom workspace
+// emoji and anything missing here are left as :shortcode:.
+var emoji = map[string]string{
+	"+1": "👍", "thumbsup": "👍", "-1": "👎", "thumbsdown": "👎",
+	"smile": "😄", "smiley": "😃", "grinning": "😀", "grin": "😁", "joy": "😂",
+	"laughing": "😆", "satisfied": "😆", "sweat_smile": "😅", "rolling_on_the_floor_laughing": "🤣",
+	"slightly_smiling_face": "🙂", "upside_down_face": "🙃", "wink": "😉", "blush": "😊",
+	"innocent": "😇", "heart_eyes": "😍", "kissing_heart": "😘", "yum": "😋",
+	"stuck_out_tongue": "😛", "stuck_out_tongue_winking_eye": "😜", "sunglasses": "😎",
+	"nerd_face": "🤓", "thinking_face": "🤔", "face_with_raised_eyebrow": "🤨",
+	"neutral_face": "😐", "expressionless": "😑", "no_mouth": "😶", "smirk": "😏",
+	"unamused": "😒", "face_with_rolling_eyes": "🙄", "grimacing": "😬", "relieved": "😌",
+	"pensive": "😔", "sleepy": "😪", "sleeping": "😴", "mask": "😷", "face_palm": "🤦",
+	"facepalm": "🤦", "shrug": "🤷", "exploding_head": "🤯", "partying_face": "🥳",
+	"confused": "😕", "worried": "😟", "slightly_frowning_face": "🙁", "open_mouth": "😮",
+	"hushed": "😯", "astonished": "😲", "flushed": "😳", "pleading_face": "🥺",
+	"cry": "😢", "sob": "😭", "scream": "😱", "confounded": "😖", "persevere": "😣",
+	"disappointed": "😞", "sweat": "😓", "weary": "😩", "tired_face": "😫", "yawning_face": "🥱",
+	"triumph": "😤", "rage": "😡", "angry": "😠", "skull": "💀", "poop": "💩", "hankey": "💩",
+	"clown_face": "🤡", "ghost": "👻", "alien": "👽", "robot_face": "🤖", "see_no_evil": "🙈",
+	"hear_no_evil": "🙉", "speak_no_evil": "🙊", "wave": "👋", "raised_hand": "✋",
+	"ok_hand": "👌", "v": "✌️", "crossed_fingers": "🤞", "point_up": "☝️", "point_down": "👇",
+	"point_left": "👈", "point_right": "👉", "fist": "✊", "punch": "👊", "clap": "👏",
+	"raised_hands": "🙌", "open_hands": "👐", "pray": "🙏", "handshake": "🤝", "muscle": "💪",
+	"eyes": "👀", "eye": "👁️", "brain": "🧠", "heart": "❤️", "orange_heart": "🧡",
+	"yellow_heart": "💛", "green_heart": "💚", "blue_heart": "💙", "purple_heart": "💜",
+	"black_heart": "🖤", "broken_heart": "💔", "sparkling_heart": "💖", "100": "💯",
+	"fire": "🔥", "sparkles": "✨", "star": "⭐", "star2": "🌟", "boom": "💥", "zap": "⚡",
+	"tada": "🎉", "confetti_ball": "🎊", "balloon": "🎈", "gift": "🎁", "trophy": "🏆",
+	"medal": "🏅", "rocket": "🚀", "airplane": "✈️", "car": "🚗", "bike": "🚲",
+	"white_check_mark": "✅", "heavy_check_mark": "✔️", "ballot_box_with_check": "☑️",
+	"x": "❌", "negative_squared_cross_mark": "❎", "heavy_multiplication_x": "✖️",
+	"warning": "⚠️", "no_entry": "⛔", "no_entry_sign": "🚫", "question": "❓",
+	"grey_question": "❔", "exclamation": "❗", "bangbang": "‼️", "interrobang": "⁉️",
+	"heavy_plus_sign": "➕", "heavy_minus_sign": "➖", "arrow_up": "⬆️", "arrow_down": "⬇️",
+	"arrow_left": "⬅️", "arrow_right": "➡️", "arrows_counterclockwise": "🔄", "repeat": "🔁",
+	"red_circle": "🔴", "large_blue_circle": "🔵", "large_green_circle": "🟢",
+	"large_yellow_circle": "🟡", "white_circle": "⚪", "black_circle": "⚫",
+	"rotating_light": "🚨", "bell": "🔔", "mega": "📣", "loudspeaker": "📢", "bulb": "💡",
+	"memo": "📝", "pencil": "📝", "pencil2": "✏️", "pushpin": "📌", "paperclip": "📎",
+	"link": "🔗", "lock": "🔒", "unlock": "🔓", "key": "🔑", "hammer": "🔨",
+	"wrench": "🔧", "gear": "⚙️", "hammer_and_wrench": "🛠️", "mag": "🔍", "bug": "🐛",
+	"computer": "💻", "desktop_computer": "🖥️", "keyboard": "⌨️", "iphone": "📱",
+	"calendar": "📆", "date": "📅", "clock": "🕒", "hourglass": "⌛", "alarm_clock": "⏰",
+	"stopwatch": "⏱️", "chart_with_upwards_trend": "📈", "chart_with_downwards_trend": "📉",
+	"bar_chart": "📊", "clipboard": "📋", "books": "📚", "book": "📖", "email": "📧",
+	"envelope": "✉️", "inbox_tray": "📥", "outbox_tray": "📤", "package": "📦",
+	"moneybag": "💰", "dollar": "💵", "credit_card": "💳", "coffee": "☕", "tea": "🍵",
+	"beer": "🍺", "beers": "🍻", "wine_glass": "🍷", "pizza": "🍕", "hamburger": "🍔",
+	"taco": "🌮", "cake": "🍰", "birthday": "🎂", "cookie": "🍪", "doughnut": "🍩",
+	"apple": "🍎", "avocado": "🥑", "popcorn": "🍿", "sunny": "☀️", "cloud": "☁️",
+	"umbrella": "☔", "snowflake": "❄️", "rainbow": "🌈", "ocean": "🌊", "earth_americas": "🌎",
+	"dog": "🐶", "cat": "🐱", "mouse": "🐭", "rabbit": "🐰", "fox_face": "🦊", "bear": "🐻",
+	"panda_face": "🐼", "unicorn_face": "🦄", "monkey_face": "🐵", "chicken": "🐔",
+	"penguin": "🐧", "bird": "🐦", "turtle": "🐢", "snake": "🐍", "octopus": "🐙",
+	"fish": "🐟", "whale": "🐳", "bee": "🐝", "seedling": "🌱", "evergreen_tree": "🌲",
+	"deciduous_tree": "🌳", "cactus": "🌵", "four_leaf_clover": "🍀", "rose": "🌹",
+	"sunflower": "🌻", "tulip": "🌷", "house": "🏠", "office": "🏢", "construction": "🚧",
+	"checkered_flag": "🏁", "triangular_flag_on_post": "🚩", "crown": "👑", "gem": "💎",
+	"musical_note": "🎵", "notes": "🎶", "headphones": "🎧", "video_game": "🎮",
+	"dart": "🎯", "game_die": "🎲", "soccer": "⚽", "basketball": "🏀", "football": "🏈",
+	"raising_hand": "🙋", "man-shrugging": "🤷‍♂️", "woman-shrugging": "🤷‍♀️",
+	"heavy_heart_exclamation_mark_ornament": "❣️",
+	"ok":                                    "🆗", "new": "🆕", "free": "🆓", "cool": "🆒", "sos": "🆘", "on": "🔛",
+	"speech_balloon": "💬", "thought_balloon": "💭", "zzz": "💤", "dash": "💨",
+	"sweat_drops": "💦", "droplet": "💧", "thumbs_up": "👍", "thumbs_down": "👎",
+}
+
+// Emoji returns the Unicode emoji for a shortcode such as "tada" or
+// ":tada:". Skin tone variants like "+1::skin-tone-3" map to the base emoji.
+func Emoji(shortcode string) (string, bool) {
+	name := strings.Trim(shortcode, ":")
+	name, _, _ = strings.Cut(name, "::")
+	e, ok := emoji[name]
+	return e, ok
+}
+
+// EmojiOrShortcode returns the Unicode emoji for a shortcode, falling back
+// to :shortcode: for custom emoji
+func EmojiOrShortcode(shortcode string) string {
+	if e, ok := Emoji(shortcode); ok {
+		return e
+	}
+	return ":" + strings.Trim(shortcode, ":") + ":"
+}
@@ -0,0 +1,223 @@
+// Package format renders Slack message text (mrkdwn) as plain text, Markdown
+// or HTML, resolving user and channel mentions to names
+package format
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// Resolver looks up the names shown for user and channel mentions
+type Resolver interface {
+	UserName(id string) (string, bool)
+	ChannelName(id string) (string, bool)
+}
+
+// Names is a Resolver backed by maps from ID to name
+type Names struct {
+	Users    map[string]string
+	Channels map[string]string
+}
+
+// UserName implements Resolver
+func (n Names) UserName(id string) (string, bool) {
+	name, ok := n.Users[id]
+	return name, ok && name != ""
+}
+
+// ChannelName implements Resolver
+func (n Names) ChannelName(id string) (string, bool) {
+	name, ok := n.Channels[id]
+	return name, ok && name != ""
+}
+
+// Formatter converts message text using a Resolver for mentions
+type Formatter struct {
+	names Resolver
+}
+
+// New returns a Formatter. A nil resolver leaves mentions as their label or
+// ID.
+func New(names Resolver) *Formatter {
+	if names == nil {
+		names = Names{}
+	}
+	return &Formatter{names: names}
+}
+
+// Text returns readable plain text: mentions become @name and #channel,
+// formatting markers are dropped, links become "label (url)" and emoji
+// shortcodes become emoji
+func (f *Formatter) Text(s string) string {
+	var b strings.Builder
+	f.text(&b, parse(s))
+	return b.String()
+}
+
+// Markdown returns the text as CommonMark
+func (f *Formatter) Markdown(s string) string {
+	var b strings.Builder
+	f.markdown(&b, parse(s))
+	return b.String()
+}
+
+// HTML returns the text as an HTML fragment safe to embed in a page
+func (f *Formatter) HTML(s string) template.HTML {
+	var b strings.Builder
+	f.html(&b, parse(s))
+	return template.HTML(b.String())
+}
+
+func (f *Formatter) text(b *strings.Builder, nodes []node) {
+	for _, n := range nodes {
+		switch n.kind {
+		case boldNode, italicNode, strikeNode:
+			f.text(b, n.children)
+		case quoteNode:
+			var inner strings.Builder
+			f.text(&inner, n.children)
+			writeQuoted(b, inner.String())
+		case linkNode:
+			b.WriteString(n.text)
+			if n.text != n.url && n.text != strings.TrimPrefix(n.url, "mailto:") {
+				b.WriteString(" (" + n.url + ")")
+			}
+		case breakNode:
+			b.WriteString("\n")
+		case preNode:
+			b.WriteString(n.text + "\n")
+		default:
+			b.WriteString(f.label(n))
+		}
+	}
+}
+
+func (f *Formatter) markdown(b *strings.Builder, nodes []node) {
+	for _, n := range nodes {
+		switch n.kind {
+		case textNode:
+			b.WriteString(escapeMarkdown(n.text))
+		case boldNode:
+			b.WriteString("**")
+			f.markdown(b, n.children)
+			b.WriteString("**")
+		case italicNode:
+			b.WriteString("_")
+			f.markdown(b, n.children)
+			b.WriteString("_")
+		case strikeNode:
+			b.WriteString("~~")
+			f.markdown(b, n.children)
+			b.WriteString("~~")
+		case codeNode:
+			fence := "`"
+			if strings.Contains(n.text, "`") {
+				fence = "`` "
+			}
+			b.WriteString(fence + n.text + reverse(fence))
+		case preNode:
+			b.WriteString("```\n" + n.text + "\n```\n")
+		case quoteNode:
+			var inner strings.Builder
+			f.markdown(&inner, n.children)
+			writeQuoted(b, inner.String())
+		case linkNode:
+			if n.text == n.url {
+				b.WriteString("<" + n.url + ">")
+			} else {
+				b.WriteString("[" + escapeMarkdown(n.text) + "](" + n.url + ")")
+			}
+		case breakNode:
+			// Two trailing spaces keep the break inside a paragraph
+			b.WriteString("  \n")
+		default:
+			b.WriteString(escapeMarkdown(f.label(n)))
+		}
+	}
+}
+
+func (f *Formatter) html(b *strings.Builder, nodes []node) {
+	for _, n := range nodes {
+		switch n.kind {
+		case textNode:
+			b.WriteString(html.EscapeString(n.text))
+		case boldNode, italicNode, strikeNode:
+			tag := map[nodeKind]string{boldNode: "strong", italicNode: "em", strikeNode: "del"}[n.kind]
+			b.WriteString("<" + tag + ">")
+			f.html(b, n.children)
+			b.WriteString("</" + tag + ">")
+		case codeNode:
+			b.WriteString("<code>" + html.EscapeString(n.text) + "</code>")
+		case preNode:
+			b.WriteString("<pre>" + html.EscapeString(n.text) + "</pre>")
+		case quoteNode:
+			b.WriteString("<blockquote>")
+			f.html(b, n.children)
+			b.WriteString("</blockquote>")
+		case linkNode:
+			if !safeURL(n.url) {
+				b.WriteString(html.EscapeString(n.text))
+				continue
+			}
+			b.WriteString(`<a href="` + html.EscapeString(n.url) + `" rel="noopener noreferrer">` +
+				html.EscapeString(n.text) + "</a>")
+		case breakNode:
+			b.WriteString("<br>")
+		default:
+			b.WriteString(`<span class="mention">` + html.EscapeString(f.label(n)) + "</span>")
+		}
+	}
+}
+
+// label returns the display form of text and mention nodes
+func (f *Formatter) label(n node) string {
+	switch n.kind {
+	case userNode:
+		if name, ok := f.names.UserName(n.id); ok {
+			return "@" + name
+		}
+		if n.text != "" {
+			return "@" + n.text
+		}
+		return "@" + n.id
+	case channelNode:
+		if name, ok := f.names.ChannelName(n.id); ok {
+			return "#" + name
+		}
+		if n.text != "" {
+			return "#" + n.text
+		}
+		return "#" + n.id
+	}
+	return n.text
+}
+
+func writeQuoted(b *strings.Builder, s string) {
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		b.WriteString("> " + line + "\n")
+	}
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`, "[", `\[`, "]", `\]`, "<", `\<`,
+)
+
+// escapeMarkdown stops plain text from being read as Markdown syntax
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func safeURL(u string) bool {
+	lower := strings.ToLower(u)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(lower, "mailto:")
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
@@ -0,0 +1,174 @@
+package format
+
+import (
+	"testing"
+)
+
+var names = Names{
+	Users:    map[string]string{"U1": "alice", "U2": "bob_smith"},
+	Channels: map[string]string{"C1": "general"},
+}
+
+func TestFormatter(t *testing.T) {
+	f := New(names)
+
+	tests := []struct {
+		name     string
+		in       string
+		text     string
+		markdown string
+		html     string
+	}{
+		{
+			name:     "user mention",
+			in:       "ping <@U1>",
+			text:     "ping @alice",
+			markdown: "ping @alice",
+			html:     `ping <span class="mention">@alice</span>`,
+		},
+		{
+			name:     "unknown user falls back to label then ID",
+			in:       "<@U9|carol> <@U8>",
+			text:     "@carol @U8",
+			markdown: "@carol @U8",
+			html:     `<span class="mention">@carol</span> <span class="mention">@U8</span>`,
+		},
+		{
+			name:     "channel links",
+			in:       "see <#C1|old-name> and <#C9>",
+			text:     "see #general and #C9",
+			markdown: "see #general and #C9",
+			html:     `see <span class="mention">#general</span> and <span class="mention">#C9</span>`,
+		},
+		{
+			name:     "special mentions",
+			in:       "<!here> <!channel> <!subteam^S1|@oncall>",
+			text:     "@here @channel @oncall",
+			markdown: "@here @channel @oncall",
+			html:     `<span class="mention">@here</span> <span class="mention">@channel</span> <span class="mention">@oncall</span>`,
+		},
+		{
+			name:     "date falls back to label",
+			in:       "due <!date^1700000000^{date}|Nov 14>",
+			text:     "due Nov 14",
+			markdown: "due Nov 14",
+			html:     "due Nov 14",
+		},
+		{
+			name:     "links",
+			in:       "<https://example.com|docs> <https://example.com> <mailto:a@example.com|a@example.com>",
+			text:     "docs (https://example.com) https://example.com a@example.com",
+			markdown: "[docs](https://example.com) <https://example.com> [a@example.com](mailto:a@example.com)",
+			html: `<a href="https://example.com" rel="noopener noreferrer">docs</a> ` +
+				`<a href="https://example.com" rel="noopener noreferrer">https://example.com</a> ` +
+				`<a href="mailto:a@example.com" rel="noopener noreferrer">a@example.com</a>`,
+		},
+		{
+			name:     "unsafe link",
+			in:       "<javascript:alert(1)|click>",
+			text:     "click (javascript:alert(1))",
+			markdown: "[click](javascript:alert(1))",
+			html:     "click",
+		},
+		{
+			name:     "escapes",
+			in:       "a &lt;b&gt; &amp; c",
+			text:     "a <b> & c",
+			markdown: `a \<b> & c`,
+			html:     "a &lt;b&gt; &amp; c",
+		},
+		{
+			name:     "formatting",
+			in:       "*bold* _italic_ ~gone~",
+			text:     "bold italic gone",
+			markdown: "**bold** _italic_ ~~gone~~",
+			html:     "<strong>bold</strong> <em>italic</em> <del>gone</del>",
+		},
+		{
+			name:     "nested formatting",
+			in:       "*very _important_*",
+			text:     "very important",
+			markdown: "**very _important_**",
+			html:     "<strong>very <em>important</em></strong>",
+		},
+		{
+			name:     "markers inside words are literal",
+			in:       "snake_case_name 2*3*4",
+			text:     "snake_case_name 2*3*4",
+			markdown: `snake\_case\_name 2\*3\*4`,
+			html:     "snake_case_name 2*3*4",
+		},
+		{
+			name:     "code is not formatted",
+			in:       "run `rm *.tmp` now",
+			text:     "run rm *.tmp now",
+			markdown: "run `rm *.tmp` now",
+			html:     "run <code>rm *.tmp</code> now",
+		},
+		{
+			name:     "pre block",
+			in:       "before\n```if a &lt; b {\n  *x*\n}```\nafter",
+			text:     "before\nif a < b {\n  *x*\n}\nafter",
+			markdown: "before  \n```\nif a < b {\n  *x*\n}\n```\nafter",
+			html:     "before<br><pre>if a &lt; b {\n  *x*\n}</pre>after",
+		},
+		{
+			name:     "quote",
+			in:       "&gt; quoted *line*\n&gt; second\nreply",
+			text:     "> quoted line\n> second\nreply",
+			markdown: "> quoted **line**  \n> second\nreply",
+			html:     "<blockquote>quoted <strong>line</strong><br>second</blockquote>reply",
+		},
+		{
+			name:     "emoji",
+			in:       "nice :tada: :+1::skin-tone-3: :custom: 10:30:00",
+			text:     "nice 🎉 👍 :custom: 10:30:00",
+			markdown: "nice 🎉 👍 :custom: 10:30:00",
+			html:     "nice 🎉 👍 :custom: 10:30:00",
+		},
+		{
+			name:     "line breaks",
+			in:       "one\ntwo",
+			text:     "one\ntwo",
+			markdown: "one  \ntwo",
+			html:     "one<br>two",
+		},
+		{
+			name:     "mention names are escaped",
+			in:       "<@U2>",
+			text:     "@bob_smith",
+			markdown: `@bob\_smith`,
+			html:     `<span class="mention">@bob_smith</span>`,
+		},
+		{
+			name:     "unterminated markup is literal",
+			in:       "a < b and *c",
+			text:     "a < b and *c",
+			markdown: `a \< b and \*c`,
+			html:     "a &lt; b and *c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Text(tt.in); got != tt.text {
+				t.Errorf("Text() = %q, want %q", got, tt.text)
+			}
+			if got := f.Markdown(tt.in); got != tt.markdown {
+				t.Errorf("Markdown() = %q, want %q", got, tt.markdown)
+			}
+			if got := string(f.HTML(tt.in)); got != tt.html {
+				t.Errorf("HTML() = %q, want %q", got, tt.html)
+			}
+		})
+	}
+}
+
+func TestEmoji(t *testing.T) {
+	if got := EmojiOrShortcode("thumbsup"); got != "👍" {
+		t.Errorf("EmojiOrShortcode(thumbsup) = %q", got)
+	}
+	if got := EmojiOrShortcode(":partyparrot:"); got != ":partyparrot:" {
+		t.Errorf("EmojiOrShortcode(:partyparrot:) = %q", got)
+	}
+}
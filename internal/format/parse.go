@@ -0,0 +1,252 @@
+package format
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type nodeKind int
+
+const (
+	textNode nodeKind = iota
+	boldNode
+	italicNode
+	strikeNode
+	codeNode
+	preNode
+	quoteNode
+	linkNode
+	userNode    // <@U123>, resolved when rendering
+	channelNode // <#C123|name>, resolved when rendering
+	mentionNode // @here, @channel, user groups
+	breakNode
+)
+
+// node is a piece of parsed mrkdwn. Formatting and quote nodes hold their
+// content in children; the rest carry text, already unescaped.
+type node struct {
+	kind     nodeKind
+	text     string // text, code, link or mention label
+	url      string // link target
+	id       string // user or channel ID
+	children []node
+}
+
+// parse splits Slack mrkdwn into nodes: ```pre``` blocks first, since they
+// may span lines, then quoted lines, then inline formatting
+func parse(s string) []node {
+	var nodes []node
+	for {
+		start := strings.Index(s, "```")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start+3:], "```")
+		if end < 0 {
+			break
+		}
+
+		nodes = append(nodes, parseLines(s[:start])...)
+		code := strings.Trim(s[start+3:start+3+end], "\n")
+		nodes = append(nodes, node{kind: preNode, text: unescape(code)})
+		s = strings.TrimPrefix(s[start+3+end+3:], "\n")
+	}
+	return append(nodes, parseLines(s)...)
+}
+
+// parseLines groups consecutive quoted lines into quote nodes and parses the
+// rest inline, separating lines with breaks
+func parseLines(s string) []node {
+	if s == "" {
+		return nil
+	}
+
+	var (
+		nodes  []node
+		quoted []string
+	)
+	flushQuote := func() {
+		if quoted != nil {
+			nodes = append(nodes, node{kind: quoteNode, children: parseLines(strings.Join(quoted, "\n"))})
+			quoted = nil
+		}
+	}
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		// Slack stores > escaped
+		if rest, ok := cutQuote(line); ok {
+			quoted = append(quoted, rest)
+			continue
+		}
+		flushQuote()
+		nodes = append(nodes, parseInline(line)...)
+		if i < len(lines)-1 {
+			nodes = append(nodes, node{kind: breakNode})
+		}
+	}
+	flushQuote()
+	return nodes
+}
+
+func cutQuote(line string) (string, bool) {
+	for _, prefix := range []string{"&gt; ", "&gt;", "> "} {
+		if strings.HasPrefix(line, prefix) {
+			return line[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// parseInline parses a single line: `code`, <entities>, *bold*, _italic_,
+// ~strike~ and :emoji:
+func parseInline(s string) []node {
+	var (
+		nodes []node
+		text  strings.Builder
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, node{kind: textNode, text: unescape(text.String())})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				flush()
+				nodes = append(nodes, node{kind: codeNode, text: unescape(s[i+1 : i+1+end])})
+				i += end + 2
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(s[i+1:], '>'); end > 0 {
+				flush()
+				nodes = append(nodes, parseEntity(s[i+1:i+1+end]))
+				i += end + 2
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if end := closingMarker(s, i); end > 0 {
+				flush()
+				kind := map[byte]nodeKind{'*': boldNode, '_': italicNode, '~': strikeNode}[c]
+				nodes = append(nodes, node{kind: kind, children: parseInline(s[i+1 : end])})
+				i = end + 1
+				continue
+			}
+
+		case c == ':':
+			if end := strings.IndexByte(s[i+1:], ':'); end > 0 {
+				if emoji, ok := Emoji(s[i+1 : i+1+end]); ok {
+					text.WriteString(emoji)
+					i += end + 2
+					// Skin tone modifiers follow as a second shortcode
+					if strings.HasPrefix(s[i:], ":skin-tone-") {
+						if next := strings.IndexByte(s[i+1:], ':'); next > 0 {
+							i += next + 2
+						}
+					}
+					continue
+				}
+			}
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return nodes
+}
+
+// closingMarker returns the index of the marker closing the one at s[i], or
+// -1. As in Slack, markers only count at word boundaries and can't be
+// padded with spaces, so snake_case and 2*3*4 are left alone.
+func closingMarker(s string, i int) int {
+	marker := s[i]
+	if i > 0 && isWordChar(lastRune(s[:i])) {
+		return -1
+	}
+	if i+1 >= len(s) || s[i+1] == ' ' || s[i+1] == marker {
+		return -1
+	}
+
+	for j := i + 2; j < len(s); j++ {
+		if s[j] != marker || s[j-1] == ' ' {
+			continue
+		}
+		if j+1 < len(s) && isWordChar(firstRune(s[j+1:])) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// parseEntity parses the inside of <...>: user and channel mentions, special
+// mentions such as !here, and links
+func parseEntity(s string) node {
+	target, label, _ := strings.Cut(s, "|")
+	label = unescape(label)
+
+	switch {
+	case strings.HasPrefix(target, "@"):
+		return node{kind: userNode, id: target[1:], text: strings.TrimPrefix(label, "@")}
+	case strings.HasPrefix(target, "#"):
+		return node{kind: channelNode, id: target[1:], text: label}
+	case strings.HasPrefix(target, "!"):
+		return parseSpecial(target[1:], label)
+	}
+
+	target = unescape(target)
+	if label == "" {
+		label = strings.TrimPrefix(target, "mailto:")
+	}
+	return node{kind: linkNode, text: label, url: target}
+}
+
+// parseSpecial handles <!here>, <!channel>, <!everyone>, user groups
+// (<!subteam^S123|@team>) and dates (<!date^1700000000^{date}|fallback>)
+func parseSpecial(target, label string) node {
+	name, _, _ := strings.Cut(target, "^")
+	switch name {
+	case "here", "channel", "everyone":
+		return node{kind: mentionNode, text: "@" + name}
+	case "subteam":
+		if label == "" {
+			label = "@" + strings.TrimPrefix(target, "subteam^")
+		}
+		return node{kind: mentionNode, text: label}
+	}
+
+	if label != "" {
+		return node{kind: textNode, text: label}
+	}
+	return node{kind: textNode, text: "<" + target + ">"}
+}
+
+var unescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">")
+
+// unescape reverses the only escaping Slack applies to message text
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,604 @@
+package importer
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/files"
+	"backup_slack/internal/logger"
+)
+
+// Options controls how files referenced by an export are handled
+type Options struct {
+	// Storage, when set, receives the files referenced by the export. Files
+	// included in the ZIP are copied out of it; the rest are downloaded with
+	// Token if one is given. Without Storage only file metadata is imported.
+	Storage *files.FileStorage
+	Token   string
+}
+
+// Stats summarises what ImportSlack added to the archive. Channels, users,
+// messages and reactions it already held aren't counted.
+type Stats struct {
+	Channels        int
+	Users           int // from users.json; placeholders for missing users aren't counted
+	Messages        int
+	MessagesSkipped int // already in the archive, left as they were
+	Reactions       int
+	Files           int // file metadata imported or updated
+	FilesStored     int // file contents written to storage
+	FilesLinked     int // stored as hard links to identical files already held
+	FilesSkipped    int // already held by the API backup
+}
+
+// Types for the parts of Slack's export JSON we read
+
+type exportChannel struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Created    int64  `json:"created"`
+	IsArchived bool   `json:"is_archived"`
+	Topic      struct {
+		Value string `json:"value"`
+	} `json:"topic"`
+	Purpose struct {
+		Value string `json:"value"`
+	} `json:"purpose"`
+	Members []string `json:"members"`
+}
+
+type exportUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Profile  struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+		Image72     string `json:"image_72"`
+	} `json:"profile"`
+}
+
+type exportMessage struct {
+	Type     string `json:"type"`
+	User     string `json:"user"`
+	BotID    string `json:"bot_id"`
+	Text     string `json:"text"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts"`
+	Edited   *struct {
+		TS string `json:"ts"`
+	} `json:"edited"`
+	Reactions []struct {
+		Name  string   `json:"name"`
+		Users []string `json:"users"`
+	} `json:"reactions"`
+	Files []exportFile `json:"files"`
+}
+
+type exportFile struct {
+	ID                 string `json:"id"`
+	Created            int64  `json:"created"`
+	Name               string `json:"name"`
+	Filetype           string `json:"filetype"`
+	Size               int64  `json:"size"`
+	Mode               string `json:"mode"`
+	URLPrivate         string `json:"url_private"`
+	URLPrivateDownload string `json:"url_private_download"`
+}
+
+// conversationLists maps each channel list in an export to the channel type
+// the backup stores. DMs are kept in a directory named after their ID.
+var conversationLists = []struct {
+	file        string
+	channelType string
+}{
+	{"channels.json", "public_channel"},
+	{"groups.json", "private_channel"},
+	{"mpims.json", "mpim"},
+	{"dms.json", "im"},
+}
+
+type importer struct {
+	store   database.Store
+	opts    Options
+	entries map[string]*zip.File
+	held    map[string]bool // IDs of files whose contents are already stored
+	stats   Stats
+}
+
+// ImportSlack adds the contents of a Slack workspace export ZIP to s.
+// Channels, messages and files the archive already holds are kept as they
+// are, so an older export never undoes edits or deletions the archive has
+// recorded, and importing an export that overlaps the API backup, or
+// importing it twice, is safe. Users are only filled in where the archive
+// has no more than the placeholder the backup records.
+func ImportSlack(s database.Store, zipPath string, opts Options) (Stats, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to open export: %w", err)
+	}
+	defer zr.Close()
+
+	im := &importer{store: s, opts: opts, entries: make(map[string]*zip.File), held: make(map[string]bool)}
+	for _, f := range zr.File {
+		im.entries[f.Name] = f
+	}
+
+	existing, err := s.GetFiles(database.MessageFilter{})
+	if err != nil {
+		return im.stats, fmt.Errorf("failed to read existing files: %w", err)
+	}
+	for _, f := range existing {
+		// Metadata-only rows from an earlier import may still get contents
+		im.held[f.ID] = f.LocalPath != ""
+	}
+
+	var users []exportUser
+	if _, err := im.readJSON("users.json", &users); err != nil {
+		return im.stats, err
+	}
+
+	type conversation struct {
+		channel database.Channel
+		members []string
+		dir     string
+	}
+	var conversations []conversation
+	for _, list := range conversationLists {
+		var channels []exportChannel
+		found, err := im.readJSON(list.file, &channels)
+		if err != nil {
+			return im.stats, err
+		}
+		if !found {
+			continue
+		}
+		for _, ch := range channels {
+			dir := ch.Name
+			if list.channelType == "im" || dir == "" {
+				dir = ch.ID
+			}
+			conversations = append(conversations, conversation{
+				channel: database.Channel{
+					ID:          ch.ID,
+					Name:        ch.Name,
+					ChannelType: list.channelType,
+					IsArchived:  ch.IsArchived,
+					CreatedAt:   time.Unix(ch.Created, 0),
+					Topic:       ch.Topic.Value,
+					Purpose:     ch.Purpose.Value,
+				},
+				members: ch.Members,
+				dir:     dir,
+			})
+		}
+	}
+	if len(conversations) == 0 {
+		return im.stats, fmt.Errorf("%s doesn't look like a Slack export: no channels.json or groups.json", zipPath)
+	}
+
+	knownChannels, err := s.GetChannels()
+	if err != nil {
+		return im.stats, fmt.Errorf("failed to read existing channels: %w", err)
+	}
+	haveChannel := make(map[string]bool, len(knownChannels))
+	for _, ch := range knownChannels {
+		haveChannel[ch.ID] = true
+	}
+	knownUsers, err := s.GetUsers()
+	if err != nil {
+		return im.stats, fmt.Errorf("failed to read existing users: %w", err)
+	}
+	// Placeholders (username == ID) may still get real names
+	haveUser := make(map[string]bool, len(knownUsers))
+	for _, u := range knownUsers {
+		haveUser[u.ID] = u.Username != u.ID
+	}
+
+	var stats Stats
+	err = s.Batch(func(w database.Writer) error {
+		for _, c := range conversations {
+			if haveChannel[c.channel.ID] {
+				continue
+			}
+			if err := w.InsertChannel(c.channel); err != nil {
+				return err
+			}
+			stats.Channels++
+		}
+		// Membership is only recorded here, so it's added to existing
+		// channels too
+		for _, c := range conversations {
+			for _, id := range c.members {
+				if err := w.InsertChannelMember(database.ChannelMember{ChannelID: c.channel.ID, UserID: id}); err != nil {
+					return err
+				}
+			}
+		}
+		for _, u := range users {
+			if haveUser[u.ID] {
+				continue
+			}
+			if err := w.InsertUser(convertUser(u)); err != nil {
+				return err
+			}
+			stats.Users++
+		}
+		return nil
+	})
+	if err != nil {
+		return im.stats, fmt.Errorf("failed to import channels and users: %w", err)
+	}
+	// Counted once the batch is committed, so a failed one adds nothing
+	im.stats.Channels, im.stats.Users = stats.Channels, stats.Users
+
+	for _, c := range conversations {
+		if err := im.importChannel(c.channel, c.dir); err != nil {
+			return im.stats, fmt.Errorf("failed to import channel %s (#%s): %w", c.channel.ID, c.channel.Name, err)
+		}
+	}
+
+	return im.stats, nil
+}
+
+// importChannel imports a channel's messages one day file at a time
+func (im *importer) importChannel(ch database.Channel, dir string) error {
+	var days []string
+	for name := range im.entries {
+		if path.Dir(name) == dir && strings.HasSuffix(name, ".json") {
+			days = append(days, name)
+		}
+	}
+	sort.Strings(days)
+
+	var count int
+	for _, day := range days {
+		var messages []exportMessage
+		if _, err := im.readJSON(day, &messages); err != nil {
+			return err
+		}
+		if err := im.importMessages(ch.ID, messages); err != nil {
+			return fmt.Errorf("failed to import %s: %w", day, err)
+		}
+		count += len(messages)
+
+		// Files may need copying or downloading, so they are handled once the
+		// day has been committed
+		for _, msg := range messages {
+			for _, f := range msg.Files {
+				if im.held[f.ID] {
+					im.stats.FilesSkipped++
+					continue
+				}
+				if err := im.importFile(ch.ID, dir, msg, f); err != nil {
+					logger.Error.Printf("Failed to import file %s: %v", f.ID, err)
+				}
+			}
+		}
+	}
+
+	logger.Info.Printf("Imported %d messages for channel %s (#%s)", count, ch.ID, ch.Name)
+	return nil
+}
+
+// importMessages writes one day of messages, their authors and reactions in
+// a single batch. Messages already archived are left untouched.
+func (im *importer) importMessages(channelID string, messages []exportMessage) error {
+	var ids []string
+	for _, msg := range messages {
+		if msg.TS != "" {
+			ids = append(ids, msg.TS)
+		}
+	}
+	archived := make(map[string]bool)
+	reacted := make(map[database.Reaction]bool) // by message, user and emoji
+	if len(ids) > 0 {
+		filter := database.MessageFilter{ChannelIDs: []string{channelID}, MessageIDs: ids}
+		existing, err := im.store.GetMessages(filter)
+		if err != nil {
+			return fmt.Errorf("failed to read existing messages: %w", err)
+		}
+		for _, m := range existing {
+			archived[m.ID] = true
+		}
+		reactions, err := im.store.GetReactions(filter)
+		if err != nil {
+			return fmt.Errorf("failed to read existing reactions: %w", err)
+		}
+		for _, r := range reactions {
+			reacted[database.Reaction{MessageID: r.MessageID, UserID: r.UserID, Emoji: r.Emoji}] = true
+		}
+	}
+
+	var added Stats
+	err := im.store.Batch(func(w database.Writer) error {
+		for i := range messages {
+			msg := &messages[i]
+			if msg.TS == "" {
+				continue
+			}
+
+			// Same fallbacks as the API backup
+			if msg.User == "" {
+				msg.User = msg.BotID
+			}
+			if msg.User == "" {
+				msg.User = "UNKNOWN"
+			}
+
+			// Users missing from users.json get placeholders, which never
+			// overwrite names we already know
+			referenced := []string{msg.User}
+			for _, r := range msg.Reactions {
+				referenced = append(referenced, r.Users...)
+			}
+			for _, userID := range referenced {
+				if err := w.InsertUser(database.User{ID: userID, Username: userID, FirstSeen: parseTS(msg.TS)}); err != nil {
+					return err
+				}
+			}
+
+			dbMsg := database.Message{
+				ID:          msg.TS,
+				ChannelID:   channelID,
+				UserID:      msg.User,
+				Content:     msg.Text,
+				Timestamp:   parseTS(msg.TS),
+				ThreadTS:    sql.NullString{String: msg.ThreadTS, Valid: msg.ThreadTS != ""},
+				MessageType: "message",
+			}
+			if msg.Edited != nil && msg.Edited.TS != "" {
+				dbMsg.LastEdited = sql.NullTime{Time: parseTS(msg.Edited.TS), Valid: true}
+			}
+			if archived[msg.TS] {
+				added.MessagesSkipped++
+			} else {
+				if err := w.InsertMessage(dbMsg); err != nil {
+					return err
+				}
+				added.Messages++
+			}
+
+			// Exports don't record when a reaction was added either
+			for _, r := range msg.Reactions {
+				for _, userID := range r.Users {
+					if err := w.InsertReaction(database.Reaction{
+						MessageID: msg.TS,
+						UserID:    userID,
+						Emoji:     r.Name,
+						Timestamp: time.Now(),
+					}); err != nil {
+						return err
+					}
+					if !reacted[database.Reaction{MessageID: msg.TS, UserID: userID, Emoji: r.Name}] {
+						added.Reactions++
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	im.stats.Messages += added.Messages
+	im.stats.MessagesSkipped += added.MessagesSkipped
+	im.stats.Reactions += added.Reactions
+	return nil
+}
+
+// importFile records a file's metadata and, when storage is configured,
+// stores its contents. Contents identical to a file already held are
+// replaced by a hard link to it.
+func (im *importer) importFile(channelID, dir string, msg exportMessage, f exportFile) error {
+	if f.ID == "" || f.Mode == "tombstone" || f.Mode == "hidden_by_limit" {
+		return nil
+	}
+
+	uploaded := time.Unix(f.Created, 0)
+	if f.Created == 0 {
+		uploaded = parseTS(msg.TS)
+	}
+	url := f.URLPrivateDownload
+	if url == "" {
+		url = f.URLPrivate
+	}
+
+	dbFile := database.File{
+		ID:              f.ID,
+		MessageID:       msg.TS,
+		OriginalURL:     url,
+		FileName:        f.Name,
+		FileType:        f.Filetype,
+		SizeBytes:       f.Size,
+		UploadTimestamp: uploaded,
+	}
+
+	if storage := im.opts.Storage; storage != nil {
+		localPath := storage.GenerateFilePath(channelID, f.ID, f.Filetype, parseTS(msg.TS))
+		if localPath == "" {
+			return fmt.Errorf("failed to create storage directory for file %s", f.ID)
+		}
+		checksum, err := im.storeContents(dir, f, url, localPath, dbFile)
+		if err != nil {
+			return err
+		}
+		if checksum != "" {
+			dbFile.LocalPath = localPath
+			dbFile.Checksum = checksum
+			if err := im.linkDuplicate(dbFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := im.store.InsertFile(dbFile); err != nil {
+		return err
+	}
+	im.held[f.ID] = dbFile.LocalPath != ""
+	im.stats.Files++
+	return nil
+}
+
+// storeContents writes a file to localPath, from the ZIP if it is included
+// and by download otherwise, and returns its checksum. It returns an empty
+// checksum if the contents aren't available.
+func (im *importer) storeContents(dir string, f exportFile, url, localPath string, dbFile database.File) (string, error) {
+	if zf := im.findUpload(dir, f); zf != nil {
+		if err := extract(zf, localPath); err != nil {
+			return "", err
+		}
+		im.stats.FilesStored++
+		return files.CalculateChecksum(localPath)
+	}
+
+	if im.opts.Token == "" || url == "" {
+		logger.Debug.Printf("File %s not included in export, storing metadata only", f.ID)
+		return "", nil
+	}
+
+	checksum, err := files.NewDownloader(im.opts.Storage).DownloadFile(files.FileMetadata{
+		ID:              dbFile.ID,
+		MessageID:       dbFile.MessageID,
+		OriginalURL:     url,
+		LocalPath:       localPath,
+		FileName:        dbFile.FileName,
+		FileType:        dbFile.FileType,
+		SizeBytes:       dbFile.SizeBytes,
+		UploadTimestamp: dbFile.UploadTimestamp,
+	}, im.opts.Token)
+	if err != nil {
+		return "", err
+	}
+	im.stats.FilesStored++
+	return checksum, nil
+}
+
+// linkDuplicate replaces a freshly stored file with a hard link to an
+// identical file the archive already holds
+func (im *importer) linkDuplicate(file database.File) error {
+	duplicates, err := im.store.GetDuplicateFiles(file.Checksum)
+	if err != nil {
+		return fmt.Errorf("failed to check duplicates: %w", err)
+	}
+
+	for _, dup := range duplicates {
+		if dup.ID == file.ID || dup.LocalPath == "" || dup.LocalPath == file.LocalPath ||
+			!im.opts.Storage.FileExists(dup.LocalPath) {
+			continue
+		}
+		if err := im.opts.Storage.HandleDuplicate(dup.LocalPath, file.LocalPath); err != nil {
+			return fmt.Errorf("failed to link duplicate: %w", err)
+		}
+		logger.Debug.Printf("File %s duplicates %s, stored as a hard link", file.ID, dup.ID)
+		im.stats.FilesStored--
+		im.stats.FilesLinked++
+		return nil
+	}
+	return nil
+}
+
+// findUpload looks for a file's contents in the ZIP. Slack's own exports
+// never include them, but exports made by third-party tools keep them under
+// __uploads/<id>/<name> or <channel>/attachments/<id>-<name>.
+func (im *importer) findUpload(dir string, f exportFile) *zip.File {
+	for _, name := range []string{
+		path.Join("__uploads", f.ID, f.Name),
+		path.Join(dir, "attachments", f.ID+"-"+f.Name),
+	} {
+		if zf, ok := im.entries[name]; ok {
+			return zf
+		}
+	}
+	return nil
+}
+
+// readJSON decodes a file from the ZIP, reporting false if it is absent
+func (im *importer) readJSON(name string, v interface{}) (bool, error) {
+	zf, ok := im.entries[name]
+	if !ok {
+		return false, nil
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return true, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return true, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// extract copies a ZIP entry to dest through a temporary file
+func extract(zf *zip.File, dest string) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", zf.Name, err)
+	}
+	defer rc.Close()
+
+	tmpFile := dest + ".tmp"
+	out, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile, dest); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to move file to final location: %w", err)
+	}
+	return nil
+}
+
+func convertUser(u exportUser) database.User {
+	display := u.Profile.DisplayName
+	if display == "" {
+		display = u.Profile.RealName
+	}
+	if display == "" {
+		display = u.RealName
+	}
+
+	name := u.Name
+	if name == "" {
+		name = u.ID
+	}
+
+	return database.User{
+		ID:          u.ID,
+		Username:    name,
+		DisplayName: display,
+		AvatarURL:   u.Profile.Image72,
+		FirstSeen:   time.Now(),
+	}
+}
+
+// parseTS converts a Slack timestamp to whole seconds, as the API backup does
+func parseTS(ts string) time.Time {
+	sec, _, _ := strings.Cut(ts, ".")
+	n, _ := strconv.ParseInt(sec, 10, 64)
+	return time.Unix(n, 0)
+}
@@ -0,0 +1,313 @@
+package importer
+
+import (
+	"archive/zip"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/files"
+	"backup_slack/internal/logger"
+)
+
+// writeZIP creates a ZIP holding the given name -> contents entries
+func writeZIP(t *testing.T, entries map[string]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create ZIP: %v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, contents := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to finish ZIP: %v", err)
+	}
+	return path
+}
+
+var export = map[string]string{
+	"channels.json": `[{"id": "C1", "name": "general", "created": 1700000000, "topic": {"value": "News"}}]`,
+	"dms.json":      `[{"id": "D1", "created": 1700000000, "members": ["U1", "U2"]}]`,
+	"users.json": `[
+		{"id": "U1", "name": "alice", "profile": {"display_name": "Alice", "image_72": "https://avatars.example/a.png"}},
+		{"id": "U2", "name": "bob", "real_name": "Bob Smith", "profile": {}}
+	]`,
+	"general/2023-11-14.json": `[
+		{"type": "message", "user": "U1", "text": "Lunch?", "ts": "1700000100.000100", "thread_ts": "1700000100.000100",
+		 "reactions": [{"name": "pizza", "users": ["U2", "U3"], "count": 2}]},
+		{"type": "message", "user": "U2", "text": "Sure", "ts": "1700000200.000100", "thread_ts": "1700000100.000100",
+		 "edited": {"user": "U2", "ts": "1700000300.000000"}},
+		{"type": "message", "bot_id": "B1", "text": "Reminder", "ts": "1700000400.000100",
+		 "files": [
+			{"id": "F1", "name": "held.txt", "filetype": "text", "size": 4, "url_private": "https://files.example/F1"},
+			{"id": "F2", "name": "menu.txt", "filetype": "text", "size": 5, "url_private": "https://files.example/F2"},
+			{"id": "F3", "name": "copy.txt", "filetype": "text", "size": 4, "url_private": "https://files.example/F3"},
+			{"id": "F4", "name": "missing.txt", "filetype": "text", "size": 1, "url_private": "https://files.example/F4"},
+			{"id": "F5", "mode": "tombstone"}
+		 ]}
+	]`,
+	"__uploads/F2/menu.txt":   "pizza",
+	"__uploads/F3/copy.txt":   "held",
+	"D1/2023-11-15.json":      `[{"type": "message", "user": "U1", "text": "psst", "ts": "1700050000.000100"}]`,
+	"general/not-a-day.txt":   "ignored",
+	"general/attachments/x":   "ignored",
+	"unrelated/2023-11-14.js": "ignored",
+}
+
+// newArchive returns a store that already holds what an API backup would
+// have recorded for general: placeholder users, the thread parent and F1
+func newArchive(t *testing.T, storagePath string) database.Store {
+	t.Helper()
+
+	if err := logger.Init(filepath.Join(t.TempDir(), "logs"), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	heldPath := filepath.Join(storagePath, "held.txt")
+	if err := os.WriteFile(heldPath, []byte("held"), 0644); err != nil {
+		t.Fatalf("Failed to write held file: %v", err)
+	}
+	checksum, err := files.CalculateChecksum(heldPath)
+	if err != nil {
+		t.Fatalf("Failed to checksum held file: %v", err)
+	}
+
+	s := database.NewMemoryStore()
+	err = s.Batch(func(w database.Writer) error {
+		if err := w.InsertChannel(database.Channel{ID: "C1", Name: "general", ChannelType: "public_channel", CreatedAt: time.Unix(1700000000, 0)}); err != nil {
+			return err
+		}
+		for _, id := range []string{"U1", "B1"} {
+			if err := w.InsertUser(database.User{ID: id, Username: id, FirstSeen: time.Unix(1700000000, 0)}); err != nil {
+				return err
+			}
+		}
+		for ts, user := range map[string]string{"1700000100.000100": "U1", "1700000400.000100": "B1"} {
+			if err := w.InsertMessage(database.Message{ID: ts, ChannelID: "C1", UserID: user, Content: "Lunch?",
+				Timestamp: parseTS(ts), MessageType: "message"}); err != nil {
+				return err
+			}
+		}
+		return w.InsertFile(database.File{ID: "F1", MessageID: "1700000400.000100", OriginalURL: "https://files.example/F1",
+			LocalPath: heldPath, FileName: "held.txt", FileType: "text", SizeBytes: 4,
+			UploadTimestamp: time.Unix(1700000400, 0), Checksum: checksum})
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate archive: %v", err)
+	}
+	return s
+}
+
+func TestImportSlack(t *testing.T) {
+	storagePath := t.TempDir()
+	s := newArchive(t, storagePath)
+	storage, err := files.NewFileStorage(storagePath, 1024*1024)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	zipPath := writeZIP(t, export)
+
+	stats, err := ImportSlack(s, zipPath, Options{Storage: storage})
+	if err != nil {
+		t.Fatalf("ImportSlack() error = %v", err)
+	}
+
+	// C1 and two of the messages were already archived
+	want := Stats{Channels: 1, Users: 2, Messages: 2, MessagesSkipped: 2, Reactions: 2, Files: 3, FilesStored: 1, FilesLinked: 1, FilesSkipped: 1}
+	if stats != want {
+		t.Errorf("ImportSlack() stats = %+v, want %+v", stats, want)
+	}
+
+	// Importing again adds nothing
+	stats, err = ImportSlack(s, zipPath, Options{Storage: storage})
+	if err != nil {
+		t.Fatalf("ImportSlack() again error = %v", err)
+	}
+	if stats.Channels != 0 || stats.Users != 0 || stats.Messages != 0 || stats.MessagesSkipped != 4 || stats.Reactions != 0 {
+		t.Errorf("ImportSlack() again stats = %+v, want only skipped messages", stats)
+	}
+
+	channels, err := s.GetChannels()
+	if err != nil {
+		t.Fatalf("GetChannels() error = %v", err)
+	}
+	types := make(map[string]string)
+	for _, ch := range channels {
+		types[ch.ID] = ch.ChannelType
+	}
+	if types["C1"] != "public_channel" || types["D1"] != "im" {
+		t.Errorf("Channel types = %v, want C1 public_channel and D1 im", types)
+	}
+	members, err := s.GetChannelMembers("D1")
+	if err != nil {
+		t.Fatalf("GetChannelMembers() error = %v", err)
+	}
+	if len(members) != 2 {
+		t.Errorf("D1 members = %v, want U1 and U2", members)
+	}
+
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	byID := make(map[string]database.User)
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	if u := byID["U1"]; u.Username != "alice" || u.DisplayName != "Alice" || u.AvatarURL == "" {
+		t.Errorf("U1 = %+v, want placeholder replaced by alice", u)
+	}
+	if u := byID["U2"]; u.DisplayName != "Bob Smith" {
+		t.Errorf("U2 = %+v, want real name as display name", u)
+	}
+	if _, ok := byID["U3"]; !ok {
+		t.Error("Reacting user U3 missing from users.json was not added")
+	}
+
+	msgs, err := s.GetMessages(database.MessageFilter{ChannelIDs: []string{"C1"}})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("general has %d messages, want 3", len(msgs))
+	}
+	if reply := msgs[1]; reply.ThreadTS.String != "1700000100.000100" || !reply.LastEdited.Valid {
+		t.Errorf("Reply = %+v, want thread_ts and edit time", reply)
+	}
+	if msgs[2].UserID != "B1" {
+		t.Errorf("Bot message user = %s, want B1", msgs[2].UserID)
+	}
+
+	stored, err := s.GetFiles(database.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetFiles() error = %v", err)
+	}
+	filesByID := make(map[string]database.File)
+	for _, f := range stored {
+		filesByID[f.ID] = f
+	}
+	if f := filesByID["F1"]; f.LocalPath != filepath.Join(storagePath, "held.txt") {
+		t.Errorf("F1 = %+v, want the backup's copy kept", f)
+	}
+	if f := filesByID["F2"]; f.LocalPath == "" || f.Checksum == "" {
+		t.Errorf("F2 = %+v, want contents extracted from the ZIP", f)
+	} else if data, err := os.ReadFile(f.LocalPath); err != nil || string(data) != "pizza" {
+		t.Errorf("F2 contents = %q, %v, want pizza", data, err)
+	}
+	if f := filesByID["F3"]; f.Checksum != filesByID["F1"].Checksum {
+		t.Errorf("F3 = %+v, want same checksum as F1", f)
+	} else {
+		a, _ := os.Stat(f.LocalPath)
+		b, _ := os.Stat(filesByID["F1"].LocalPath)
+		if !os.SameFile(a, b) {
+			t.Error("F3 was not stored as a hard link to F1")
+		}
+	}
+	if f, ok := filesByID["F4"]; !ok || f.LocalPath != "" {
+		t.Errorf("F4 = %+v, want metadata only", f)
+	}
+	if _, ok := filesByID["F5"]; ok {
+		t.Error("Tombstoned file F5 was imported")
+	}
+
+	// Importing again changes nothing
+	if _, err := ImportSlack(s, zipPath, Options{Storage: storage}); err != nil {
+		t.Fatalf("second ImportSlack() error = %v", err)
+	}
+	reactions, err := s.GetReactions(database.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetReactions() error = %v", err)
+	}
+	if len(reactions) != 2 {
+		t.Errorf("Have %d reactions after second import, want 2", len(reactions))
+	}
+}
+
+func TestImportSlackRejectsOtherZIPs(t *testing.T) {
+	s := newArchive(t, t.TempDir())
+	zipPath := writeZIP(t, map[string]string{"README.txt": "not an export"})
+
+	if _, err := ImportSlack(s, zipPath, Options{}); err == nil {
+		t.Error("ImportSlack() of a non-export ZIP should fail")
+	}
+}
+
+func TestImportSlackKeepsArchivedData(t *testing.T) {
+	s := newArchive(t, t.TempDir())
+
+	// Since the export was made the parent was edited, the bot message
+	// deleted, the channel renamed and alice's name recorded
+	edited := time.Unix(1700090000, 0)
+	err := s.Batch(func(w database.Writer) error {
+		if err := w.InsertChannel(database.Channel{ID: "C1", Name: "lunch", ChannelType: "public_channel",
+			CreatedAt: time.Unix(1700000000, 0), Topic: "Food"}); err != nil {
+			return err
+		}
+		if err := w.InsertUser(database.User{ID: "U1", Username: "alice.new", DisplayName: "Alice N", FirstSeen: time.Unix(1700000000, 0)}); err != nil {
+			return err
+		}
+		if err := w.InsertMessage(database.Message{ID: "1700000100.000100", ChannelID: "C1", UserID: "U1", Content: "Lunch at 1?",
+			Timestamp: parseTS("1700000100.000100"), MessageType: "message",
+			LastEdited: sql.NullTime{Time: edited, Valid: true}}); err != nil {
+			return err
+		}
+		return w.InsertMessage(database.Message{ID: "1700000400.000100", ChannelID: "C1", UserID: "B1", Content: "Lunch?",
+			Timestamp: parseTS("1700000400.000100"), MessageType: "message", IsDeleted: true})
+	})
+	if err != nil {
+		t.Fatalf("Failed to update archive: %v", err)
+	}
+
+	if _, err := ImportSlack(s, writeZIP(t, export), Options{}); err != nil {
+		t.Fatalf("ImportSlack() error = %v", err)
+	}
+
+	msgs, err := s.GetMessages(database.MessageFilter{MessageIDs: []string{"1700000100.000100", "1700000400.000100"}})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("GetMessages() returned %d messages, want 2", len(msgs))
+	}
+	if parent := msgs[0]; parent.Content != "Lunch at 1?" || !parent.LastEdited.Valid || !parent.LastEdited.Time.Equal(edited) {
+		t.Errorf("Parent = %+v, want the edit kept", parent)
+	}
+	if bot := msgs[1]; !bot.IsDeleted {
+		t.Errorf("Bot message = %+v, want it still marked deleted", bot)
+	}
+
+	channels, err := s.GetChannels()
+	if err != nil {
+		t.Fatalf("GetChannels() error = %v", err)
+	}
+	for _, ch := range channels {
+		if ch.ID == "C1" && (ch.Name != "lunch" || ch.Topic != "Food") {
+			t.Errorf("C1 = %+v, want the archived name and topic kept", ch)
+		}
+	}
+
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	for _, u := range users {
+		if u.ID == "U1" && (u.Username != "alice.new" || u.DisplayName != "Alice N") {
+			t.Errorf("U1 = %+v, want the archived name kept", u)
+		}
+	}
+}
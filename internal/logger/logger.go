@@ -1,11 +1,20 @@
+// Package logger writes structured logs through log/slog. Info, Warn, Error
+// and Debug take printf-style messages; Log takes key-value fields such as
+// channel, ts or method. Fields set with Options.Fields are added to every
+// line, and a Logger from With adds its own to the lines logged through it.
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,72 +32,233 @@ var (
 	Error *log.Logger
 	Debug *log.Logger
 	Warn  *log.Logger
-	level LogLevel
+
+	// Log writes records with key-value fields
+	Log *slog.Logger
+
+	// current is the configured handler
+	current atomic.Pointer[handlerRef]
+
+	// file is the log file, if logging to one
+	fileMu sync.Mutex
+	file   *rotatingFile
+
+	// toStderr is set when records are also written to stderr
+	toStderr atomic.Bool
 )
 
+type handlerRef struct{ slog.Handler }
+
 func ParseLogLevel(lvl string) LogLevel {
 	switch strings.ToUpper(lvl) {
 	case "DEBUG":
 		return LevelDebug
 	case "ERROR":
 		return LevelError
-	case "WARN":
+	case "WARN", "WARNING":
 		return LevelWarn
 	default:
 		return LevelInfo
 	}
 }
 
-type nullWriter struct{}
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case LevelError:
+		return slog.LevelError
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelDebug:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Options configures where and how logs are written
+type Options struct {
+	Dir    string // directory for backup_slack.log; no log file if empty
+	Level  LogLevel
+	Format string // "text" (default) or "json"
+	Stderr bool   // also write to stderr, e.g. for journald, keeping stdout for command output
+	Fields []any  // key-value pairs added to every line, e.g. workspace
 
-func (nw *nullWriter) Write(p []byte) (n int, err error) {
-	return len(p), nil
+	Rotation Rotation // when to rotate the log file and how many to keep
 }
 
+// Init logs text to backup_slack.log in logPath
 func Init(logPath string, logLevel LogLevel) error {
-	level = logLevel
+	return Configure(Options{Dir: logPath, Level: logLevel})
+}
+
+// Configure sets up the loggers, replacing any earlier configuration
+func Configure(opts Options) error {
+	var writers []io.Writer
+	var logFile *rotatingFile
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return err
+		}
 
-	if err := os.MkdirAll(logPath, 0755); err != nil {
+		var err error
+		logFile, err = openRotatingFile(filepath.Join(opts.Dir, "backup_slack.log"), opts.Rotation)
+		if err != nil {
+			return err
+		}
+		writers = append(writers, logFile)
+	}
+	if opts.Stderr {
+		writers = append(writers, os.Stderr)
+	}
+	if len(writers) == 0 {
+		return fmt.Errorf("no log output configured")
+	}
+	fail := func(err error) error {
+		if logFile != nil {
+			logFile.Close()
+		}
 		return err
 	}
+	out := io.MultiWriter(writers...)
 
-	// Open log file with 0644 permissions
-	logFile, err := os.OpenFile(
-		filepath.Join(logPath, "backup_slack.log"),
-		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
-		0644,
-	)
-	if err != nil {
-		return err
+	handlerOpts := &slog.HandlerOptions{
+		Level:       opts.Level.slogLevel(),
+		AddSource:   true,
+		ReplaceAttr: shortSource,
+	}
+	var h slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		h = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		h = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return fail(fmt.Errorf("unknown log format %q", opts.Format))
+	}
+	if len(opts.Fields) > 0 {
+		h = slog.New(h).With(opts.Fields...).Handler()
+	}
+	current.Store(&handlerRef{h})
+	toStderr.Store(opts.Stderr)
+
+	fileMu.Lock()
+	if file != nil {
+		file.Close()
+	}
+	file = logFile
+	fileMu.Unlock()
+
+	Log = slog.New(scopedHandler{})
+	Error = slog.NewLogLogger(scopedHandler{}, slog.LevelError)
+	Warn = slog.NewLogLogger(scopedHandler{}, slog.LevelWarn)
+	Info = slog.NewLogLogger(scopedHandler{}, slog.LevelInfo)
+	Debug = slog.NewLogLogger(scopedHandler{}, slog.LevelDebug)
+
+	return nil
+}
+
+// ToStderr reports whether log records are written to stderr
+func ToStderr() bool {
+	return toStderr.Load()
+}
+
+// Reopen reopens the log file after an external tool such as logrotate has
+// moved it, so logging continues in a new file
+func Reopen() error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	if file == nil {
+		return nil
 	}
+	return file.Reopen()
+}
+
+// Logger logs like the package loggers, adding its fields to every line.
+// Work such as a backup run passes one down to tag its lines, leaving the
+// lines of anything running alongside it untouched.
+type Logger struct {
+	Info  *log.Logger
+	Warn  *log.Logger
+	Error *log.Logger
+	Debug *log.Logger
+	Log   *slog.Logger
+}
 
-	// Always enable Error logging
-	Error = log.New(logFile, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+// With returns a Logger adding the key-value pairs in args to every line
+func With(args ...any) *Logger {
+	return newLogger(slog.New(scopedHandler{}).With(args...))
+}
 
-	// Configure Warn logger based on level
-	warnWriter := io.Writer(&nullWriter{})
-	if level >= LevelWarn {
-		warnWriter = logFile
+// With returns a Logger adding args to the fields of l
+func (l *Logger) With(args ...any) *Logger {
+	return newLogger(l.Log.With(args...))
+}
+
+func newLogger(l *slog.Logger) *Logger {
+	h := l.Handler()
+	return &Logger{
+		Info:  slog.NewLogLogger(h, slog.LevelInfo),
+		Warn:  slog.NewLogLogger(h, slog.LevelWarn),
+		Error: slog.NewLogLogger(h, slog.LevelError),
+		Debug: slog.NewLogLogger(h, slog.LevelDebug),
+		Log:   l,
 	}
-	Warn = log.New(warnWriter, "WARN: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
 
-	// Configure Info logger based on level
-	infoWriter := io.Writer(&nullWriter{})
-	if level >= LevelInfo {
-		infoWriter = logFile
+// shortSource trims the source of a line to file:line, like log.Lshortfile
+func shortSource(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.SourceKey && len(groups) == 0 {
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			a.Value = slog.StringValue(fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+		}
 	}
-	Info = log.New(infoWriter, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	return a
+}
 
-	// Configure Debug logger based on level
-	debugWriter := io.Writer(&nullWriter{})
-	if level >= LevelDebug {
-		debugWriter = logFile
+// scopedHandler sends records to the current handler, so loggers created
+// before Configure pick up the new output and fields
+type scopedHandler struct {
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h scopedHandler) handler() slog.Handler {
+	ref := current.Load()
+	if ref == nil {
+		return nil
 	}
-	Debug = log.New(debugWriter, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+	next := ref.Handler
+	for _, f := range h.with {
+		next = f(next)
+	}
+	return next
+}
 
+func (h scopedHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	next := h.handler()
+	return next != nil && next.Enabled(ctx, level)
+}
+
+func (h scopedHandler) Handle(ctx context.Context, r slog.Record) error {
+	if next := h.handler(); next != nil {
+		return next.Handle(ctx, r)
+	}
 	return nil
 }
 
+func (h scopedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.wrap(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h scopedHandler) WithGroup(name string) slog.Handler {
+	return h.wrap(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h scopedHandler) wrap(f func(slog.Handler) slog.Handler) scopedHandler {
+	with := append(h.with[:len(h.with):len(h.with)], f)
+	return scopedHandler{with: with}
+}
+
 // Add rate limit specific logging
 func LogRateLimit(retryAfter time.Duration, operation string) {
 	Warn.Printf("Rate limit hit during %s, waiting %v seconds",
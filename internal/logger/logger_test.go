@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want LogLevel
+	}{
+		{"DEBUG", LevelDebug},
+		{"info", LevelInfo},
+		{"WARN", LevelWarn},
+		{"WARNING", LevelWarn},
+		{"warning", LevelWarn},
+		{"ERROR", LevelError},
+		{"", LevelInfo},
+		{"verbose", LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := ParseLogLevel(tt.in); got != tt.want {
+			t.Errorf("ParseLogLevel(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// readLines decodes each JSON line of the log file in dir
+func readLines(t *testing.T, dir string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, "backup_slack.log"))
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	defer f.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Log line %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestConfigureJSON(t *testing.T) {
+	dir := t.TempDir()
+	err := Configure(Options{
+		Dir:    dir,
+		Level:  LevelInfo,
+		Format: "json",
+		Fields: []any{"workspace", "acme"},
+	})
+	if err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+
+	Info.Printf("Started backup run %d", 7)
+	run := With("run_id", 7)
+	channel := run.With("channel", "C1")
+	channel.Log.Info("Stored message", "ts", "1700000000.000100")
+	channel.Debug.Printf("not logged at info level")
+	run.Warn.Printf("Run %d finished with warnings", 7)
+	Error.Printf("outside the run")
+
+	lines := readLines(t, dir)
+	if len(lines) != 4 {
+		t.Fatalf("Got %d log lines, want 4: %v", len(lines), lines)
+	}
+
+	want := []map[string]interface{}{
+		{"level": "INFO", "msg": "Started backup run 7", "workspace": "acme"},
+		{"level": "INFO", "msg": "Stored message", "workspace": "acme", "run_id": 7.0, "channel": "C1", "ts": "1700000000.000100"},
+		{"level": "WARN", "msg": "Run 7 finished with warnings", "workspace": "acme", "run_id": 7.0},
+		{"level": "ERROR", "msg": "outside the run", "workspace": "acme"},
+	}
+	for i, fields := range want {
+		for k, v := range fields {
+			if lines[i][k] != v {
+				t.Errorf("Line %d field %s = %v, want %v", i, k, lines[i][k], v)
+			}
+		}
+		if _, ok := lines[i]["time"]; !ok {
+			t.Errorf("Line %d has no time", i)
+		}
+		if src, _ := lines[i]["source"].(string); !strings.HasPrefix(src, "logger_test.go:") {
+			t.Errorf("Line %d source = %q, want the calling file", i, src)
+		}
+	}
+	if _, ok := lines[3]["run_id"]; ok {
+		t.Error("run_id logged by the package loggers")
+	}
+	if _, ok := lines[2]["channel"]; ok {
+		t.Error("channel logged by the run's logger")
+	}
+}
+
+func TestConfigureText(t *testing.T) {
+	dir := t.TempDir()
+	if err := Configure(Options{Dir: dir, Level: LevelDebug}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	Log.With("method", "conversations.history").Debug("Rate limited", "wait", "2s")
+
+	data, err := os.ReadFile(filepath.Join(dir, "backup_slack.log"))
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	for _, want := range []string{"level=DEBUG", `msg="Rate limited"`, "method=conversations.history", "wait=2s"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Log %q missing %q", data, want)
+		}
+	}
+}
+
+func TestConfigureErrors(t *testing.T) {
+	if err := Configure(Options{Dir: t.TempDir(), Format: "xml"}); err == nil {
+		t.Error("Configure() accepted an unknown format")
+	}
+	if err := Configure(Options{}); err == nil {
+		t.Error("Configure() accepted no output")
+	}
+}
+
+func TestToStderr(t *testing.T) {
+	if err := Configure(Options{Stderr: true}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	if !ToStderr() {
+		t.Error("ToStderr() = false with stderr output")
+	}
+	if err := Configure(Options{Dir: t.TempDir()}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	if ToStderr() {
+		t.Error("ToStderr() = true with only a log file")
+	}
+}
@@ -0,0 +1,240 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Rotation controls when the log file is rotated and how many old files
+// are kept. The zero value never rotates.
+type Rotation struct {
+	MaxSize    int64         // rotate before the file grows past this many bytes; 0 disables
+	Interval   time.Duration // rotate when a write falls in a new interval, e.g. 24h for daily (UTC); 0 disables
+	MaxBackups int           // rotated files to keep; 0 keeps all
+	Compress   bool          // gzip rotated files
+}
+
+// rotatingFile is a log file that rotates itself. Rotated files are named
+// after the file with the time of rotation appended, e.g.
+// backup_slack.log.20240301-030000.000.gz.
+//
+// Several processes may share the file, e.g. listen and the scheduled
+// backup of one workspace. Before each write the path is checked, and if
+// another process has rotated the file away, it is reopened rather than
+// written to behind the other's back.
+type rotatingFile struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	mu        sync.Mutex
+	f         *os.File
+	size      int64
+	lastWrite time.Time
+
+	// cleanup compresses and prunes rotated files in the background, one
+	// rotation at a time, so writers don't wait on it
+	cleanup   sync.WaitGroup
+	cleanupMu sync.Mutex
+}
+
+func openRotatingFile(path string, rotation Rotation) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, rotation: rotation, now: time.Now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the log file for appending. Its size and modification time
+// carry over from earlier processes, so a daily backup still rotates
+// daily even though each run only lasts minutes.
+func (r *rotatingFile) open() error {
+	// Open log file with 0644 permissions
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	r.lastWrite = info.ModTime()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if err := r.follow(); err != nil {
+		return 0, fmt.Errorf("failed to reopen log file: %w", err)
+	}
+	now := r.now()
+	if r.due(now, int64(len(p))) {
+		if err := r.rotate(now); err != nil {
+			return 0, fmt.Errorf("failed to reopen log file after rotation: %w", err)
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	r.lastWrite = now
+	return n, err
+}
+
+// follow reopens the file if the path no longer refers to it, because
+// another process or an external tool moved it, and otherwise picks up
+// its size, which other processes writing to it may have grown
+func (r *rotatingFile) follow() error {
+	info, err := os.Stat(r.path)
+	if err == nil {
+		var current os.FileInfo
+		if current, err = r.f.Stat(); err == nil && os.SameFile(info, current) {
+			r.size = info.Size()
+			return nil
+		}
+	}
+
+	r.f.Close()
+	r.f = nil
+	return r.open()
+}
+
+// due reports whether the file should be rotated before writing n bytes
+func (r *rotatingFile) due(now time.Time, n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.rotation.MaxSize > 0 && r.size+n > r.rotation.MaxSize {
+		return true
+	}
+	if iv := r.rotation.Interval; iv > 0 && !now.Truncate(iv).Equal(r.lastWrite.Truncate(iv)) {
+		return true
+	}
+	return false
+}
+
+// rotate moves the current file aside and opens a new one, then has the
+// rotated file compressed, if configured, and old files beyond the
+// retention count removed in the background. It only fails if no file
+// could be opened; other problems go to stderr so logging carries on.
+func (r *rotatingFile) rotate(now time.Time) error {
+	r.f.Close()
+	r.f = nil
+
+	rotated := r.path + "." + now.UTC().Format("20060102-150405.000")
+	renameErr := os.Rename(r.path, rotated)
+	if err := r.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", renameErr)
+		return nil
+	}
+
+	r.cleanup.Add(1)
+	go func() {
+		defer r.cleanup.Done()
+		r.cleanupMu.Lock()
+		defer r.cleanupMu.Unlock()
+
+		if r.rotation.Compress {
+			if err := compressFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compress log file: %v\n", err)
+			}
+		}
+		if err := r.prune(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove old log files: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond MaxBackups
+func (r *rotatingFile) prune() error {
+	if r.rotation.MaxBackups <= 0 {
+		return nil
+	}
+	rotated, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+	// Timestamps in the names sort oldest first
+	sort.Strings(rotated)
+	for len(rotated) > r.rotation.MaxBackups {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// Reopen closes and reopens the log file, for use after an external tool
+// such as logrotate has moved it
+func (r *rotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+	return r.open()
+}
+
+// Close closes the file once rotated files have been compressed and pruned
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cleanup.Wait()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,186 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock returns times a second apart, starting at start
+func fakeClock(start time.Time) func() time.Time {
+	now := start
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+// rotatedFiles returns the contents of the rotated files next to path,
+// oldest first, decompressing them if needed
+func rotatedFiles(t *testing.T, path string) []string {
+	t.Helper()
+	names, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Failed to list rotated files: %v", err)
+	}
+	sort.Strings(names)
+
+	var contents []string
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", name, err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(name, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("Rotated file %s is not gzipped: %v", name, err)
+			}
+			r = gz
+		}
+		data, err := io.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+func TestRotateBySize(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation Rotation
+		want     []string // rotated files, oldest first
+	}{
+		{"keep all", Rotation{MaxSize: 14}, []string{"line 1\nline 2\n", "line 3\nline 4\n"}},
+		{"compressed", Rotation{MaxSize: 14, Compress: true}, []string{"line 1\nline 2\n", "line 3\nline 4\n"}},
+		{"retention", Rotation{MaxSize: 14, MaxBackups: 1, Compress: true}, []string{"line 3\nline 4\n"}},
+		{"never", Rotation{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "backup_slack.log")
+			f, err := openRotatingFile(path, tt.rotation)
+			if err != nil {
+				t.Fatalf("openRotatingFile() error = %v", err)
+			}
+			f.now = fakeClock(time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC))
+
+			for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n", "line 5\n"} {
+				if _, err := io.WriteString(f, line); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			// Wait for compression and pruning
+			if err := f.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			got := rotatedFiles(t, path)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Rotated files = %q, want %q", got, tt.want)
+			}
+			if tt.rotation.Compress {
+				if plain, _ := filepath.Glob(path + ".*[0-9]"); len(plain) > 0 {
+					t.Errorf("Uncompressed rotated files left behind: %v", plain)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateByInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup_slack.log")
+	if err := os.WriteFile(path, []byte("yesterday\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	yesterday := time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+		t.Fatalf("Failed to set log file time: %v", err)
+	}
+
+	// A new process a day later rotates on its first write
+	f, err := openRotatingFile(path, Rotation{Interval: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+	f.now = fakeClock(yesterday.Add(24 * time.Hour))
+
+	io.WriteString(f, "today\n")
+	io.WriteString(f, "still today\n")
+
+	if got := rotatedFiles(t, path); len(got) != 1 || got[0] != "yesterday\n" {
+		t.Errorf("Rotated files = %q, want yesterday's log", got)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "today\nstill today\n" {
+		t.Errorf("Current log = %q", data)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	if err := Configure(Options{Dir: dir, Level: LevelInfo}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	path := filepath.Join(dir, "backup_slack.log")
+
+	Info.Printf("before logrotate")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to move log file: %v", err)
+	}
+	Info.Printf("after the move")
+	if err := Reopen(); err != nil {
+		t.Fatalf("Reopen() error = %v", err)
+	}
+	Info.Printf("after reopening")
+
+	// The move is noticed on the next write, even before the SIGHUP
+	moved, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if !strings.Contains(string(moved), "before logrotate") || strings.Contains(string(moved), "after the move") {
+		t.Errorf("Moved log = %q, want only the lines written before the move", moved)
+	}
+	if !strings.Contains(string(current), "after the move") || !strings.Contains(string(current), "after reopening") {
+		t.Errorf("Current log = %q, want the lines written after the move", current)
+	}
+}
+
+func TestRotateSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup_slack.log")
+	rotation := Rotation{MaxSize: 14}
+	listen, err := openRotatingFile(path, rotation)
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+	defer listen.Close()
+	backup, err := openRotatingFile(path, rotation)
+	if err != nil {
+		t.Fatalf("openRotatingFile() error = %v", err)
+	}
+	defer backup.Close()
+	clock := fakeClock(time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC))
+	listen.now, backup.now = clock, clock
+
+	io.WriteString(listen, "line 1\n")
+	io.WriteString(backup, "line 2\n")
+	// The backup sees the file is full and rotates it; listen follows
+	io.WriteString(backup, "line 3\n")
+	io.WriteString(listen, "line 4\n")
+
+	if got := rotatedFiles(t, path); len(got) != 1 || got[0] != "line 1\nline 2\n" {
+		t.Errorf("Rotated files = %q, want one holding both processes' lines", got)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "line 3\nline 4\n" {
+		t.Errorf("Current log = %q, want lines from both processes after rotation", data)
+	}
+}
@@ -0,0 +1,72 @@
+// Package metrics collects counters about backups and exposes them to
+// Prometheus, either over HTTP or as a file for node_exporter's textfile
+// collector when the backup runs once and exits
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var defaultRegistry = NewRegistry()
+
+var (
+	MessagesStored = defaultRegistry.Counter("backup_slack_messages_total",
+		"Messages stored, by channel ID", "channel")
+	FilesStored = defaultRegistry.Counter("backup_slack_files_total",
+		"Files stored, by channel ID", "channel")
+	FileBytes = defaultRegistry.Counter("backup_slack_file_bytes_total",
+		"Bytes of files stored, by channel ID", "channel")
+	DownloadFailures = defaultRegistry.Counter("backup_slack_download_failures_total",
+		"File downloads that failed after all retries")
+
+	APICalls = defaultRegistry.Counter("backup_slack_api_calls_total",
+		"Slack API calls, including retries, by method", "method")
+	RateLimited = defaultRegistry.Counter("backup_slack_api_rate_limited_total",
+		"Slack API calls rejected with a rate limit error, by method", "method")
+	RateLimitWait = defaultRegistry.Counter("backup_slack_api_rate_limit_wait_seconds_total",
+		"Time spent waiting on rate limits before Slack API calls, by method", "method")
+
+	RunDuration = defaultRegistry.Gauge("backup_slack_run_duration_seconds",
+		"Duration of the last backup run")
+	LastSync = defaultRegistry.Gauge("backup_slack_last_successful_sync_timestamp_seconds",
+		"Unix time of each channel's last successful backup, by channel ID", "channel")
+	DatabaseSize = defaultRegistry.Gauge("backup_slack_database_size_bytes",
+		"Size of the archive database")
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		defaultRegistry.WriteText(w)
+	})
+}
+
+// WriteFile writes the metrics to path, replacing it atomically so the
+// textfile collector never reads a partial file
+func WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := defaultRegistry.WriteText(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace metrics file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	messages := r.Counter("messages_total", "Messages stored", "channel")
+	r.Counter("failures_total", "Failures")
+	r.Counter("unused_total", "Never updated", "method")
+	size := r.Gauge("size_bytes", "Size\nin bytes")
+
+	messages.Add(3, "C2")
+	messages.Inc("C1")
+	messages.Inc("C2")
+	messages.Add(-1, "C1") // ignored
+	messages.Inc(`we"ird\`)
+	size.Set(1.5)
+	size.Set(2048)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+
+	want := `# HELP messages_total Messages stored
+# TYPE messages_total counter
+messages_total{channel="C1"} 1
+messages_total{channel="C2"} 4
+messages_total{channel="we\"ird\\"} 1
+# HELP failures_total Failures
+# TYPE failures_total counter
+failures_total 0
+# HELP size_bytes Size\nin bytes
+# TYPE size_bytes gauge
+size_bytes 2048
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("calls_total", "Calls", "method")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with missing label value did not panic")
+		}
+	}()
+	c.Inc()
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup_slack.prom")
+	if err := os.WriteFile(path, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	DownloadFailures.Inc()
+
+	if err := WriteFile(path); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\nbackup_slack_download_failures_total 1\n") {
+		t.Errorf("metrics file missing download failures:\n%s", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the metrics file", len(entries))
+	}
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/files"
+)
+
+// Checker decides which alerts a finished run calls for. A zero threshold
+// disables its check.
+type Checker struct {
+	Store          database.Store
+	StoragePath    string
+	StaleAfter     time.Duration // alert on channels not synced for longer
+	MinFreePercent float64       // alert when the storage filesystem has less free
+	StatePath      string        // remembers sent alerts for Pending; every alert is sent if empty
+	RepeatAfter    time.Duration // resend an unchanged alert this often; 0 never
+
+	now       func() time.Time
+	diskUsage func(path string) (available, total uint64, err error)
+}
+
+// Check returns a notification for each condition the run raises: the run
+// failing or some of its channels failing, channels going stale and the
+// storage disk filling up
+func (c Checker) Check(run database.BackupRun) ([]Notification, error) {
+	newNotification := c.notifier(&run)
+
+	var notifications []Notification
+	switch run.Status {
+	case database.RunFailed:
+		notifications = append(notifications, newNotification(RunFailed, run.Status+": "+run.Error,
+			fmt.Sprintf("Slack backup run %d failed", run.ID), ""))
+	case database.RunPartial:
+		notifications = append(notifications, newNotification(RunFailed, run.Status+": "+run.Error,
+			fmt.Sprintf("Slack backup run %d partly failed: %s", run.ID, run.Error), ""))
+	}
+
+	var channelIDs []string
+	for _, ch := range run.Channels {
+		channelIDs = append(channelIDs, ch.ChannelID)
+	}
+	more, err := c.checkArchive(channelIDs, newNotification)
+	return append(notifications, more...), err
+}
+
+// CheckArchive returns a notification if any of the channels hasn't been
+// backed up within StaleAfter, judged from the stored sync state, and one if
+// the storage disk is filling up. It needs no run, so it can run on a timer
+// of its own and notice backups that stopped running altogether. last is
+// the most recent run, summarized in the notifications, or nil if none.
+func (c Checker) CheckArchive(channelIDs []string, last *database.BackupRun) ([]Notification, error) {
+	return c.checkArchive(channelIDs, c.notifier(last))
+}
+
+func (c Checker) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// notificationFunc creates a notification. condition identifies what it
+// reports, so that Pending can tell a persisting alert from a changed one.
+type notificationFunc func(kind, condition, subject, details string) Notification
+
+// notifier returns a function creating notifications that end with a
+// summary of run, if there is one
+func (c Checker) notifier(run *database.BackupRun) notificationFunc {
+	var summary string
+	n := Notification{Time: c.clock()}
+	if run != nil {
+		summary = Summary(*run)
+		n.Run = *run
+	}
+	return func(kind, condition, subject, details string) Notification {
+		n.Kind, n.Subject, n.Text, n.condition = kind, subject, details, condition
+		if summary != "" {
+			n.Text = summary
+			if details != "" {
+				n.Text = details + "\n" + summary
+			}
+		}
+		return n
+	}
+}
+
+func (c Checker) checkArchive(channelIDs []string, newNotification notificationFunc) ([]Notification, error) {
+	var notifications []Notification
+	if c.StaleAfter > 0 {
+		var stale, staleIDs []string
+		now := c.clock()
+		for _, channelID := range channelIDs {
+			state, err := c.Store.GetSyncState(channelID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check channel %s for staleness: %w", channelID, err)
+			}
+			switch {
+			case state.LastSyncAt.IsZero():
+				stale = append(stale, fmt.Sprintf("- %s has never been backed up", channelID))
+			case now.Sub(state.LastSyncAt) > c.StaleAfter:
+				stale = append(stale, fmt.Sprintf("- %s last backed up %s (%v ago)", channelID,
+					state.LastSyncAt.UTC().Format(time.RFC3339), now.Sub(state.LastSyncAt).Round(time.Minute)))
+			default:
+				continue
+			}
+			staleIDs = append(staleIDs, channelID)
+		}
+		if len(stale) > 0 {
+			sort.Strings(staleIDs)
+			notifications = append(notifications, newNotification(ChannelsStale, strings.Join(staleIDs, ","),
+				fmt.Sprintf("%d Slack channels not backed up for over %v", len(stale), c.StaleAfter),
+				strings.Join(stale, "\n")+"\n"))
+		}
+	}
+
+	if c.MinFreePercent > 0 {
+		diskUsage := files.DiskUsage
+		if c.diskUsage != nil {
+			diskUsage = c.diskUsage
+		}
+		available, total, err := diskUsage(c.StoragePath)
+		if err != nil {
+			return notifications, err
+		}
+		if free := 100 * float64(available) / float64(total); total > 0 && free < c.MinFreePercent {
+			notifications = append(notifications, newNotification(DiskSpace, "low",
+				fmt.Sprintf("Slack backup storage is %.0f%% full", 100-free),
+				fmt.Sprintf("%s has %d of %d bytes free (%.1f%%), below the %.0f%% threshold\n",
+					c.StoragePath, available, total, free, c.MinFreePercent)))
+		}
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,72 @@
+// Package notify alerts people when backups need attention: a run failed,
+// channels haven't been backed up for too long or the disk is filling up
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+// Alert kinds
+const (
+	RunFailed     = "run_failed"
+	ChannelsStale = "channels_stale"
+	DiskSpace     = "disk_space"
+)
+
+// Notification is an alert together with a summary of the run that raised it
+type Notification struct {
+	Kind     string
+	Subject  string
+	Text     string // plain-text details and run summary
+	Run      database.BackupRun
+	Time     time.Time
+	Resolved bool // the condition alerted on earlier has cleared
+
+	condition string // what the alert is about, unlike Text stable while it persists
+}
+
+// Notifier delivers notifications to one destination
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Multi sends every notification to each of its notifiers
+type Multi []Notifier
+
+// Notify tries every notifier, returning their combined errors
+func (m Multi) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Summary describes a run in a few lines of plain text
+func Summary(run database.BackupRun) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Run %d (%s) %s", run.ID, run.Trigger, run.Status)
+	if !run.FinishedAt.IsZero() {
+		fmt.Fprintf(&b, " after %v", run.FinishedAt.Sub(run.StartedAt).Round(time.Second))
+	}
+	fmt.Fprintf(&b, ", started %s\n", run.StartedAt.UTC().Format(time.RFC3339))
+	if run.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", run.Error)
+	}
+	fmt.Fprintf(&b, "Stored %d messages and %d files from %d channels, downloaded %d bytes with %d API calls\n",
+		run.Messages(), run.Files(), len(run.Channels), run.BytesDownloaded, run.APICalls)
+	for _, ch := range run.Channels {
+		if ch.Error != "" {
+			fmt.Fprintf(&b, "- %s failed: %s\n", ch.ChannelID, ch.Error)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,384 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+var testRun = database.BackupRun{
+	ID:         7,
+	StartedAt:  time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC),
+	FinishedAt: time.Date(2024, 3, 1, 3, 4, 12, 0, time.UTC),
+	Trigger:    "scheduled",
+	Status:     database.RunPartial,
+	Error:      "1 of 2 channels failed",
+	APICalls:   310,
+	Channels: []database.BackupRunChannel{
+		{ChannelID: "C1", Messages: 12, Files: 1, BytesDownloaded: 2048},
+		{ChannelID: "C2", Error: "not_in_channel"},
+	},
+	BytesDownloaded: 2048,
+}
+
+func TestSummary(t *testing.T) {
+	want := `Run 7 (scheduled) partial after 4m12s, started 2024-03-01T03:00:00Z
+Error: 1 of 2 channels failed
+Stored 12 messages and 1 files from 2 channels, downloaded 2048 bytes with 310 API calls
+- C2 failed: not_in_channel
+`
+	if got := Summary(testRun); got != want {
+		t.Errorf("Summary() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestChecker(t *testing.T) {
+	now := time.Date(2024, 3, 4, 3, 5, 0, 0, time.UTC)
+	store := database.NewMemoryStore()
+	for _, id := range []string{"C1", "C2"} {
+		if err := store.InsertChannel(database.Channel{ID: id, Name: id, ChannelType: "public_channel", CreatedAt: now}); err != nil {
+			t.Fatalf("Failed to insert channel: %v", err)
+		}
+	}
+	if err := store.UpdateSyncState(database.SyncState{ChannelID: "C1", LastSyncAt: now.Add(-time.Hour)}); err != nil {
+		t.Fatalf("UpdateSyncState() error = %v", err)
+	}
+
+	succeeded := testRun
+	succeeded.Status, succeeded.Error = database.RunSucceeded, ""
+	failed := testRun
+	failed.Status = database.RunFailed
+
+	tests := []struct {
+		name    string
+		run     database.BackupRun
+		checker Checker
+		want    []string
+	}{
+		{"succeeded", succeeded, Checker{}, nil},
+		{"partial", testRun, Checker{}, []string{RunFailed}},
+		{"failed", failed, Checker{}, []string{RunFailed}},
+		{"stale", succeeded, Checker{StaleAfter: 48 * time.Hour}, []string{ChannelsStale}},
+		{"fresh", succeeded, Checker{StaleAfter: 2 * time.Hour}, []string{ChannelsStale}}, // C2 never synced
+		{"disk full", succeeded, Checker{MinFreePercent: 10}, []string{DiskSpace}},
+		{"disk fine", succeeded, Checker{MinFreePercent: 5}, nil},
+		{"everything", failed, Checker{StaleAfter: time.Hour, MinFreePercent: 10}, []string{RunFailed, ChannelsStale, DiskSpace}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.checker
+			c.Store = store
+			c.StoragePath = "/srv/backup"
+			c.now = func() time.Time { return now }
+			c.diskUsage = func(string) (uint64, uint64, error) { return 8 << 30, 100 << 30, nil } // 8% free
+
+			notifications, err := c.Check(tt.run)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			var got []string
+			for _, n := range notifications {
+				got = append(got, n.Kind)
+				if !strings.Contains(n.Text, "Run 7 (scheduled)") || n.Run.ID != 7 || !n.Time.Equal(now) {
+					t.Errorf("Check() %s notification missing the run summary: %+v", n.Kind, n)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check() kinds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	n := Notification{
+		Kind:    RunFailed,
+		Subject: "Slack backup run 7 partly failed",
+		Text:    Summary(testRun),
+		Run:     testRun,
+		Time:    testRun.FinishedAt,
+	}
+
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", r.Header.Get("Content-Type"))
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		bodies = append(bodies, body)
+		if r.URL.Path == "/broken" {
+			http.Error(w, "nope", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	notifier := Multi{Webhook{URL: srv.URL + "/hook"}, SlackWebhook{URL: srv.URL + "/slack"}}
+	if err := notifier.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("Received %d webhook requests, want 2", len(bodies))
+	}
+
+	generic := bodies[0]
+	run := generic["run"].(map[string]interface{})
+	if generic["kind"] != RunFailed || generic["subject"] != n.Subject || run["status"] != "partial" ||
+		run["messages"] != 12.0 || run["finished_at"] != "2024-03-01T03:04:12Z" || len(run["channels"].([]interface{})) != 2 {
+		t.Errorf("Webhook body = %v", generic)
+	}
+	if text, _ := bodies[1]["text"].(string); !strings.HasPrefix(text, "*Slack backup run 7 partly failed*") ||
+		!strings.Contains(text, "C2 failed: not_in_channel") {
+		t.Errorf("Slack webhook text = %q", text)
+	}
+
+	if err := (Webhook{URL: srv.URL + "/broken"}).Notify(context.Background(), n); err == nil {
+		t.Error("Notify() to a failing webhook returned no error")
+	}
+}
+
+// smtpStandIn accepts one message and returns what it received
+func smtpStandIn(t *testing.T) (addr string, received <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+		var transcript strings.Builder
+		reply("220 localhost ESMTP stand-in")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				transcript.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				ch <- transcript.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+func TestEmail(t *testing.T) {
+	addr, received := smtpStandIn(t)
+	notifier := Email{
+		Addr: addr,
+		From: "backup@example.com",
+		To:   []string{"ops@example.com", "audit@example.com"},
+	}
+
+	n := Notification{
+		Kind:    RunFailed,
+		Subject: "Slack backup run 7 partly failed",
+		Text:    Summary(testRun),
+		Run:     testRun,
+		Time:    testRun.FinishedAt,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	select {
+	case got := <-received:
+		for _, want := range []string{
+			"MAIL FROM:<backup@example.com>",
+			"RCPT TO:<ops@example.com>",
+			"RCPT TO:<audit@example.com>",
+			"Subject: Slack backup run 7 partly failed\r\n",
+			"X-Backup-Slack-Alert: run_failed\r\n",
+			"- C2 failed: not_in_channel\r\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("SMTP transcript missing %q:\n%s", want, got)
+			}
+		}
+	case <-ctx.Done():
+		t.Fatal("SMTP stand-in received no message")
+	}
+}
+
+func TestEmailTimeout(t *testing.T) {
+	// A server that accepts connections but never greets
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	notifier := Email{Addr: l.Addr().String(), From: "backup@example.com", To: []string{"ops@example.com"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = notifier.Notify(ctx, Notification{Kind: RunFailed, Subject: "Slack backup run 7 failed"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Notify() error = %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Notify() returned after %v, want it to stop at the deadline", elapsed)
+	}
+}
+
+func TestCheckArchive(t *testing.T) {
+	now := time.Date(2024, 3, 4, 3, 5, 0, 0, time.UTC)
+	store := database.NewMemoryStore()
+	if err := store.InsertChannel(database.Channel{ID: "C1", Name: "general", ChannelType: "public_channel", CreatedAt: now}); err != nil {
+		t.Fatalf("Failed to insert channel: %v", err)
+	}
+	// The scheduled backup stopped running three days ago
+	if err := store.UpdateSyncState(database.SyncState{ChannelID: "C1", LastSyncAt: now.Add(-72 * time.Hour)}); err != nil {
+		t.Fatalf("UpdateSyncState() error = %v", err)
+	}
+	c := Checker{
+		Store:      store,
+		StaleAfter: 48 * time.Hour,
+		now:        func() time.Time { return now },
+	}
+
+	tests := []struct {
+		name        string
+		last        *database.BackupRun
+		wantSummary bool
+	}{
+		{"after a run", &testRun, true},
+		{"no runs", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifications, err := c.CheckArchive([]string{"C1"}, tt.last)
+			if err != nil {
+				t.Fatalf("CheckArchive() error = %v", err)
+			}
+			if len(notifications) != 1 || notifications[0].Kind != ChannelsStale {
+				t.Fatalf("CheckArchive() = %+v, want one stale channel alert", notifications)
+			}
+			n := notifications[0]
+			if !strings.Contains(n.Text, "C1 last backed up 2024-03-01T03:05:00Z (72h0m0s ago)") {
+				t.Errorf("Text = %q, want C1's last backup", n.Text)
+			}
+			if got := strings.Contains(n.Text, "Run 7 (scheduled)"); got != tt.wantSummary {
+				t.Errorf("Text = %q, run summary included = %v, want %v", n.Text, got, tt.wantSummary)
+			}
+		})
+	}
+
+	c.StaleAfter = 96 * time.Hour
+	if notifications, err := c.CheckArchive([]string{"C1"}, nil); err != nil || len(notifications) != 0 {
+		t.Errorf("CheckArchive() = %+v, %v, want no alerts within the threshold", notifications, err)
+	}
+}
+
+func TestPending(t *testing.T) {
+	now := time.Date(2024, 3, 4, 3, 5, 0, 0, time.UTC)
+	c := Checker{
+		StaleAfter:  48 * time.Hour,
+		StatePath:   filepath.Join(t.TempDir(), "alerts.json"),
+		RepeatAfter: 24 * time.Hour,
+		now:         func() time.Time { return now },
+	}
+	stale := func(channels string) Notification {
+		return c.notifier(nil)(ChannelsStale, channels, "Slack channels not backed up", "")
+	}
+	failed := testRun
+	failed.Status = database.RunFailed
+	succeeded := testRun
+	succeeded.Status = database.RunSucceeded
+
+	steps := []struct {
+		name   string
+		after  time.Duration
+		raised []Notification
+		last   *database.BackupRun
+		want   []string
+	}{
+		{"new", 0, []Notification{stale("C1")}, nil, []string{"Slack channels not backed up"}},
+		{"unchanged", time.Hour, []Notification{stale("C1")}, nil, nil},
+		{"due again", 24 * time.Hour, []Notification{stale("C1")}, nil, []string{"Slack channels not backed up"}},
+		{"changed", time.Hour, []Notification{stale("C1,C2")}, nil, []string{"Slack channels not backed up"}},
+		{"run failed", time.Hour, []Notification{stale("C1,C2"), c.notifier(&failed)(RunFailed, "failed: ", "Run failed", "")}, &failed, []string{"Run failed"}},
+		{"run still failing", time.Hour, nil, &failed, []string{"Resolved: Slack channels not backed up"}},
+		{"run succeeded", time.Hour, nil, &succeeded, []string{"Resolved: Run failed"}},
+		{"all clear", time.Hour, nil, &succeeded, nil},
+	}
+	for _, step := range steps {
+		now = now.Add(step.after)
+		pending := c.Pending(step.raised, step.last)
+		var got []string
+		for _, n := range pending {
+			got = append(got, n.Subject)
+			if n.Resolved != strings.HasPrefix(n.Subject, "Resolved: ") {
+				t.Errorf("%s: %q has Resolved = %v", step.name, n.Subject, n.Resolved)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(step.want, "|") {
+			t.Errorf("%s: Pending() = %q, want %q", step.name, got, step.want)
+		}
+		if err := c.Record(pending); err != nil {
+			t.Fatalf("%s: Record() error = %v", step.name, err)
+		}
+	}
+
+	// Without a state file nothing is held back
+	c.StatePath = ""
+	if pending := c.Pending([]Notification{stale("C1")}, nil); len(pending) != 1 {
+		t.Errorf("Pending() without state = %+v, want the alert", pending)
+	}
+}
@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// sentAlert is what the state file remembers about the last alert of a kind
+type sentAlert struct {
+	Condition string    `json:"condition"`
+	Subject   string    `json:"subject"`
+	Since     time.Time `json:"since"` // first alert while the condition held
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// Pending returns the notifications from Check or CheckArchive that need
+// sending, judged from the alerts recorded in StatePath: those whose
+// condition is new or has changed, those last sent over RepeatAfter ago, and
+// a resolved notification for each recorded alert whose condition has
+// cleared. last is the most recent run; a run_failed alert clears once one
+// succeeds. Without a StatePath every notification is pending.
+func (c Checker) Pending(notifications []Notification, last *database.BackupRun) []Notification {
+	if c.StatePath == "" {
+		return notifications
+	}
+	sent, err := readAlertState(c.StatePath)
+	if err != nil {
+		logger.Warn.Printf("Sending every alert: %v", err)
+		return notifications
+	}
+
+	now := c.clock()
+	var pending []Notification
+	raised := make(map[string]bool)
+	for _, n := range notifications {
+		raised[n.Kind] = true
+		prev, ok := sent[n.Kind]
+		if ok && prev.Condition == n.condition && (c.RepeatAfter <= 0 || now.Sub(prev.SentAt) < c.RepeatAfter) {
+			continue
+		}
+		pending = append(pending, n)
+	}
+
+	cleared := map[string]bool{
+		RunFailed:     last != nil && last.Status == database.RunSucceeded,
+		ChannelsStale: c.StaleAfter > 0,
+		DiskSpace:     c.MinFreePercent > 0,
+	}
+	newNotification := c.notifier(last)
+	for _, kind := range []string{RunFailed, ChannelsStale, DiskSpace} {
+		prev, ok := sent[kind]
+		if !ok || raised[kind] || !cleared[kind] {
+			continue
+		}
+		n := newNotification(kind, "", "Resolved: "+prev.Subject,
+			fmt.Sprintf("Alerted on since %s, cleared by %s\n",
+				prev.Since.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339)))
+		n.Resolved = true
+		pending = append(pending, n)
+	}
+	return pending
+}
+
+// Record remembers delivered notifications in StatePath so that Pending
+// holds them back until they change or are due again, and forgets alerts
+// that were resolved. It does nothing without a StatePath.
+func (c Checker) Record(delivered []Notification) error {
+	if c.StatePath == "" || len(delivered) == 0 {
+		return nil
+	}
+	sent, err := readAlertState(c.StatePath)
+	if err != nil {
+		return err
+	}
+
+	now := c.clock()
+	for _, n := range delivered {
+		if n.Resolved {
+			delete(sent, n.Kind)
+			continue
+		}
+		alert := sentAlert{Condition: n.condition, Subject: n.Subject, Since: now, SentAt: now}
+		if prev, ok := sent[n.Kind]; ok {
+			alert.Since = prev.Since
+		}
+		sent[n.Kind] = alert
+	}
+	return writeAlertState(c.StatePath, sent)
+}
+
+// readAlertState returns the recorded alerts by kind, none if the file
+// doesn't exist yet
+func readAlertState(path string) (map[string]sentAlert, error) {
+	sent := make(map[string]sentAlert)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sent, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert state: %w", err)
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		return nil, fmt.Errorf("failed to parse alert state %s: %w", path, err)
+	}
+	return sent, nil
+}
+
+// writeAlertState replaces the state file atomically, as backups and the
+// check timer may both update it
+func writeAlertState(path string, sent map[string]sentAlert) error {
+	data, err := json.MarshalIndent(sent, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode alert state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create alert state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace alert state: %w", err)
+	}
+	return nil
+}
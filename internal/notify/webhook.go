@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+// Webhook posts notifications as JSON to a URL
+type Webhook struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+// webhookPayload is the body Webhook posts
+type webhookPayload struct {
+	Kind     string     `json:"kind"`
+	Subject  string     `json:"subject"`
+	Text     string     `json:"text"`
+	Time     time.Time  `json:"time"`
+	Resolved bool       `json:"resolved"`
+	Run      webhookRun `json:"run"`
+}
+
+type webhookRun struct {
+	ID              int64               `json:"id"`
+	Trigger         string              `json:"trigger"`
+	Status          string              `json:"status"`
+	Error           string              `json:"error,omitempty"`
+	StartedAt       time.Time           `json:"started_at"`
+	FinishedAt      *time.Time          `json:"finished_at"`
+	Messages        int                 `json:"messages"`
+	Files           int                 `json:"files"`
+	BytesDownloaded int64               `json:"bytes_downloaded"`
+	APICalls        int64               `json:"api_calls"`
+	Channels        []webhookRunChannel `json:"channels"`
+}
+
+type webhookRunChannel struct {
+	ChannelID       string `json:"channel_id"`
+	Messages        int    `json:"messages"`
+	Files           int    `json:"files"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	Error           string `json:"error,omitempty"`
+}
+
+func newWebhookRun(run database.BackupRun) webhookRun {
+	r := webhookRun{
+		ID:              run.ID,
+		Trigger:         run.Trigger,
+		Status:          run.Status,
+		Error:           run.Error,
+		StartedAt:       run.StartedAt.UTC(),
+		Messages:        run.Messages(),
+		Files:           run.Files(),
+		BytesDownloaded: run.BytesDownloaded,
+		APICalls:        run.APICalls,
+		Channels:        []webhookRunChannel{},
+	}
+	if !run.FinishedAt.IsZero() {
+		finished := run.FinishedAt.UTC()
+		r.FinishedAt = &finished
+	}
+	for _, ch := range run.Channels {
+		r.Channels = append(r.Channels, webhookRunChannel(ch))
+	}
+	return r
+}
+
+func (w Webhook) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.Client, w.URL, webhookPayload{
+		Kind:     n.Kind,
+		Subject:  n.Subject,
+		Text:     n.Text,
+		Time:     n.Time.UTC(),
+		Resolved: n.Resolved,
+		Run:      newWebhookRun(n.Run),
+	})
+}
+
+// SlackWebhook posts notifications to a Slack incoming webhook
+type SlackWebhook struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (w SlackWebhook) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.Client, w.URL, map[string]string{
+		"text": fmt.Sprintf("*%s*\n```\n%s```", n.Subject, n.Text),
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to send notification: webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Package page holds what the web UI and the HTML export share in rendering
+// archive pages: the stylesheet and helpers for their templates
+package page
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/format"
+)
+
+// Stylesheet is the CSS shared by the web UI and the HTML export
+//
+//go:embed style.css
+var Stylesheet []byte
+
+// Reaction is the reactions to a message with one emoji
+type Reaction struct {
+	Emoji string // the emoji, or its shortcode if it isn't a standard one
+	Name  string // shortcode
+	Count int
+	Users string // comma-separated names of who reacted
+}
+
+// GroupReactions groups reactions by emoji in the order they were first
+// used, naming who reacted with userName
+func GroupReactions(reactions []database.Reaction, userName func(id string) string) []Reaction {
+	sorted := append([]database.Reaction(nil), reactions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+	var grouped []Reaction
+	index := make(map[string]int)
+	users := make(map[string][]string)
+	for _, r := range sorted {
+		i, ok := index[r.Emoji]
+		if !ok {
+			i = len(grouped)
+			index[r.Emoji] = i
+			grouped = append(grouped, Reaction{Emoji: format.EmojiOrShortcode(r.Emoji), Name: r.Emoji})
+		}
+		grouped[i].Count++
+		users[r.Emoji] = append(users[r.Emoji], userName(r.UserID))
+	}
+	for i := range grouped {
+		grouped[i].Users = strings.Join(users[grouped[i].Name], ", ")
+	}
+	return grouped
+}
+
+// Initial returns the first letter of name, capitalized, for avatars
+// without a picture
+func Initial(name string) string {
+	for _, r := range name {
+		return strings.ToUpper(string(r))
+	}
+	return "?"
+}
+
+// IsImage reports whether a Slack file type can be shown in an img tag
+func IsImage(fileType string) bool {
+	switch strings.ToLower(fileType) {
+	case "jpg", "jpeg", "png", "gif", "webp", "bmp":
+		return true
+	}
+	return false
+}
+
+// HumanSize formats a byte count with a binary unit, e.g. 2.0 KB
+func HumanSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
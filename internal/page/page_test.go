@@ -0,0 +1,59 @@
+package page
+
+import (
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+func TestGroupReactions(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	reactions := []database.Reaction{
+		{UserID: "U2", Emoji: "tada", Timestamp: base.Add(2 * time.Minute)},
+		{UserID: "U1", Emoji: "thumbsup", Timestamp: base},
+		{UserID: "U3", Emoji: "partyparrot", Timestamp: base.Add(3 * time.Minute)},
+		{UserID: "U2", Emoji: "thumbsup", Timestamp: base.Add(time.Minute)},
+	}
+	names := map[string]string{"U1": "alice", "U2": "bob"}
+	userName := func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return id
+	}
+
+	got := GroupReactions(reactions, userName)
+	want := []Reaction{
+		{Emoji: "👍", Name: "thumbsup", Count: 2, Users: "alice, bob"},
+		{Emoji: "🎉", Name: "tada", Count: 1, Users: "bob"},
+		{Emoji: ":partyparrot:", Name: "partyparrot", Count: 1, Users: "U3"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GroupReactions() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GroupReactions()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if reactions[0].Emoji != "tada" {
+		t.Error("GroupReactions() reordered its argument")
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{12, "12 B"},
+		{2048, "2.0 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+	}
+	for _, tt := range tests {
+		if got := HumanSize(tt.bytes); got != tt.want {
+			t.Errorf("HumanSize(%d) = %s, want %s", tt.bytes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// maxEventSize caps request bodies; Slack's payloads are far smaller
+	maxEventSize = 1 << 20
+	// signatureMaxAge is how far a request's timestamp may be from now
+	// before it's rejected as a possible replay
+	signatureMaxAge = 5 * time.Minute
+	// eventQueueSize is how many events can wait for the worker before
+	// requests are turned away for Slack to retry later
+	eventQueueSize = 1000
+)
+
+// eventQueue applies events to the archive in the order they arrive, on a
+// single worker so Slack gets its acknowledgement at once. Slack redelivers
+// events it thinks were missed; every write is an upsert, so applying one
+// twice is harmless.
+type eventQueue struct {
+	service  *SlackService
+	channels map[string]bool
+
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan func() error
+	done   chan struct{}
+}
+
+// newEventQueue starts a queue for events in the given channels
+func (s *SlackService) newEventQueue(channelIDs []string) *eventQueue {
+	q := &eventQueue{
+		service:  s,
+		channels: make(map[string]bool),
+		jobs:     make(chan func() error, eventQueueSize),
+		done:     make(chan struct{}),
+	}
+	for _, id := range channelIDs {
+		q.channels[id] = true
+	}
+
+	go func() {
+		defer close(q.done)
+		for job := range q.jobs {
+			if err := job(); err != nil {
+				logger.Error.Printf("Failed to apply Slack event: %v", err)
+			}
+			s.queued.Add(-1)
+		}
+	}()
+	return q
+}
+
+// Queued returns how many events, and the file downloads they bring, a
+// listener has yet to store, counting the one being stored
+func (s *SlackService) Queued() int64 {
+	return s.queued.Load()
+}
+
+// Close stops accepting events and waits for queued ones to be applied
+func (q *eventQueue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+// enqueue queues an event, reporting false if the queue is full or closed
+func (q *eventQueue) enqueue(event json.RawMessage) bool {
+	return q.push(func() error { return q.apply(event) })
+}
+
+// push queues work to run in order with the events
+func (q *eventQueue) push(job func() error) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	// Count the job before the worker can finish it
+	q.service.queued.Add(1)
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		q.service.queued.Add(-1)
+		return false
+	}
+}
+
+// EventHandler receives Slack Events API requests over HTTP and applies
+// them to the archive as they happen, so messages deleted before the next
+// backup are still captured
+type EventHandler struct {
+	*eventQueue
+	secret []byte
+	now    func() time.Time
+}
+
+// NewEventHandler returns a handler for events in the given channels that
+// verifies requests with the app's signing secret, and starts its worker
+func (s *SlackService) NewEventHandler(signingSecret string, channelIDs []string) *EventHandler {
+	return &EventHandler{
+		eventQueue: s.newEventQueue(channelIDs),
+		secret:     []byte(signingSecret),
+		now:        time.Now,
+	}
+}
+
+func (h *EventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+	if err := h.verify(r.Header, body); err != nil {
+		logger.Warn.Printf("Rejected Slack event request from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var envelope struct {
+		Type      string          `json:"type"`
+		Challenge string          `json:"challenge"`
+		EventID   string          `json:"event_id"`
+		Event     json.RawMessage `json:"event"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	switch envelope.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, envelope.Challenge)
+	case "event_callback":
+		if !h.enqueue(envelope.Event) {
+			logger.Warn.Printf("Event queue full, asking Slack to retry event %s", envelope.EventID)
+			http.Error(w, "Busy", http.StatusServiceUnavailable)
+			return
+		}
+		logger.Debug.Printf("Queued Slack event %s", envelope.EventID)
+		w.WriteHeader(http.StatusOK)
+	default:
+		logger.Debug.Printf("Ignoring Slack request of type %s", envelope.Type)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// verify checks Slack's request signature, an HMAC-SHA256 of the request
+// timestamp and body keyed with the signing secret
+func (h *EventHandler) verify(header http.Header, body []byte) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid request timestamp %q", timestamp)
+	}
+	if age := h.now().Sub(time.Unix(sec, 0)); age > signatureMaxAge || age < -signatureMaxAge {
+		return fmt.Errorf("request timestamp is %v away from now", age.Round(time.Second))
+	}
+
+	mac := hmac.New(sha256.New, h.secret)
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(want)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// messageEvent is a message event; edits and deletions are subtypes
+type messageEvent struct {
+	Channel         string         `json:"channel"`
+	SubType         string         `json:"subtype"`
+	Message         *slack.Message `json:"message"`
+	PreviousMessage *slack.Message `json:"previous_message"`
+	DeletedTS       string         `json:"deleted_ts"`
+}
+
+type reactionEvent struct {
+	User     string `json:"user"`
+	Reaction string `json:"reaction"`
+	Item     struct {
+		Type    string `json:"type"`
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	} `json:"item"`
+	EventTS string `json:"event_ts"`
+}
+
+// apply stores what an event describes, ignoring channels that aren't
+// being backed up
+func (q *eventQueue) apply(raw json.RawMessage) error {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+	s := q.service
+
+	switch head.Type {
+	case "message":
+		var ev messageEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("failed to decode message event: %w", err)
+		}
+		if !q.channels[ev.Channel] {
+			return nil
+		}
+		switch ev.SubType {
+		case "message_changed", "message_replied":
+			if ev.Message == nil {
+				return nil
+			}
+			// Deleting a thread parent leaves a tombstone in its place
+			if ev.Message.SubType == "tombstone" {
+				return s.markDeleted(ev.Channel, ev.Message.Timestamp, ev.PreviousMessage)
+			}
+			return s.storeEventMessage(ev.Channel, *ev.Message)
+		case "message_deleted":
+			return s.markDeleted(ev.Channel, ev.DeletedTS, ev.PreviousMessage)
+		default:
+			var msg slack.Message
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				return fmt.Errorf("failed to decode message event: %w", err)
+			}
+			return s.storeEventMessage(ev.Channel, msg)
+		}
+
+	case "reaction_added", "reaction_removed":
+		var ev reactionEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("failed to decode reaction event: %w", err)
+		}
+		if ev.Item.Type != "message" || !q.channels[ev.Item.Channel] {
+			return nil
+		}
+		reaction := database.Reaction{
+			MessageID: ev.Item.TS,
+			UserID:    ev.User,
+			Emoji:     ev.Reaction,
+			Timestamp: convertSlackTimestamp(ev.EventTS),
+		}
+		if head.Type == "reaction_removed" {
+			return s.db.DeleteReaction(reaction)
+		}
+		return s.storeReaction(reaction)
+
+	case "channel_rename":
+		var ev struct {
+			Channel struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"channel"`
+		}
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("failed to decode channel_rename event: %w", err)
+		}
+		if !q.channels[ev.Channel.ID] {
+			return nil
+		}
+		return s.renameChannel(ev.Channel.ID, ev.Channel.Name)
+
+	case "member_joined_channel":
+		var ev struct {
+			User    string `json:"user"`
+			Channel string `json:"channel"`
+		}
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("failed to decode member_joined_channel event: %w", err)
+		}
+		if !q.channels[ev.Channel] {
+			return nil
+		}
+		return storeUsers(s.db, map[string]struct{}{ev.User: {}})
+
+	case "file_shared":
+		var ev struct {
+			ChannelID string `json:"channel_id"`
+			FileID    string `json:"file_id"`
+		}
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("failed to decode file_shared event: %w", err)
+		}
+		if !q.channels[ev.ChannelID] {
+			return nil
+		}
+		return s.storeSharedFile(ev.ChannelID, ev.FileID)
+	}
+
+	logger.Debug.Printf("Ignoring Slack event of type %s", head.Type)
+	return nil
+}
+
+// storeEventMessage stores a message from an event along with its files.
+// Replies arrive as events of their own, so unlike processMessages it
+// doesn't fetch threads.
+func (s *SlackService) storeEventMessage(channelID string, msg slack.Message) error {
+	c := s.newCollector(logger.With("channel", channelID))
+	messages := []slack.Message{msg}
+	if err := c.storeMessages(channelID, messages); err != nil {
+		return err
+	}
+	c.processFiles(channelID, messages[0])
+	c.log.Log.Debug("Stored message from event", "ts", msg.Timestamp)
+	return nil
+}
+
+// markDeleted flags a message as deleted, keeping its content. If it was
+// deleted before a backup saw it, the copy Slack sends along with the
+// deletion is stored instead.
+func (s *SlackService) markDeleted(channelID, ts string, previous *slack.Message) error {
+	filter := database.MessageFilter{ChannelIDs: []string{channelID}, MessageIDs: []string{ts}}
+	found, err := s.db.GetMessages(filter)
+	if err != nil {
+		return fmt.Errorf("failed to look up deleted message %s: %w", ts, err)
+	}
+
+	if len(found) == 0 {
+		if previous == nil {
+			logger.Log.Warn("Message was deleted before it could be captured", "channel", channelID, "ts", ts)
+			return nil
+		}
+		if previous.Timestamp == "" {
+			previous.Timestamp = ts
+		}
+		c := s.newCollector(logger.With("channel", channelID))
+		if err := c.storeMessages(channelID, []slack.Message{*previous}); err != nil {
+			return err
+		}
+		if found, err = s.db.GetMessages(filter); err != nil {
+			return fmt.Errorf("failed to look up deleted message %s: %w", ts, err)
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("deleted message %s was not stored", ts)
+		}
+	}
+
+	msg := found[0]
+	msg.IsDeleted = true
+	if err := s.db.InsertMessage(msg); err != nil {
+		return fmt.Errorf("failed to mark message %s deleted: %w", ts, err)
+	}
+	logger.Log.Info("Recorded deletion of message", "channel", channelID, "ts", ts)
+	return nil
+}
+
+// storeReaction records a reaction with the time it was added. Reactions
+// on messages not yet captured are left for the next backup to collect.
+func (s *SlackService) storeReaction(reaction database.Reaction) error {
+	exists, err := s.db.MessageExists(reaction.MessageID)
+	if err != nil {
+		return fmt.Errorf("failed to check message existence: %w", err)
+	}
+	if !exists {
+		logger.Log.Debug("Skipping reaction on uncaptured message", "ts", reaction.MessageID)
+		return nil
+	}
+
+	return s.db.Batch(func(tx database.Writer) error {
+		if err := storeUsers(tx, map[string]struct{}{reaction.UserID: {}}); err != nil {
+			return err
+		}
+		return tx.InsertReaction(reaction)
+	})
+}
+
+func (s *SlackService) renameChannel(channelID, name string) error {
+	channels, err := s.db.GetChannels()
+	if err != nil {
+		return fmt.Errorf("failed to get channels: %w", err)
+	}
+	for _, ch := range channels {
+		if ch.ID != channelID {
+			continue
+		}
+		logger.Log.Info("Channel renamed", "channel", channelID, "from", ch.Name, "to", name)
+		ch.Name = name
+		return s.db.InsertChannel(ch)
+	}
+	return nil
+}
+
+// storeSharedFile downloads a file shared into a channel unless it was
+// already stored with its message. Files shared into messages not yet
+// captured are left for the message to bring along.
+func (s *SlackService) storeSharedFile(channelID, fileID string) error {
+	file, err := s.client.GetFileInfo(fileID)
+	if err != nil {
+		return err
+	}
+
+	shares := append(file.Shares.Public[channelID], file.Shares.Private[channelID]...)
+	for _, share := range shares {
+		exists, err := s.db.MessageExists(share.Ts)
+		if err != nil {
+			return fmt.Errorf("failed to check message existence: %w", err)
+		}
+		if !exists {
+			continue
+		}
+
+		stored, err := s.db.GetFiles(database.MessageFilter{MessageIDs: []string{share.Ts}})
+		if err != nil {
+			return fmt.Errorf("failed to get files: %w", err)
+		}
+		known := false
+		for _, f := range stored {
+			known = known || f.ID == fileID
+		}
+		if !known {
+			s.newCollector(logger.With("channel", channelID)).processFiles(channelID, slack.Message{Msg: slack.Msg{Timestamp: share.Ts, Files: []slack.File{*file}}})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+	slackclient "backup_slack/internal/slack"
+
+	"github.com/slack-go/slack"
+)
+
+// testSigningSecret signed the requests recorded in testdata/events
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// readRecordedRequest loads a raw HTTP request recorded from Slack
+func readRecordedRequest(t *testing.T, path string) *http.Request {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	t.Cleanup(func() { f.Close() })
+	req, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		t.Fatalf("Failed to read request %s: %v", path, err)
+	}
+	return req
+}
+
+// newEventTestService returns a service whose Slack API and file downloads
+// are served by a fake: files.info describes F1 as shared in message
+// 1700000100.000100
+func newEventTestService(t *testing.T) (*SlackService, database.Store) {
+	t.Helper()
+	if err := logger.Init(t.TempDir(), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files.info":
+			fmt.Fprintf(w, `{"ok":true,"file":{"id":"F1","name":"notes.txt","filetype":"text","size":11,
+				"url_private_download":%q,
+				"shares":{"public":{"C123456":[{"ts":"1700000100.000100"}]}}}}`, api.URL+"/download/F1")
+		case "/download/F1":
+			io.WriteString(w, "field notes")
+		case "/conversations.history":
+			// One message, sent while a Socket Mode connection was down
+			if r.FormValue("latest") != "" {
+				io.WriteString(w, `{"ok":true,"messages":[]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"ok":true,"messages":[{"type":"message","user":"U1","text":"missed","ts":"1700000200.000100",
+				"files":[{"id":"F1","name":"notes.txt","filetype":"text","size":11,"url_private_download":%q}]}]}`,
+				api.URL+"/download/F1")
+		case "/auth.test":
+			io.WriteString(w, `{"ok":true,"user":"backup","team":"Example"}`)
+		case "/conversations.list":
+			io.WriteString(w, `{"ok":true,"channels":[{"id":"C123456","name":"general","created":1700000000}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(api.Close)
+
+	store := database.NewMemoryStore()
+	if err := store.InsertChannel(database.Channel{
+		ID:          "C123456",
+		Name:        "general",
+		ChannelType: "public_channel",
+		CreatedAt:   time.Unix(1700000000, 0),
+	}); err != nil {
+		t.Fatalf("Failed to insert channel: %v", err)
+	}
+
+	fileService, err := NewFileService(t.TempDir(), 1024*1024, store, "xoxb-test")
+	if err != nil {
+		t.Fatalf("NewFileService() error = %v", err)
+	}
+	s := &SlackService{
+		client:      slackclient.NewClient("xoxb-test", slack.OptionAPIURL(api.URL+"/")),
+		db:          store,
+		fileService: fileService,
+	}
+	return s, store
+}
+
+func TestEventHandler(t *testing.T) {
+	s, store := newEventTestService(t)
+	h := s.NewEventHandler(testSigningSecret, []string{"C123456"})
+	h.now = func() time.Time { return time.Unix(1700000500, 0) }
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "events", "*.http"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("No recorded events found: %v", err)
+	}
+	for _, path := range paths {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, readRecordedRequest(t, path))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %q", filepath.Base(path), rec.Code, rec.Body.String())
+		}
+		if strings.Contains(path, "url-verification") && rec.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+			t.Errorf("url_verification body = %q, want the challenge", rec.Body.String())
+		}
+	}
+	h.Close()
+	if n := s.Queued(); n != 0 {
+		t.Errorf("Queued() = %d after Close, want 0", n)
+	}
+
+	messages, err := store.GetMessages(database.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	byID := make(map[string]database.Message)
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+	}
+	if len(messages) != 3 {
+		t.Errorf("Stored %d messages, want 3 (other channels ignored)", len(messages))
+	}
+
+	if msg := byID["1700000100.000100"]; msg.Content != "hello, edited" || !msg.LastEdited.Valid || msg.IsDeleted {
+		t.Errorf("Edited message = %+v, want new text and edit time", msg)
+	}
+	if msg := byID["1700000200.000100"]; msg.Content != "my secret reply" || !msg.IsDeleted ||
+		msg.ThreadTS.String != "1700000100.000100" {
+		t.Errorf("Deleted reply = %+v, want content kept and marked deleted", msg)
+	}
+	if msg := byID["1700000310.000100"]; msg.Content != "posted and deleted" || !msg.IsDeleted || msg.UserID != "U2" {
+		t.Errorf("Message deleted before capture = %+v, want stored from previous_message", msg)
+	}
+
+	reactions, err := store.GetReactions(database.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetReactions() error = %v", err)
+	}
+	if len(reactions) != 1 || reactions[0].Emoji != "eyes" || !reactions[0].Timestamp.Equal(time.Unix(1700000260, 0)) {
+		t.Errorf("Reactions = %+v, want eyes at its event time and tada removed", reactions)
+	}
+
+	channels, err := store.GetChannels()
+	if err != nil {
+		t.Fatalf("GetChannels() error = %v", err)
+	}
+	if len(channels) != 1 || channels[0].Name != "town-square" {
+		t.Errorf("Channels = %+v, want general renamed to town-square", channels)
+	}
+
+	users, err := store.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 4 || users[3].ID != "U4" {
+		t.Errorf("Users = %+v, want the authors, U3 who reacted and U4 who joined", users)
+	}
+
+	files, err := store.GetFiles(database.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetFiles() error = %v", err)
+	}
+	if len(files) != 1 || files[0].ID != "F1" || files[0].Checksum == "" {
+		t.Fatalf("Files = %+v, want F1 downloaded", files)
+	}
+	if data, err := os.ReadFile(files[0].LocalPath); err != nil || string(data) != "field notes" {
+		t.Errorf("Downloaded file = %q, %v", data, err)
+	}
+}
+
+func TestEventHandlerRejects(t *testing.T) {
+	s, _ := newEventTestService(t)
+	h := s.NewEventHandler(testSigningSecret, []string{"C123456"})
+	defer h.Close()
+	path := filepath.Join("testdata", "events", "02-message.http")
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		modify func(r *http.Request)
+		status int
+	}{
+		{"Valid", time.Unix(1700000500, 0), func(r *http.Request) {}, http.StatusOK},
+		{"Stale", time.Unix(1700000402, 0).Add(6 * time.Minute), func(r *http.Request) {}, http.StatusUnauthorized},
+		{"Bad signature", time.Unix(1700000500, 0), func(r *http.Request) {
+			r.Header.Set("X-Slack-Signature", "v0=0000")
+		}, http.StatusUnauthorized},
+		{"Missing timestamp", time.Unix(1700000500, 0), func(r *http.Request) {
+			r.Header.Del("X-Slack-Request-Timestamp")
+		}, http.StatusUnauthorized},
+		{"Tampered body", time.Unix(1700000500, 0), func(r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			body = []byte(strings.Replace(string(body), "hello", "HELLO", 1))
+			r.Body = io.NopCloser(strings.NewReader(string(body)))
+		}, http.StatusUnauthorized},
+		{"Wrong method", time.Unix(1700000500, 0), func(r *http.Request) { r.Method = http.MethodGet }, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.now = func() time.Time { return tt.now }
+			req := readRecordedRequest(t, path)
+			tt.modify(req)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestEventHandlerMarksTombstones(t *testing.T) {
+	s, store := newEventTestService(t)
+	if err := s.newCollector(logger.With()).storeMessages("C123456", []slack.Message{{Msg: slack.Msg{
+		Timestamp: "1700000100.000100", ThreadTimestamp: "1700000100.000100", User: "U1", Text: "parent",
+	}}}); err != nil {
+		t.Fatalf("storeMessages() error = %v", err)
+	}
+
+	h := s.NewEventHandler(testSigningSecret, []string{"C123456"})
+	event, _ := json.Marshal(map[string]interface{}{
+		"type": "message", "subtype": "message_changed", "channel": "C123456",
+		"message": map[string]interface{}{
+			"type": "message", "subtype": "tombstone", "text": "This message was deleted.",
+			"ts": "1700000100.000100", "thread_ts": "1700000100.000100",
+		},
+	})
+	if err := h.apply(event); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	h.Close()
+
+	msgs, err := store.GetMessages(database.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Content != "parent" || !msgs[0].IsDeleted {
+		t.Errorf("Messages = %+v, want parent kept and marked deleted", msgs)
+	}
+}
@@ -6,16 +6,17 @@ import (
 	"backup_slack/internal/database"
 	"backup_slack/internal/files"
 	"backup_slack/internal/logger"
+	"backup_slack/internal/metrics"
 )
 
 type FileService struct {
 	storage    *files.FileStorage
 	downloader *files.Downloader
-	db         *database.DB
+	db         database.Store
 	token      string
 }
 
-func NewFileService(basePath string, maxFileSize int64, db *database.DB, token string) (*FileService, error) {
+func NewFileService(basePath string, maxFileSize int64, db database.Store, token string) (*FileService, error) {
 	storage, err := files.NewFileStorage(basePath, maxFileSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file storage: %w", err)
@@ -29,20 +30,23 @@ func NewFileService(basePath string, maxFileSize int64, db *database.DB, token s
 	}, nil
 }
 
-// ProcessFile handles the complete file processing pipeline
-func (s *FileService) ProcessFile(slackFile database.File) error {
+// ProcessFile handles the complete file processing pipeline. It returns
+// the number of bytes downloaded, which is 0 when an identical file was
+// already stored.
+func (s *FileService) ProcessFile(slackFile database.File) (int64, error) {
 	// Check for duplicates first
 	duplicates, err := s.db.GetDuplicateFiles(slackFile.Checksum)
 	if err != nil {
-		return fmt.Errorf("failed to check duplicates: %w", err)
+		return 0, fmt.Errorf("failed to check duplicates: %w", err)
 	}
 
+	var downloaded int64
 	if len(duplicates) > 0 && slackFile.Checksum != "" {
 		// Use existing file via hard link
 		logger.Info.Printf("Found duplicate for file %s, creating hard link", slackFile.FileName)
 		err := s.storage.HandleDuplicate(duplicates[0].LocalPath, slackFile.LocalPath)
 		if err != nil {
-			return fmt.Errorf("failed to handle duplicate: %w", err)
+			return 0, fmt.Errorf("failed to handle duplicate: %w", err)
 		}
 	} else {
 		// Download new file
@@ -59,19 +63,21 @@ func (s *FileService) ProcessFile(slackFile database.File) error {
 
 		checksum, err := s.downloader.DownloadFile(metadata, s.token)
 		if err != nil {
-			return fmt.Errorf("failed to download file: %w", err)
+			metrics.DownloadFailures.Inc()
+			return 0, fmt.Errorf("failed to download file: %w", err)
 		}
 
 		// Update file metadata with calculated checksum
 		slackFile.Checksum = checksum
+		downloaded = slackFile.SizeBytes
 	}
 
 	// Store file metadata in database
 	if err := s.db.InsertFile(slackFile); err != nil {
-		return fmt.Errorf("failed to store file metadata: %w", err)
+		return 0, fmt.Errorf("failed to store file metadata: %w", err)
 	}
 
-	return nil
+	return downloaded, nil
 }
 
 // CleanupOrphanedFiles removes files without associated messages
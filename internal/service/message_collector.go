@@ -6,13 +6,29 @@ import (
 
 	"backup_slack/internal/database"
 	"backup_slack/internal/logger"
+	"backup_slack/internal/metrics"
 	"database/sql"
 
 	"github.com/slack-go/slack"
 )
 
-// CollectMessages fetches and stores messages for the specified channel
-func (s *SlackService) CollectMessages(channelID string) (int, error) {
+// collector stores messages on behalf of a backup, a catch-up or an event.
+// Its log lines carry the fields of that work, such as the run ID and
+// channel, without affecting anything running alongside it. During a
+// backup run, what it stores is counted in the run's tally.
+type collector struct {
+	*SlackService
+	log   *logger.Logger
+	tally *runTally // nil outside backup runs
+}
+
+func (s *SlackService) newCollector(log *logger.Logger) collector {
+	return collector{SlackService: s, log: log}
+}
+
+// collectMessages fetches and stores messages for the specified channel,
+// going back to oldest or, if it is empty, to the start of the channel
+func (c collector) collectMessages(channelID, oldest string) (int, error) {
 	var (
 		latest        string // Will hold the oldest timestamp from previous batch
 		totalMessages = 0
@@ -21,15 +37,15 @@ func (s *SlackService) CollectMessages(channelID string) (int, error) {
 
 	for {
 		// Use latest as timestamp cursor to get next older batch of messages
-		messages, _, err := s.client.GetChannelMessages(channelID, latest, "")
+		messages, _, err := c.client.GetChannelMessages(channelID, oldest, latest, "")
 		if err != nil {
 			return totalMessages, fmt.Errorf("failed to fetch messages: %w", err)
 		}
 
-		logger.Debug.Printf("Retrieved %d messages for channel %s", len(messages), channelID)
+		c.log.Debug.Printf("Retrieved %d messages for channel %s", len(messages), channelID)
 
 		if len(messages) == 0 {
-			logger.Debug.Printf("No more messages to fetch for channel %s", channelID)
+			c.log.Debug.Printf("No more messages to fetch for channel %s", channelID)
 			break
 		}
 
@@ -45,10 +61,10 @@ func (s *SlackService) CollectMessages(channelID string) (int, error) {
 		// Check for messages we've already processed
 		var newMessages []slack.Message
 		for _, msg := range messages {
-			if exists, err := s.db.MessageExists(msg.Timestamp); err != nil {
+			if exists, err := c.db.MessageExists(msg.Timestamp); err != nil {
 				return totalMessages, fmt.Errorf("failed to check message existence: %w", err)
 			} else if exists {
-				logger.Debug.Printf("Found existing message (ts: %s), continuing to older messages", msg.Timestamp)
+				c.log.Debug.Printf("Found existing message (ts: %s), continuing to older messages", msg.Timestamp)
 				continue
 			}
 
@@ -59,11 +75,11 @@ func (s *SlackService) CollectMessages(channelID string) (int, error) {
 		}
 
 		if len(newMessages) > 0 {
-			if err := s.processMessages(channelID, newMessages); err != nil {
+			if err := c.processMessages(channelID, newMessages); err != nil {
 				return totalMessages, fmt.Errorf("failed to process messages: %w", err)
 			}
 			totalMessages += len(newMessages)
-			logger.Debug.Printf("Processed %d new messages, total so far: %d", len(newMessages), totalMessages)
+			c.log.Debug.Printf("Processed %d new messages, total so far: %d", len(newMessages), totalMessages)
 		}
 
 		// Add a small delay to prevent hitting rate limits too aggressively
@@ -73,109 +89,149 @@ func (s *SlackService) CollectMessages(channelID string) (int, error) {
 	return totalMessages, nil
 }
 
-func (s *SlackService) processMessages(channelID string, messages []slack.Message) error {
-	// First, collect and store all unique users
-	users := make(map[string]struct{})
+func (c collector) processMessages(channelID string, messages []slack.Message) error {
+	if err := c.storeMessages(channelID, messages); err != nil {
+		return err
+	}
+
+	// Threads and files need network calls, so they are handled once the page
+	// has been committed rather than while holding the transaction open
 	for _, msg := range messages {
-		if msg.User != "" {
-			users[msg.User] = struct{}{}
+		// If message is part of a thread, fetch replies
+		if msg.ThreadTimestamp != "" && msg.ThreadTimestamp == msg.Timestamp {
+			if err := c.collectThreadReplies(channelID, msg.ThreadTimestamp); err != nil {
+				c.log.Error.Printf("Failed to collect thread replies: %v", err)
+			}
 		}
+
+		c.processFiles(channelID, msg)
 	}
 
-	logger.Debug.Printf("Channel %s: Found %d unique users in messages", channelID, len(users))
+	return nil
+}
 
-	// Store users before processing messages
-	if err := s.storeUsers(users); err != nil {
-		return fmt.Errorf("failed to store users: %w", err)
+// storeMessages writes a page of messages with their authors and reactions
+// in one transaction
+func (c collector) storeMessages(channelID string, messages []slack.Message) error {
+	// Handle bot messages or messages without user IDs before collecting users,
+	// so the bot/unknown authors are stored alongside everyone else
+	for i := range messages {
+		if messages[i].User != "" {
+			continue
+		}
+		if messages[i].BotID != "" {
+			messages[i].User = messages[i].BotID
+			c.log.Debug.Printf("Using bot ID %s as user ID for message", messages[i].BotID)
+		} else {
+			messages[i].User = "UNKNOWN"
+			c.log.Debug.Printf("No user ID found for message, using UNKNOWN")
+		}
 	}
 
-	// Now process messages
-	for i, msg := range messages {
-		logger.Debug.Printf("Channel %s: Processing message %d/%d (ts: %s, user: %s)",
-			channelID, i+1, len(messages), msg.Timestamp, msg.User)
-
-		// Handle bot messages or messages without user IDs
-		if msg.User == "" {
-			if msg.BotID != "" {
-				msg.User = msg.BotID
-				logger.Debug.Printf("Using bot ID %s as user ID for message", msg.BotID)
-			} else {
-				msg.User = "UNKNOWN"
-				logger.Debug.Printf("No user ID found for message, using UNKNOWN")
-			}
-			// Store the bot/unknown user
-			if err := s.db.InsertUser(database.User{
-				ID:        msg.User,
-				Username:  msg.User,
-				FirstSeen: time.Now(),
-			}); err != nil {
-				logger.Error.Printf("Failed to store system user %s: %v", msg.User, err)
-				return fmt.Errorf("failed to store system user: %w", err)
+	// First, collect all unique users, including anyone who reacted
+	users := make(map[string]struct{})
+	for _, msg := range messages {
+		users[msg.User] = struct{}{}
+		for _, reaction := range msg.Reactions {
+			for _, userID := range reaction.Users {
+				users[userID] = struct{}{}
 			}
 		}
+	}
 
-		dbMsg := database.Message{
-			ID:        msg.Timestamp, // Slack uses timestamps as message IDs
-			ChannelID: channelID,
-			UserID:    msg.User,
-			Content:   msg.Text,
-			Timestamp: convertSlackTimestamp(msg.Timestamp),
-			ThreadTS: sql.NullString{
-				String: msg.ThreadTimestamp,
-				Valid:  msg.ThreadTimestamp != "",
-			},
-			MessageType: "message", // Default type
-		}
+	c.log.Debug.Printf("Channel %s: Found %d unique users in messages", channelID, len(users))
 
-		if msg.Edited != nil {
-			dbMsg.LastEdited = sql.NullTime{
-				Time:  convertSlackTimestamp(msg.Edited.Timestamp),
-				Valid: true,
-			}
+	// Store users and messages for the whole page in one transaction
+	err := c.db.Batch(func(tx database.Writer) error {
+		if err := storeUsers(tx, users); err != nil {
+			return fmt.Errorf("failed to store users: %w", err)
 		}
 
-		if err := s.db.InsertMessage(dbMsg); err != nil {
-			return fmt.Errorf("failed to store message (ts: %s, user: %s): %w",
-				msg.Timestamp, msg.User, err)
-		}
+		for i, msg := range messages {
+			c.log.Log.Debug(fmt.Sprintf("Processing message %d/%d", i+1, len(messages)),
+				"ts", msg.Timestamp, "user", msg.User)
 
-		// If message is part of a thread, fetch replies
-		if msg.ThreadTimestamp != "" && msg.ThreadTimestamp == msg.Timestamp {
-			if err := s.collectThreadReplies(channelID, msg.ThreadTimestamp); err != nil {
-				logger.Error.Printf("Failed to collect thread replies: %v", err)
-				continue
+			dbMsg := database.Message{
+				ID:        msg.Timestamp, // Slack uses timestamps as message IDs
+				ChannelID: channelID,
+				UserID:    msg.User,
+				Content:   msg.Text,
+				Timestamp: convertSlackTimestamp(msg.Timestamp),
+				ThreadTS: sql.NullString{
+					String: msg.ThreadTimestamp,
+					Valid:  msg.ThreadTimestamp != "",
+				},
+				MessageType: "message", // Default type
 			}
-		}
 
-		// Process files attached to messages
-		if len(msg.Files) > 0 {
-			for _, file := range msg.Files {
-				dbFile := database.File{
-					ID:              file.ID,
-					MessageID:       msg.Timestamp,
-					OriginalURL:     file.URLPrivateDownload,
-					LocalPath:       s.fileService.storage.GenerateFilePath(channelID, file.ID, file.Filetype, convertSlackTimestamp(msg.Timestamp)),
-					FileName:        file.Name,
-					FileType:        file.Filetype,
-					SizeBytes:       int64(file.Size),
-					UploadTimestamp: convertSlackTimestamp(msg.Timestamp),
-					Checksum:        "", // Will be set after download
+			if msg.Edited != nil {
+				dbMsg.LastEdited = sql.NullTime{
+					Time:  convertSlackTimestamp(msg.Edited.Timestamp),
+					Valid: true,
 				}
+			}
+
+			if err := tx.InsertMessage(dbMsg); err != nil {
+				return fmt.Errorf("failed to store message (ts: %s, user: %s): %w",
+					msg.Timestamp, msg.User, err)
+			}
 
-				if err := s.fileService.ProcessFile(dbFile); err != nil {
-					logger.Error.Printf("Failed to process file %s: %v", file.ID, err)
-					continue
+			// Slack doesn't report when a reaction was added, so record when
+			// we first saw it
+			for _, reaction := range msg.Reactions {
+				for _, userID := range reaction.Users {
+					if err := tx.InsertReaction(database.Reaction{
+						MessageID: msg.Timestamp,
+						UserID:    userID,
+						Emoji:     reaction.Name,
+						Timestamp: time.Now(),
+					}); err != nil {
+						return fmt.Errorf("failed to store reaction %s on message %s: %w",
+							reaction.Name, msg.Timestamp, err)
+					}
 				}
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	metrics.MessagesStored.Add(float64(len(messages)), channelID)
+	c.tally.addMessages(channelID, len(messages))
 	return nil
 }
 
-func (s *SlackService) storeUsers(users map[string]struct{}) error {
+// processFiles downloads the files attached to a stored message
+func (c collector) processFiles(channelID string, msg slack.Message) {
+	for _, file := range msg.Files {
+		dbFile := database.File{
+			ID:              file.ID,
+			MessageID:       msg.Timestamp,
+			OriginalURL:     file.URLPrivateDownload,
+			LocalPath:       c.fileService.storage.GenerateFilePath(channelID, file.ID, file.Filetype, convertSlackTimestamp(msg.Timestamp)),
+			FileName:        file.Name,
+			FileType:        file.Filetype,
+			SizeBytes:       int64(file.Size),
+			UploadTimestamp: convertSlackTimestamp(msg.Timestamp),
+			Checksum:        "", // Will be set after download
+		}
+
+		downloaded, err := c.fileService.ProcessFile(dbFile)
+		if err != nil {
+			c.log.Log.Error("Failed to process file", "file", file.ID, "ts", msg.Timestamp, "error", err)
+			continue
+		}
+		metrics.FilesStored.Inc(channelID)
+		metrics.FileBytes.Add(float64(dbFile.SizeBytes), channelID)
+		c.tally.addFile(channelID, downloaded)
+	}
+}
+
+func storeUsers(tx database.Writer, users map[string]struct{}) error {
 	for userID := range users {
-		err := s.db.InsertUser(database.User{
+		err := tx.InsertUser(database.User{
 			ID:        userID,
 			Username:  userID, // We'll just use ID as username initially
 			FirstSeen: time.Now(),
@@ -188,18 +244,18 @@ func (s *SlackService) storeUsers(users map[string]struct{}) error {
 	return nil
 }
 
-func (s *SlackService) collectThreadReplies(channelID, threadTS string) error {
+func (c collector) collectThreadReplies(channelID, threadTS string) error {
 	maxRetries := 3
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		replies, err := s.client.GetMessageReplies(channelID, threadTS)
+		replies, err := c.client.GetMessageReplies(channelID, threadTS)
 		if err != nil {
-			logger.Warn.Printf("Attempt %d/%d: Failed to collect thread replies: %v",
+			c.log.Warn.Printf("Attempt %d/%d: Failed to collect thread replies: %v",
 				attempt+1, maxRetries, err)
 			time.Sleep(time.Second * time.Duration(1<<uint(attempt)))
 			continue
 		}
 		if len(replies) > 1 {
-			return s.processMessages(channelID, replies[1:])
+			return c.processMessages(channelID, replies[1:])
 		}
 		return nil
 	}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+
+	"github.com/slack-go/slack"
+)
+
+func TestProcessMessages(t *testing.T) {
+	if err := logger.Init(t.TempDir(), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	store := database.NewMemoryStore()
+	if err := store.InsertChannel(database.Channel{
+		ID:          "C123456",
+		Name:        "general",
+		ChannelType: "public_channel",
+		CreatedAt:   time.Unix(1700000000, 0),
+	}); err != nil {
+		t.Fatalf("Failed to insert channel: %v", err)
+	}
+
+	s := &SlackService{db: store}
+
+	messages := []slack.Message{
+		{Msg: slack.Msg{
+			Timestamp: "1700000100.000100",
+			User:      "U1",
+			Text:      "hello",
+			Reactions: []slack.ItemReaction{{Name: "wave", Count: 1, Users: []string{"U2"}}},
+		}},
+		{Msg: slack.Msg{Timestamp: "1700000200.000100", BotID: "B1", Text: "from a bot"}},
+		{Msg: slack.Msg{Timestamp: "1700000300.000100", Text: "nobody"}},
+	}
+
+	if err := s.newCollector(logger.With()).processMessages("C123456", messages); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+
+	stored, err := store.GetMessages(database.MessageFilter{ChannelIDs: []string{"C123456"}})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	if len(stored) != 3 {
+		t.Fatalf("Stored %d messages, want 3", len(stored))
+	}
+
+	wantUsers := []string{"U1", "B1", "UNKNOWN"}
+	for i, msg := range stored {
+		if msg.UserID != wantUsers[i] {
+			t.Errorf("Message %s user = %s, want %s", msg.ID, msg.UserID, wantUsers[i])
+		}
+	}
+
+	users, err := store.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 4 {
+		t.Errorf("Stored %d users, want 4 (authors plus reacting user)", len(users))
+	}
+
+	reactions, err := store.GetReactions(database.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetReactions() error = %v", err)
+	}
+	if len(reactions) != 1 || reactions[0].UserID != "U2" || reactions[0].Emoji != "wave" {
+		t.Errorf("GetReactions() = %+v, want U2 reacting with wave", reactions)
+	}
+}
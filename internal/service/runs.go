@@ -0,0 +1,144 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// runTally counts what a backup run stores from each channel. Its methods
+// are no-ops on a nil tally, so storage code can record unconditionally.
+type runTally struct {
+	mu       sync.Mutex
+	channels map[string]*database.BackupRunChannel
+}
+
+func newRunTally() *runTally {
+	return &runTally{channels: make(map[string]*database.BackupRunChannel)}
+}
+
+func (t *runTally) channel(channelID string) *database.BackupRunChannel {
+	ch, ok := t.channels[channelID]
+	if !ok {
+		ch = &database.BackupRunChannel{ChannelID: channelID}
+		t.channels[channelID] = ch
+	}
+	return ch
+}
+
+func (t *runTally) addMessages(channelID string, n int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel(channelID).Messages += n
+}
+
+func (t *runTally) addFile(channelID string, downloaded int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch := t.channel(channelID)
+	ch.Files++
+	ch.BytesDownloaded += downloaded
+}
+
+func (t *runTally) fail(channelID string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel(channelID).Error = err.Error()
+}
+
+// RunBackup backs up the given channels and records the run in the
+// archive's run history: when it ran, what triggered it, what was stored
+// from each channel and what went wrong. The run is recorded even when it
+// fails. An error is returned only if the run couldn't start or be
+// recorded; channels that fail are logged and the rest are still backed up.
+func (s *SlackService) RunBackup(trigger string, channelIDs []string) (database.BackupRun, error) {
+	run := database.BackupRun{
+		StartedAt: time.Now(),
+		Trigger:   trigger,
+		Status:    database.RunRunning,
+	}
+	id, err := s.db.SaveBackupRun(run)
+	if err != nil {
+		return run, fmt.Errorf("failed to record backup run: %w", err)
+	}
+	run.ID = id
+	log := logger.With("run_id", run.ID)
+	log.Info.Printf("Started backup run %d (%s)", run.ID, trigger)
+
+	tally := newRunTally()
+	callsBefore := s.client.APICalls()
+
+	runErr := s.backupChannels(log, tally, channelIDs)
+
+	run.FinishedAt = time.Now()
+	run.APICalls = s.client.APICalls() - callsBefore
+	failed := 0
+	for _, channelID := range channelIDs {
+		ch := *tally.channel(channelID)
+		if ch.Error != "" {
+			failed++
+		}
+		run.BytesDownloaded += ch.BytesDownloaded
+		run.Channels = append(run.Channels, ch)
+	}
+
+	switch {
+	case runErr != nil:
+		run.Status = database.RunFailed
+		run.Error = runErr.Error()
+	case failed == len(channelIDs) && failed > 0:
+		run.Status = database.RunFailed
+		run.Error = "all channels failed"
+	case failed > 0:
+		run.Status = database.RunPartial
+		run.Error = fmt.Sprintf("%d of %d channels failed", failed, len(channelIDs))
+	default:
+		run.Status = database.RunSucceeded
+	}
+
+	if _, err := s.db.SaveBackupRun(run); err != nil {
+		return run, fmt.Errorf("failed to record end of backup run %d: %w", run.ID, err)
+	}
+	log.Info.Printf("Backup run %d %s in %v: %d messages and %d files from %d channels, %d API calls",
+		run.ID, run.Status, run.FinishedAt.Sub(run.StartedAt).Round(time.Second),
+		run.Messages(), run.Files(), len(channelIDs), run.APICalls)
+	return run, runErr
+}
+
+// backupChannels initializes the channels and backs each one up, recording
+// per-channel failures in the run tally
+func (s *SlackService) backupChannels(log *logger.Logger, tally *runTally, channelIDs []string) error {
+	if err := s.Initialize(channelIDs); err != nil {
+		return fmt.Errorf("failed to initialize channels: %w", err)
+	}
+	log.Info.Printf("Configured to backup %d channels: %v", len(channelIDs), channelIDs)
+
+	for _, channelID := range channelIDs {
+		s.backupChannel(log, tally, channelID)
+	}
+	return nil
+}
+
+// backupChannel backs up one channel, tagging its log lines with the channel
+func (s *SlackService) backupChannel(log *logger.Logger, tally *runTally, channelID string) {
+	channelName := s.GetChannelName(channelID)
+	c := s.newCollector(log.With("channel", channelID, "channel_name", channelName))
+	c.tally = tally
+
+	c.log.Info.Printf("Starting backup for channel %s (#%s)", channelID, channelName)
+	if err := c.backupChannelMessages(channelID); err != nil {
+		c.log.Error.Printf("Failed to backup channel %s (#%s): %v", channelID, channelName, err)
+		tally.fail(channelID, err)
+		return
+	}
+	c.log.Info.Printf("Completed backup for channel %s (#%s)", channelID, channelName)
+}
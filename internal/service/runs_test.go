@@ -0,0 +1,55 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"backup_slack/internal/database"
+)
+
+func TestRunBackup(t *testing.T) {
+	s, store := newEventTestService(t)
+
+	run, err := s.RunBackup("scheduled", []string{"C123456"})
+	if err != nil {
+		t.Fatalf("RunBackup() error = %v", err)
+	}
+	wantChannels := []database.BackupRunChannel{
+		{ChannelID: "C123456", Messages: 1, Files: 1, BytesDownloaded: 11},
+	}
+	if run.ID != 1 || run.Status != database.RunSucceeded || run.Trigger != "scheduled" {
+		t.Errorf("RunBackup() = run %d %s triggered by %s, want run 1 succeeded triggered by scheduled",
+			run.ID, run.Status, run.Trigger)
+	}
+	if !reflect.DeepEqual(run.Channels, wantChannels) {
+		t.Errorf("RunBackup() channels = %+v, want %+v", run.Channels, wantChannels)
+	}
+	// auth.test, conversations.list and two pages of conversations.history
+	if run.APICalls != 4 || run.BytesDownloaded != 11 {
+		t.Errorf("RunBackup() = %d API calls, %d bytes, want 4 and 11", run.APICalls, run.BytesDownloaded)
+	}
+	if run.FinishedAt.Before(run.StartedAt) {
+		t.Errorf("RunBackup() finished at %v, before it started at %v", run.FinishedAt, run.StartedAt)
+	}
+
+	stored, err := store.GetBackupRun(run.ID)
+	if err != nil {
+		t.Fatalf("GetBackupRun() error = %v", err)
+	}
+	if !reflect.DeepEqual(stored, run) {
+		t.Errorf("GetBackupRun() = %+v, want %+v", stored, run)
+	}
+
+	// A channel the bot can't see fails the whole run, which is still recorded
+	failed, err := s.RunBackup("manual", []string{"C999999"})
+	if err == nil {
+		t.Fatal("RunBackup() with an inaccessible channel succeeded")
+	}
+	stored, err = store.GetBackupRun(failed.ID)
+	if err != nil {
+		t.Fatalf("GetBackupRun() error = %v", err)
+	}
+	if stored.ID != 2 || stored.Status != database.RunFailed || stored.Error == "" || stored.FinishedAt.IsZero() {
+		t.Errorf("GetBackupRun() = %+v, want run 2 failed with an error", stored)
+	}
+}
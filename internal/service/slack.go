@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"backup_slack/internal/database"
@@ -13,12 +14,13 @@ import (
 
 type SlackService struct {
 	client      *slack.Client
-	db          *database.DB
+	db          database.Store
 	fileService *FileService
 	channels    map[string]slackapi.Channel
+	queued      atomic.Int64 // events and downloads waiting in a listener's queue
 }
 
-func NewSlackService(token string, db *database.DB, storagePath string) (*SlackService, error) {
+func NewSlackService(token string, db database.Store, storagePath string) (*SlackService, error) {
 	fileService, err := NewFileService(storagePath, 1024*1024*1024, db, token) // 1GB max file size
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file service: %w", err)
@@ -120,17 +122,24 @@ func (s *SlackService) storeChannels(channels []slackapi.Channel) error {
 	return nil
 }
 
-// BackupChannelMessages initiates message collection for a channel
-func (s *SlackService) BackupChannelMessages(channelID string) error {
-	channelName := s.channels[channelID].Name
-	logger.Info.Printf("Starting message backup for channel %s (#%s)", channelID, channelName)
+// backupChannelMessages initiates message collection for a channel
+func (c collector) backupChannelMessages(channelID string) error {
+	channelName := c.channels[channelID].Name
+	c.log.Info.Printf("Starting message backup for channel %s (#%s)", channelID, channelName)
 
-	messageCount, err := s.CollectMessages(channelID)
+	messageCount, err := c.collectMessages(channelID, "")
 	if err != nil {
 		return fmt.Errorf("failed to backup messages for channel %s (#%s): %w", channelID, channelName, err)
 	}
 
-	logger.Info.Printf("Backed up %d messages for channel %s (#%s)", messageCount, channelID, channelName)
+	if err := c.db.UpdateSyncState(database.SyncState{
+		ChannelID:  channelID,
+		LastSyncAt: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to record sync state for channel %s (#%s): %w", channelID, channelName, err)
+	}
+
+	c.log.Info.Printf("Backed up %d messages for channel %s (#%s)", messageCount, channelID, channelName)
 	return nil
 }
 
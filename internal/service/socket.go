@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"backup_slack/internal/logger"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// socketListener applies events received over a Socket Mode connection
+type socketListener struct {
+	*eventQueue
+	client     *socketmode.Client
+	channelIDs []string
+}
+
+// RunSocketMode receives events for the given channels over a Socket Mode
+// connection opened with the app-level token, until ctx is cancelled. The
+// connection is re-established whenever it drops, after which the channels
+// are polled to pick up anything sent in the gap.
+func (s *SlackService) RunSocketMode(ctx context.Context, appToken string, channelIDs []string) error {
+	client := s.client.SocketMode(appToken)
+	l := &socketListener{
+		eventQueue: s.newEventQueue(channelIDs),
+		client:     client,
+		channelIDs: channelIDs,
+	}
+	// Apply whatever was acknowledged before returning
+	defer l.Close()
+
+	// RunContext retries recoverable connection failures itself, so it
+	// only returns when ctx is cancelled or Slack rejects the token
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.RunContext(ctx)
+	}()
+
+	for {
+		select {
+		case err := <-errc:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to connect in Socket Mode: %w", err)
+		case evt := <-client.Events:
+			l.handle(evt)
+		}
+	}
+}
+
+func (l *socketListener) handle(evt socketmode.Event) {
+	switch evt.Type {
+	case socketmode.EventTypeConnected:
+		connected, ok := evt.Data.(*socketmode.ConnectedEvent)
+		if !ok || connected.ConnectionCount == 0 {
+			logger.Info.Printf("Connected to Slack in Socket Mode for %d channels", len(l.channelIDs))
+			return
+		}
+		logger.Info.Printf("Reconnected to Slack, catching up on %d channels", len(l.channelIDs))
+		if !l.push(l.catchUp) {
+			logger.Warn.Printf("Event queue full, skipping catch-up until the next backup")
+		}
+
+	case socketmode.EventTypeConnectionError:
+		if e, ok := evt.Data.(*slack.ConnectionErrorEvent); ok {
+			logger.Warn.Printf("Socket Mode connection attempt %d failed, retrying in %v: %v", e.Attempt, e.Backoff, e.ErrorObj)
+		}
+
+	case socketmode.EventTypeDisconnect:
+		logger.Info.Printf("Slack requested a reconnect")
+
+	case socketmode.EventTypeIncomingError:
+		logger.Warn.Printf("Socket Mode connection lost: %v", evt.Data)
+
+	case socketmode.EventTypeEventsAPI:
+		if evt.Request == nil {
+			return
+		}
+		var envelope struct {
+			EventID string          `json:"event_id"`
+			Event   json.RawMessage `json:"event"`
+		}
+		if err := json.Unmarshal(evt.Request.Payload, &envelope); err != nil {
+			logger.Warn.Printf("Failed to decode Socket Mode event: %v", err)
+			l.client.Ack(*evt.Request)
+			return
+		}
+		// Unacknowledged events are redelivered, so only ack queued ones
+		if !l.enqueue(envelope.Event) {
+			logger.Warn.Printf("Event queue full, leaving event %s for Slack to retry", envelope.EventID)
+			return
+		}
+		logger.Debug.Printf("Queued Slack event %s", envelope.EventID)
+		l.client.Ack(*evt.Request)
+
+	default:
+		logger.Debug.Printf("Ignoring Socket Mode event of type %s", evt.Type)
+	}
+}
+
+// catchUp collects messages sent while the connection was down
+func (l *socketListener) catchUp() error {
+	for _, channelID := range l.channelIDs {
+		c := l.service.newCollector(logger.With("channel", channelID))
+		oldest, err := l.catchUpFrom(channelID)
+		if err != nil {
+			c.log.Log.Error("Failed to catch up on channel", "error", err)
+			continue
+		}
+		count, err := c.collectMessages(channelID, oldest)
+		if err != nil {
+			c.log.Log.Error("Failed to catch up on channel", "error", err)
+			continue
+		}
+		c.log.Log.Info("Caught up on channel", "messages", count, "oldest", oldest)
+	}
+	return nil
+}
+
+// catchUpFrom returns the Slack timestamp a catch-up of the channel starts
+// from: its newest stored message or, for a channel without any, its last
+// backup. Older history is left to the scheduled backup, so reconnecting
+// doesn't crawl it again.
+func (l *socketListener) catchUpFrom(channelID string) (string, error) {
+	newest, err := l.service.db.GetLastMessageTimestamp(channelID)
+	if err != nil {
+		return "", err
+	}
+	if newest.Unix() > 0 {
+		return strconv.FormatInt(newest.Unix(), 10), nil
+	}
+
+	state, err := l.service.db.GetSyncState(channelID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get sync state: %w", err)
+	}
+	if state.LastSyncAt.IsZero() {
+		return "", nil
+	}
+	return strconv.FormatInt(state.LastSyncAt.Unix(), 10), nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+	slackclient "backup_slack/internal/slack"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+func socketEvent(channel, ts string) socketmode.Event {
+	payload := `{"type":"event_callback","event_id":"Ev` + ts + `","event":` +
+		`{"type":"message","channel":"` + channel + `","user":"U1","text":"live","ts":"` + ts + `"}}`
+	return socketmode.Event{
+		Type: socketmode.EventTypeEventsAPI,
+		Request: &socketmode.Request{
+			Type:       "events_api",
+			EnvelopeID: "env-" + ts,
+			Payload:    json.RawMessage(payload),
+		},
+	}
+}
+
+func connected(count int) socketmode.Event {
+	return socketmode.Event{
+		Type: socketmode.EventTypeConnected,
+		Data: &socketmode.ConnectedEvent{ConnectionCount: count},
+	}
+}
+
+func TestSocketListener(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []socketmode.Event
+		want   []string
+	}{
+		{
+			name:   "first connection",
+			events: []socketmode.Event{connected(0), socketEvent("C123456", "1700000300.000100")},
+			want:   []string{"1700000300.000100"},
+		},
+		{
+			name:   "other channel",
+			events: []socketmode.Event{connected(0), socketEvent("C999999", "1700000300.000100")},
+		},
+		{
+			name: "reconnect catches up",
+			events: []socketmode.Event{
+				connected(0),
+				socketEvent("C123456", "1700000300.000100"),
+				{Type: socketmode.EventTypeDisconnect},
+				connected(1),
+			},
+			want: []string{"1700000200.000100", "1700000300.000100"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newEventTestService(t)
+			l := &socketListener{
+				eventQueue: s.newEventQueue([]string{"C123456"}),
+				client:     s.client.SocketMode("xapp-test"),
+				channelIDs: []string{"C123456"},
+			}
+			for _, evt := range tt.events {
+				l.handle(evt)
+			}
+			l.Close()
+
+			msgs, err := store.GetMessages(database.MessageFilter{})
+			if err != nil {
+				t.Fatalf("GetMessages() error = %v", err)
+			}
+			var got []string
+			for _, msg := range msgs {
+				got = append(got, msg.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stored messages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSocketCatchUpFrom(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     string    // newest message already archived, if any
+		lastSync   time.Time // last backup, if any
+		wantOldest string
+	}{
+		{"from newest message", "1700000150.000100", time.Unix(1700000100, 0), "1700000150"},
+		{"from last backup", "", time.Unix(1700000100, 0), "1700000100"},
+		{"never backed up", "", time.Time{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store := newEventTestService(t)
+			if tt.stored != "" {
+				if err := store.InsertUser(database.User{ID: "U1", Username: "U1", FirstSeen: time.Now()}); err != nil {
+					t.Fatalf("InsertUser() error = %v", err)
+				}
+				if err := store.InsertMessage(database.Message{ID: tt.stored, ChannelID: "C123456", UserID: "U1",
+					Content: "seen", Timestamp: convertSlackTimestamp(tt.stored), MessageType: "message"}); err != nil {
+					t.Fatalf("InsertMessage() error = %v", err)
+				}
+			}
+			if !tt.lastSync.IsZero() {
+				if err := store.UpdateSyncState(database.SyncState{ChannelID: "C123456", LastSyncAt: tt.lastSync}); err != nil {
+					t.Fatalf("UpdateSyncState() error = %v", err)
+				}
+			}
+
+			var mu sync.Mutex
+			var oldest []string
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				oldest = append(oldest, r.FormValue("oldest"))
+				mu.Unlock()
+				if r.FormValue("latest") != "" {
+					io.WriteString(w, `{"ok":true,"messages":[]}`)
+					return
+				}
+				io.WriteString(w, `{"ok":true,"messages":[{"type":"message","user":"U1","text":"missed","ts":"1700000200.000100"}]}`)
+			}))
+			defer api.Close()
+			s.client = slackclient.NewClient("xoxb-test", slack.OptionAPIURL(api.URL+"/"))
+
+			l := &socketListener{eventQueue: s.newEventQueue([]string{"C123456"}), channelIDs: []string{"C123456"}}
+			if err := l.catchUp(); err != nil {
+				t.Fatalf("catchUp() error = %v", err)
+			}
+			l.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(oldest) == 0 {
+				t.Fatal("catchUp() requested no history")
+			}
+			for _, got := range oldest {
+				if got != tt.wantOldest {
+					t.Errorf("conversations.history requested with oldest=%q, want %q", got, tt.wantOldest)
+				}
+			}
+			if exists, _ := store.MessageExists("1700000200.000100"); !exists {
+				t.Error("Message sent in the gap was not stored")
+			}
+		})
+	}
+}
@@ -2,12 +2,16 @@ package slack
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"backup_slack/internal/logger"
+	"backup_slack/internal/metrics"
 
 	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
 	"golang.org/x/time/rate"
 )
 
@@ -15,42 +19,75 @@ type Client struct {
 	api         *slack.Client
 	rateLimiter *rate.Limiter
 	ctx         context.Context
+	token       string
+	options     []slack.Option
+	calls       atomic.Int64
 }
 
-func NewClient(token string) *Client {
+// NewClient returns a rate-limited client. Options are passed to the
+// underlying slack-go client, e.g. slack.OptionAPIURL in tests.
+func NewClient(token string, options ...slack.Option) *Client {
 	limiter := rate.NewLimiter(rate.Every(time.Minute/50), 50)
 
 	return &Client{
-		api:         slack.New(token),
+		api:         slack.New(token, options...),
 		rateLimiter: limiter,
 		ctx:         context.Background(),
+		token:       token,
+		options:     options,
 	}
 }
 
-func (c *Client) retryWithBackoff(f func() error) error {
+// SocketMode returns a Socket Mode client that connects with the app-level
+// token and shares this client's bot token and options
+func (c *Client) SocketMode(appToken string) *socketmode.Client {
+	options := append([]slack.Option{slack.OptionAppLevelToken(appToken)}, c.options...)
+	return socketmode.New(
+		slack.New(c.token, options...),
+		socketmode.OptionLog(logger.Debug),
+	)
+}
+
+// APICalls returns how many Slack API calls the client has made, retries
+// included
+func (c *Client) APICalls() int64 {
+	return c.calls.Load()
+}
+
+// retryWithBackoff calls f, the Slack API method named method, until it
+// succeeds or runs out of retries
+func (c *Client) retryWithBackoff(method string, f func() error) error {
 	maxRetries := 5
 	baseDelay := time.Second
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		start := time.Now()
 		if err := c.rateLimiter.Wait(c.ctx); err != nil {
 			return fmt.Errorf("rate limiter error: %w", err)
 		}
+		metrics.RateLimitWait.Add(time.Since(start).Seconds(), method)
+		metrics.APICalls.Inc(method)
+		c.calls.Add(1)
 
 		err := f()
 		if err == nil {
 			return nil
 		}
 
-		// Handle rate limits
-		if rateLimitErr, ok := err.(*slack.RateLimitedError); ok {
-			delay := time.Duration(rateLimitErr.RetryAfter) * time.Second
-			logger.Debug.Printf("Rate limited, waiting %v before retry", delay)
+		// Handle rate limits, which callers may have wrapped
+		var rateLimitErr *slack.RateLimitedError
+		if errors.As(err, &rateLimitErr) {
+			delay := rateLimitErr.RetryAfter
+			logger.Log.Debug("Rate limited, waiting before retry", "method", method, "wait", delay)
+			metrics.RateLimited.Inc(method)
+			metrics.RateLimitWait.Add(delay.Seconds(), method)
 			time.Sleep(delay)
 			continue
 		}
 
 		// Exponential backoff for other errors
 		delay := baseDelay * time.Duration(1<<uint(attempt))
+		logger.Log.Debug("Slack API call failed, retrying", "method", method, "attempt", attempt+1, "wait", delay, "error", err)
 		time.Sleep(delay)
 	}
 	return fmt.Errorf("failed after %d retries", maxRetries)
@@ -59,7 +96,7 @@ func (c *Client) retryWithBackoff(f func() error) error {
 // GetChannels returns all channels the bot has access to
 func (c *Client) GetChannels() ([]slack.Channel, error) {
 	var channels []slack.Channel
-	err := c.retryWithBackoff(func() error {
+	err := c.retryWithBackoff("conversations.list", func() error {
 		var err error
 		channels, _, err = c.api.GetConversations(&slack.GetConversationsParameters{
 			Types: []string{"public_channel", "private_channel"},
@@ -75,7 +112,7 @@ func (c *Client) GetChannels() ([]slack.Channel, error) {
 // ValidateAuth checks if the token is valid and returns basic auth info
 func (c *Client) ValidateAuth() (*slack.AuthTestResponse, error) {
 	var resp *slack.AuthTestResponse
-	err := c.retryWithBackoff(func() error {
+	err := c.retryWithBackoff("auth.test", func() error {
 		var err error
 		resp, err = c.api.AuthTest()
 		return err
@@ -86,25 +123,27 @@ func (c *Client) ValidateAuth() (*slack.AuthTestResponse, error) {
 	return resp, nil
 }
 
-// GetChannelMessages fetches messages from a channel since a specific timestamp
-func (c *Client) GetChannelMessages(channelID string, latest string, cursor string) ([]slack.Message, string, error) {
+// GetChannelMessages fetches messages from a channel sent after oldest and
+// before latest; either may be empty to leave that end open
+func (c *Client) GetChannelMessages(channelID, oldest, latest, cursor string) ([]slack.Message, string, error) {
 	var messages []slack.Message
 	var nextCursor string
-	err := c.retryWithBackoff(func() error {
+	err := c.retryWithBackoff("conversations.history", func() error {
 		params := &slack.GetConversationHistoryParameters{
 			ChannelID: channelID,
 			Limit:     200, // Increased from 100 to 200 for better performance
 			Cursor:    cursor,
 			Latest:    latest, // If empty, will get most recent messages
+			Oldest:    oldest,
 			Inclusive: false,
 		}
 
-		logger.Debug.Printf("Fetching messages: channel=%s cursor=%s latest=%s",
-			channelID, cursor, latest)
+		logger.Log.Debug("Fetching messages", "method", "conversations.history",
+			"channel", channelID, "cursor", cursor, "oldest", oldest, "latest", latest)
 
 		resp, err := c.api.GetConversationHistory(params)
 		if err != nil {
-			logger.Error.Printf("Slack API error for channel %s: %v", channelID, err)
+			logger.Log.Error("Slack API error", "method", "conversations.history", "channel", channelID, "error", err)
 			return fmt.Errorf("failed to get channel history: %w", err)
 		}
 
@@ -125,7 +164,7 @@ func (c *Client) GetChannelMessages(channelID string, latest string, cursor stri
 // GetMessageReplies fetches all replies in a thread
 func (c *Client) GetMessageReplies(channelID, threadTS string) ([]slack.Message, error) {
 	var messages []slack.Message
-	err := c.retryWithBackoff(func() error {
+	err := c.retryWithBackoff("conversations.replies", func() error {
 		params := &slack.GetConversationRepliesParameters{
 			ChannelID: channelID,
 			Timestamp: threadTS,
@@ -139,3 +178,18 @@ func (c *Client) GetMessageReplies(channelID, threadTS string) ([]slack.Message,
 	}
 	return messages, nil
 }
+
+// GetFileInfo fetches a file's metadata, including the messages it was
+// shared in
+func (c *Client) GetFileInfo(fileID string) (*slack.File, error) {
+	var file *slack.File
+	err := c.retryWithBackoff("files.info", func() error {
+		var err error
+		file, _, _, err = c.api.GetFileInfo(fileID, 0, 0)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return file, nil
+}
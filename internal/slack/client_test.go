@@ -0,0 +1,66 @@
+package slack
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"backup_slack/internal/logger"
+
+	"github.com/slack-go/slack"
+)
+
+func TestRetryWithBackoffRateLimited(t *testing.T) {
+	if err := logger.Init(t.TempDir(), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"bare", &slack.RateLimitedError{RetryAfter: 10 * time.Millisecond}},
+		{"wrapped", fmt.Errorf("failed to get messages: %w", &slack.RateLimitedError{RetryAfter: 10 * time.Millisecond})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient("xoxb-test")
+			calls := 0
+			start := time.Now()
+			err := c.retryWithBackoff("conversations.history", func() error {
+				calls++
+				if calls == 1 {
+					return tt.err
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("retryWithBackoff() error = %v", err)
+			}
+			if calls != 2 || c.APICalls() != 2 {
+				t.Errorf("Got %d calls, %d counted, want 2", calls, c.APICalls())
+			}
+			// Other errors back off for a second; rate limits wait RetryAfter
+			if elapsed := time.Since(start); elapsed < 10*time.Millisecond || elapsed >= time.Second {
+				t.Errorf("Retried after %v, want the 10ms Slack asked for", elapsed)
+			}
+		})
+	}
+}
+
+func TestRetryWithBackoffGivesUp(t *testing.T) {
+	if err := logger.Init(t.TempDir(), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	c := NewClient("xoxb-test")
+	calls := 0
+	err := c.retryWithBackoff("conversations.history", func() error {
+		calls++
+		return fmt.Errorf("failed to get messages: %w", &slack.RateLimitedError{RetryAfter: time.Millisecond})
+	})
+	if err == nil || calls != 5 {
+		t.Errorf("retryWithBackoff() = %v after %d calls, want an error after 5", err, calls)
+	}
+}
@@ -0,0 +1,19 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Permalink builds a link to a message in the form Slack uses for "Copy link".
+// Message IDs are Slack timestamps; the link drops their decimal point. When
+// workspaceURL is empty the path alone is returned so it can still be pasted
+// after the workspace's address.
+func Permalink(workspaceURL, channelID, messageTS, threadTS string) string {
+	link := fmt.Sprintf("%s/archives/%s/p%s",
+		strings.TrimRight(workspaceURL, "/"), channelID, strings.Replace(messageTS, ".", "", 1))
+	if threadTS != "" && threadTS != messageTS {
+		link += fmt.Sprintf("?thread_ts=%s&cid=%s", threadTS, channelID)
+	}
+	return link
+}
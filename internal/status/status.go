@@ -0,0 +1,167 @@
+// Package status reports on an archive: its last backup run, how recently
+// each channel was backed up and how much space it takes. The listener
+// serves reports over HTTP and the status command prints them.
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/files"
+)
+
+// Archive is the store a report is read from; *database.DB satisfies it
+type Archive interface {
+	database.Store
+	Size() (int64, error)
+	Ping() error
+}
+
+// Report is a snapshot of an archive
+type Report struct {
+	Time          time.Time `json:"time"`
+	Workspace     string    `json:"workspace,omitempty"`
+	LastRun       *Run      `json:"last_run"` // nil before the first backup
+	Channels      []Channel `json:"channels"`
+	Queued        *int64    `json:"queued,omitempty"` // events and downloads a running listener has yet to store
+	DatabaseBytes int64     `json:"database_bytes"`
+	StorageBytes  int64     `json:"storage_bytes"`
+}
+
+// Run summarizes a backup run
+type Run struct {
+	ID         int64      `json:"id"`
+	Trigger    string     `json:"trigger"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Messages   int        `json:"messages"`
+	Files      int        `json:"files"`
+}
+
+// Channel is how current the archive of one channel is
+type Channel struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name,omitempty"`
+	LastSyncAt *time.Time `json:"last_sync_at"` // nil if never backed up
+	Messages   int        `json:"messages"`
+}
+
+// Source gathers reports
+type Source struct {
+	Archive     Archive
+	Workspace   string
+	ChannelIDs  []string     // the stored channels if empty
+	StoragePath string       // where downloaded files are kept
+	Queued      func() int64 // set while a listener is running
+
+	now func() time.Time
+}
+
+// Report reads the current state of the archive
+func (s Source) Report() (Report, error) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	r := Report{Time: now().UTC(), Workspace: s.Workspace, Channels: []Channel{}}
+
+	runs, err := s.Archive.GetBackupRuns(1)
+	if err != nil {
+		return r, err
+	}
+	if len(runs) > 0 {
+		r.LastRun = newRun(runs[0])
+	}
+
+	stored, err := s.Archive.GetChannels()
+	if err != nil {
+		return r, err
+	}
+	names := make(map[string]string, len(stored))
+	for _, ch := range stored {
+		names[ch.ID] = ch.Name
+	}
+	channelIDs := s.ChannelIDs
+	if len(channelIDs) == 0 {
+		for _, ch := range stored {
+			channelIDs = append(channelIDs, ch.ID)
+		}
+	}
+
+	for _, channelID := range channelIDs {
+		ch := Channel{ID: channelID, Name: names[channelID]}
+		state, err := s.Archive.GetSyncState(channelID)
+		if err != nil {
+			return r, err
+		}
+		if !state.LastSyncAt.IsZero() {
+			lastSync := state.LastSyncAt.UTC()
+			ch.LastSyncAt = &lastSync
+		}
+		if ch.Messages, err = s.Archive.CountMessages(database.MessageFilter{ChannelIDs: []string{channelID}}); err != nil {
+			return r, err
+		}
+		r.Channels = append(r.Channels, ch)
+	}
+
+	if s.Queued != nil {
+		queued := s.Queued()
+		r.Queued = &queued
+	}
+	if r.DatabaseBytes, err = s.Archive.Size(); err != nil {
+		return r, err
+	}
+	if s.StoragePath != "" {
+		if r.StorageBytes, err = files.DirSize(s.StoragePath); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+func newRun(run database.BackupRun) *Run {
+	r := &Run{
+		ID:        run.ID,
+		Trigger:   run.Trigger,
+		Status:    run.Status,
+		Error:     run.Error,
+		StartedAt: run.StartedAt.UTC(),
+		Messages:  run.Messages(),
+		Files:     run.Files(),
+	}
+	if !run.FinishedAt.IsZero() {
+		finished := run.FinishedAt.UTC()
+		r.FinishedAt = &finished
+	}
+	return r
+}
+
+// ServeHealth answers /healthz: 200 while the database can be reached and
+// 503 otherwise
+func (s Source) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := s.Archive.Ping(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "database unavailable: %v\n", err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// ServeStatus answers /status with the report as JSON
+func (s Source) ServeStatus(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Report()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
@@ -0,0 +1,151 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+// memoryArchive adds the database-only methods to a MemoryStore
+type memoryArchive struct {
+	*database.MemoryStore
+	pingErr error
+}
+
+func (a memoryArchive) Size() (int64, error) { return 4096, nil }
+func (a memoryArchive) Ping() error          { return a.pingErr }
+
+func newTestSource(t *testing.T) Source {
+	t.Helper()
+	now := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	store := database.NewMemoryStore()
+	for _, ch := range []database.Channel{{ID: "C1", Name: "general"}, {ID: "C2", Name: "random"}} {
+		ch.ChannelType, ch.CreatedAt = "public_channel", now
+		if err := store.InsertChannel(ch); err != nil {
+			t.Fatalf("InsertChannel() error = %v", err)
+		}
+	}
+	if err := store.InsertUser(database.User{ID: "U1", Username: "U1", FirstSeen: now}); err != nil {
+		t.Fatalf("InsertUser() error = %v", err)
+	}
+	for _, id := range []string{"1709294400.000100", "1709294460.000100"} {
+		msg := database.Message{ID: id, ChannelID: "C1", UserID: "U1", Content: "hi", Timestamp: now, MessageType: "message"}
+		if err := store.InsertMessage(msg); err != nil {
+			t.Fatalf("InsertMessage() error = %v", err)
+		}
+	}
+	if err := store.UpdateSyncState(database.SyncState{ChannelID: "C1", LastSyncAt: now.Add(-time.Hour)}); err != nil {
+		t.Fatalf("UpdateSyncState() error = %v", err)
+	}
+	run := database.BackupRun{
+		StartedAt:  now.Add(-time.Hour),
+		FinishedAt: now.Add(-time.Hour + time.Minute),
+		Trigger:    "scheduled",
+		Status:     database.RunPartial,
+		Error:      "1 of 2 channels failed",
+		Channels: []database.BackupRunChannel{
+			{ChannelID: "C1", Messages: 2, Files: 1},
+			{ChannelID: "C2", Error: "not_in_channel"},
+		},
+	}
+	if _, err := store.SaveBackupRun(run); err != nil {
+		t.Fatalf("SaveBackupRun() error = %v", err)
+	}
+
+	storage := t.TempDir()
+	if err := os.WriteFile(filepath.Join(storage, "F1.png"), make([]byte, 100), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	return Source{
+		Archive:     memoryArchive{MemoryStore: store},
+		Workspace:   "acme",
+		ChannelIDs:  []string{"C1", "C2"},
+		StoragePath: storage,
+		now:         func() time.Time { return now },
+	}
+}
+
+func TestReport(t *testing.T) {
+	src := newTestSource(t)
+	r, err := src.Report()
+	if err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+
+	if r.Workspace != "acme" || r.DatabaseBytes != 4096 || r.StorageBytes != 100 || r.Queued != nil {
+		t.Errorf("Report() = %+v", r)
+	}
+	if r.LastRun == nil || r.LastRun.ID != 1 || r.LastRun.Status != database.RunPartial ||
+		r.LastRun.Messages != 2 || r.LastRun.Files != 1 || r.LastRun.FinishedAt == nil {
+		t.Errorf("LastRun = %+v", r.LastRun)
+	}
+	if len(r.Channels) != 2 {
+		t.Fatalf("Report() has %d channels, want 2", len(r.Channels))
+	}
+	if c := r.Channels[0]; c.ID != "C1" || c.Name != "general" || c.Messages != 2 ||
+		c.LastSyncAt == nil || !c.LastSyncAt.Equal(time.Date(2024, 3, 2, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Channels[0] = %+v", c)
+	}
+	if c := r.Channels[1]; c.ID != "C2" || c.Messages != 0 || c.LastSyncAt != nil {
+		t.Errorf("Channels[1] = %+v, want never synced", c)
+	}
+
+	// Without configured channels every stored one is reported
+	src.ChannelIDs = nil
+	src.Queued = func() int64 { return 3 }
+	if r, err = src.Report(); err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+	if len(r.Channels) != 2 || r.Queued == nil || *r.Queued != 3 {
+		t.Errorf("Report() = %+v, want both stored channels and 3 queued", r)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	src := newTestSource(t)
+
+	rec := httptest.NewRecorder()
+	src.ServeStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("/status = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode /status: %v", err)
+	}
+	run, _ := body["last_run"].(map[string]interface{})
+	channels, _ := body["channels"].([]interface{})
+	if run["status"] != "partial" || len(channels) != 2 || body["storage_bytes"] != 100.0 {
+		t.Errorf("/status body = %s", rec.Body.String())
+	}
+	if _, ok := body["queued"]; ok {
+		t.Errorf("/status reports a queue without a listener: %s", rec.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		pingErr  error
+		wantCode int
+	}{
+		{"healthy", nil, http.StatusOK},
+		{"database down", errors.New("connection refused"), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src.Archive = memoryArchive{MemoryStore: database.NewMemoryStore(), pingErr: tt.pingErr}
+			rec := httptest.NewRecorder()
+			src.ServeHealth(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("/healthz = %d %q, want %d", rec.Code, rec.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,564 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+// apiPrefix is the base path of the JSON API. Breaking changes get a new
+// version alongside this one.
+const apiPrefix = "/api/v1"
+
+const (
+	defaultAPILimit = 100
+	maxAPILimit     = 1000
+)
+
+// apiRoute is a JSON API endpoint. The OpenAPI document is generated from
+// the same table that registers the handlers, so the two can't drift apart.
+type apiRoute struct {
+	path        string // below apiPrefix, in ServeMux pattern syntax
+	operationID string
+	summary     string
+	params      []apiParam
+	response    interface{} // a zero value of the response body
+	handle      func(r *http.Request) (interface{}, error)
+}
+
+type apiParam struct {
+	name        string
+	in          string // "path" or "query"
+	typ         string // "string" or "integer"
+	description string
+}
+
+// apiError is an error reported to the client with its status code. Any
+// other error is logged and reported as a 500.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &apiError{http.StatusNotFound, fmt.Sprintf(format, args...)}
+}
+
+type apiErrorBody struct {
+	Error string `json:"error"`
+}
+
+type apiChannel struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	IsArchived bool      `json:"is_archived"`
+	CreatedAt  time.Time `json:"created_at"`
+	Topic      string    `json:"topic"`
+	Purpose    string    `json:"purpose"`
+}
+
+type apiUser struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	FirstSeen   time.Time `json:"first_seen"`
+}
+
+type apiMessage struct {
+	ID          string     `json:"id"`
+	ChannelID   string     `json:"channel_id"`
+	UserID      string     `json:"user_id"`
+	Text        string     `json:"text"`
+	Timestamp   time.Time  `json:"timestamp"`
+	ThreadTS    *string    `json:"thread_ts"`
+	IsReply     bool       `json:"is_reply"`
+	MessageType string     `json:"message_type"`
+	Deleted     bool       `json:"deleted"`
+	EditedAt    *time.Time `json:"edited_at"`
+}
+
+type apiFile struct {
+	ID         string    `json:"id"`
+	MessageID  string    `json:"message_id"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	SizeBytes  int64     `json:"size_bytes"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	URL        string    `json:"url"`         // on Slack
+	ContentURL *string   `json:"content_url"` // on this server, null if never downloaded
+	Checksum   string    `json:"checksum"`
+}
+
+type apiReaction struct {
+	MessageID string    `json:"message_id"`
+	UserID    string    `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type apiSyncState struct {
+	ChannelID     string     `json:"channel_id"`
+	ChannelName   string     `json:"channel_name"`
+	LastSyncAt    *time.Time `json:"last_sync_at"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+}
+
+type apiChannelList struct {
+	Channels []apiChannel `json:"channels"`
+}
+
+type apiUserList struct {
+	Users []apiUser `json:"users"`
+}
+
+type apiMessageList struct {
+	Messages []apiMessage `json:"messages"`
+}
+
+type apiMessagePage struct {
+	Messages   []apiMessage `json:"messages"`
+	NextCursor *string      `json:"next_cursor"` // null on the last page
+}
+
+type apiFileList struct {
+	Files []apiFile `json:"files"`
+}
+
+type apiReactionList struct {
+	Reactions []apiReaction `json:"reactions"`
+}
+
+type apiSyncStatus struct {
+	Channels []apiSyncState `json:"channels"`
+}
+
+var (
+	channelPathParam = apiParam{"channel", "path", "string", "Channel ID"}
+	channelParam     = apiParam{"channel", "query", "string", "Comma-separated channel IDs"}
+	userParam        = apiParam{"user", "query", "string", "Comma-separated user IDs"}
+	messageParam     = apiParam{"message", "query", "string", "Comma-separated message IDs (Slack timestamps)"}
+	threadParam      = apiParam{"thread", "query", "string", "Comma-separated thread parent IDs; returns whole threads, parents included"}
+	sinceParam       = apiParam{"since", "query", "string", "Only messages at or after this time, RFC 3339 or YYYY-MM-DD (UTC)"}
+	untilParam       = apiParam{"until", "query", "string", "Only messages before this time, RFC 3339 or YYYY-MM-DD (UTC)"}
+)
+
+// apiRoutes lists the JSON API's endpoints
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{
+			path:        "/channels",
+			operationID: "listChannels",
+			summary:     "List archived channels",
+			response:    apiChannelList{},
+			handle:      s.apiChannels,
+		},
+		{
+			path:        "/channels/{channel}",
+			operationID: "getChannel",
+			summary:     "Get a channel",
+			params:      []apiParam{channelPathParam},
+			response:    apiChannel{},
+			handle:      s.apiChannel,
+		},
+		{
+			path:        "/channels/{channel}/threads/{ts}",
+			operationID: "getThread",
+			summary:     "Get a thread, parent first, from its parent or any reply",
+			params:      []apiParam{channelPathParam, {"ts", "path", "string", "ID of the parent or a reply"}},
+			response:    apiMessageList{},
+			handle:      s.apiThread,
+		},
+		{
+			path:        "/users",
+			operationID: "listUsers",
+			summary:     "List users",
+			response:    apiUserList{},
+			handle:      s.apiUsers,
+		},
+		{
+			path:        "/messages",
+			operationID: "listMessages",
+			summary:     "List messages oldest first, a page at a time",
+			params: []apiParam{channelParam, userParam, threadParam, sinceParam, untilParam,
+				{"cursor", "query", "string", "next_cursor from the previous page"},
+				{"limit", "query", "integer", fmt.Sprintf("Page size, default %d, at most %d", defaultAPILimit, maxAPILimit)},
+			},
+			response: apiMessagePage{},
+			handle:   s.apiMessages,
+		},
+		{
+			path:        "/files",
+			operationID: "listFiles",
+			summary:     "List files attached to matching messages",
+			params:      []apiParam{channelParam, messageParam, userParam, sinceParam, untilParam},
+			response:    apiFileList{},
+			handle:      s.apiFiles,
+		},
+		{
+			path:        "/reactions",
+			operationID: "listReactions",
+			summary:     "List reactions on matching messages",
+			params:      []apiParam{channelParam, messageParam, userParam, sinceParam, untilParam},
+			response:    apiReactionList{},
+			handle:      s.apiReactions,
+		},
+		{
+			path:        "/sync",
+			operationID: "getSyncStatus",
+			summary:     "Show when each channel was last backed up",
+			response:    apiSyncStatus{},
+			handle:      s.apiSync,
+		},
+	}
+}
+
+// handleAPI wraps an endpoint with token auth and JSON encoding
+func (s *Server) handleAPI(route apiRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="backup_slack"`)
+			writeJSON(w, http.StatusUnauthorized, apiErrorBody{"missing or invalid API token"})
+			return
+		}
+
+		body, err := route.handle(r)
+		if err != nil {
+			var apiErr *apiError
+			if errors.As(err, &apiErr) {
+				writeJSON(w, apiErr.status, apiErrorBody{apiErr.message})
+				return
+			}
+			logger.Error.Printf("API request %s failed: %v", r.URL.Path, err)
+			writeJSON(w, http.StatusInternalServerError, apiErrorBody{"internal server error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// authorized reports whether the request carries one of the configured
+// bearer tokens. With no tokens configured the API is closed.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, t := range s.opts.APITokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) apiChannels(r *http.Request) (interface{}, error) {
+	channels, err := s.store.GetChannels()
+	if err != nil {
+		return nil, err
+	}
+	list := apiChannelList{Channels: make([]apiChannel, len(channels))}
+	for i, ch := range channels {
+		list.Channels[i] = toAPIChannel(ch)
+	}
+	return list, nil
+}
+
+func (s *Server) apiChannel(r *http.Request) (interface{}, error) {
+	ch, err := s.findChannel(r.PathValue("channel"))
+	if err != nil {
+		return nil, err
+	}
+	return toAPIChannel(ch), nil
+}
+
+func (s *Server) apiThread(r *http.Request) (interface{}, error) {
+	ch, err := s.findChannel(r.PathValue("channel"))
+	if err != nil {
+		return nil, err
+	}
+
+	ts := r.PathValue("ts")
+	found, err := s.store.GetMessages(database.MessageFilter{ChannelIDs: []string{ch.ID}, MessageIDs: []string{ts}})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, notFound("message %s not found in channel %s", ts, ch.ID)
+	}
+	root := found[0].ID
+	if found[0].ThreadTS.Valid && found[0].ThreadTS.String != "" {
+		root = found[0].ThreadTS.String
+	}
+
+	messages, err := s.store.GetMessages(database.MessageFilter{ChannelIDs: []string{ch.ID}, ThreadTS: []string{root}})
+	if err != nil {
+		return nil, err
+	}
+	list := apiMessageList{Messages: make([]apiMessage, len(messages))}
+	for i, msg := range messages {
+		list.Messages[i] = toAPIMessage(msg)
+	}
+	return list, nil
+}
+
+func (s *Server) apiUsers(r *http.Request) (interface{}, error) {
+	users, err := s.store.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	list := apiUserList{Users: make([]apiUser, len(users))}
+	for i, u := range users {
+		list.Users[i] = apiUser{
+			ID:          u.ID,
+			Username:    u.Username,
+			DisplayName: u.DisplayName,
+			AvatarURL:   u.AvatarURL,
+			FirstSeen:   u.FirstSeen.UTC(),
+		}
+	}
+	return list, nil
+}
+
+func (s *Server) apiMessages(r *http.Request) (interface{}, error) {
+	filter, err := apiFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+
+	limit := defaultAPILimit
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAPILimit {
+			return nil, badRequest("limit must be between 1 and %d", maxAPILimit)
+		}
+	}
+	// A cursor orders messages by ID, so the first page starts from one
+	// before every ID to be ordered the same way as the rest
+	filter.AfterID = query.Get("cursor")
+	if filter.AfterID == "" {
+		filter.AfterID = "0"
+	}
+	// One extra tells us whether there's another page
+	filter.Limit = limit + 1
+
+	messages, err := s.store.GetMessages(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := apiMessagePage{Messages: make([]apiMessage, 0, len(messages))}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		next := messages[limit-1].ID
+		page.NextCursor = &next
+	}
+	for _, msg := range messages {
+		page.Messages = append(page.Messages, toAPIMessage(msg))
+	}
+	return page, nil
+}
+
+func (s *Server) apiFiles(r *http.Request) (interface{}, error) {
+	filter, err := apiFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.store.GetFiles(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	list := apiFileList{Files: make([]apiFile, len(files))}
+	for i, f := range files {
+		list.Files[i] = apiFile{
+			ID:         f.ID,
+			MessageID:  f.MessageID,
+			Name:       f.FileName,
+			Type:       f.FileType,
+			SizeBytes:  f.SizeBytes,
+			UploadedAt: f.UploadTimestamp.UTC(),
+			URL:        f.OriginalURL,
+			Checksum:   f.Checksum,
+		}
+		if f.LocalPath != "" && s.inStorage(f.LocalPath) {
+			href := "/files/" + f.MessageID + "/" + f.ID
+			list.Files[i].ContentURL = &href
+		}
+	}
+	return list, nil
+}
+
+func (s *Server) apiReactions(r *http.Request) (interface{}, error) {
+	filter, err := apiFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := s.store.GetReactions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	list := apiReactionList{Reactions: make([]apiReaction, len(reactions))}
+	for i, re := range reactions {
+		list.Reactions[i] = apiReaction{
+			MessageID: re.MessageID,
+			UserID:    re.UserID,
+			Emoji:     re.Emoji,
+			Timestamp: re.Timestamp.UTC(),
+		}
+	}
+	return list, nil
+}
+
+func (s *Server) apiSync(r *http.Request) (interface{}, error) {
+	channels, err := s.store.GetChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	status := apiSyncStatus{Channels: make([]apiSyncState, len(channels))}
+	for i, ch := range channels {
+		state, err := s.store.GetSyncState(ch.ID)
+		if err != nil {
+			return nil, err
+		}
+		last, err := s.store.GetLastMessageTimestamp(ch.ID)
+		if err != nil {
+			return nil, err
+		}
+		status.Channels[i] = apiSyncState{
+			ChannelID:     ch.ID,
+			ChannelName:   ch.Name,
+			LastSyncAt:    optionalTime(state.LastSyncAt),
+			LastMessageAt: optionalTime(last),
+		}
+	}
+	return status, nil
+}
+
+func (s *Server) findChannel(id string) (database.Channel, error) {
+	channels, err := s.store.GetChannels()
+	if err != nil {
+		return database.Channel{}, err
+	}
+	for _, ch := range channels {
+		if ch.ID == id {
+			return ch, nil
+		}
+	}
+	return database.Channel{}, notFound("channel %s not found", id)
+}
+
+// apiFilter reads the filter query parameters shared by the list endpoints
+func apiFilter(r *http.Request) (database.MessageFilter, error) {
+	query := r.URL.Query()
+	list := func(name string) []string {
+		var values []string
+		for _, v := range strings.Split(query.Get(name), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+
+	filter := database.MessageFilter{
+		ChannelIDs: list("channel"),
+		UserIDs:    list("user"),
+		MessageIDs: list("message"),
+		ThreadTS:   list("thread"),
+	}
+	var err error
+	if filter.Since, err = parseAPITime(query.Get("since")); err != nil {
+		return filter, badRequest("invalid since: %v", err)
+	}
+	if filter.Until, err = parseAPITime(query.Get("until")); err != nil {
+		return filter, badRequest("invalid until: %v", err)
+	}
+	return filter, nil
+}
+
+// parseAPITime accepts RFC 3339 times and YYYY-MM-DD dates, taken as
+// midnight UTC. An empty string is the zero time.
+func parseAPITime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 or YYYY-MM-DD, got %q", value)
+	}
+	return t, nil
+}
+
+func toAPIChannel(ch database.Channel) apiChannel {
+	return apiChannel{
+		ID:         ch.ID,
+		Name:       ch.Name,
+		Type:       ch.ChannelType,
+		IsArchived: ch.IsArchived,
+		CreatedAt:  ch.CreatedAt.UTC(),
+		Topic:      ch.Topic,
+		Purpose:    ch.Purpose,
+	}
+}
+
+func toAPIMessage(msg database.Message) apiMessage {
+	m := apiMessage{
+		ID:          msg.ID,
+		ChannelID:   msg.ChannelID,
+		UserID:      msg.UserID,
+		Text:        msg.Content,
+		Timestamp:   msg.Timestamp.UTC(),
+		IsReply:     msg.ThreadTS.Valid && msg.ThreadTS.String != "" && msg.ThreadTS.String != msg.ID,
+		MessageType: msg.MessageType,
+		Deleted:     msg.IsDeleted,
+	}
+	if msg.ThreadTS.Valid && msg.ThreadTS.String != "" {
+		m.ThreadTS = &msg.ThreadTS.String
+	}
+	if msg.LastEdited.Valid {
+		edited := msg.LastEdited.Time.UTC()
+		m.EditedAt = &edited
+	}
+	return m
+}
+
+// optionalTime returns nil for times the store uses to mean "never"
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() || t.Unix() == 0 {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		logger.Warn.Printf("Failed to write API response: %v", err)
+	}
+}
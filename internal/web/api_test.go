@@ -0,0 +1,229 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+)
+
+// apiGet fetches path with the test token and decodes the JSON response
+func apiGet(t *testing.T, srv *Server, path string, token string, v interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("GET %s Content-Type = %q, want application/json", path, got)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s returned invalid JSON: %v", path, err)
+	}
+	return rec.Code
+}
+
+func TestAPIAuth(t *testing.T) {
+	srv := newTestServer(t)
+	closed := New(srv.store, Options{})
+
+	tests := []struct {
+		name   string
+		srv    *Server
+		token  string
+		status int
+	}{
+		{"No token", srv, "", http.StatusUnauthorized},
+		{"Wrong token", srv, "guess", http.StatusUnauthorized},
+		{"Valid token", srv, testToken, http.StatusOK},
+		{"No tokens configured", closed, testToken, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			if got := apiGet(t, tt.srv, "/api/v1/channels", tt.token, &body); got != tt.status {
+				t.Errorf("Status = %d, want %d", got, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && body["error"] == nil {
+				t.Errorf("Body = %v, want an error", body)
+			}
+		})
+	}
+}
+
+func TestAPIMessagesPagination(t *testing.T) {
+	srv := newTestServer(t)
+
+	seen := make(map[string]bool)
+	var pages []int
+	last := ""
+	cursor := ""
+	for {
+		var page apiMessagePage
+		path := "/api/v1/messages?channel=C1&limit=20&cursor=" + url.QueryEscape(cursor)
+		if status := apiGet(t, srv, path, testToken, &page); status != http.StatusOK {
+			t.Fatalf("GET %s status = %d", path, status)
+		}
+		pages = append(pages, len(page.Messages))
+		for _, msg := range page.Messages {
+			if msg.ID <= last || seen[msg.ID] {
+				t.Fatalf("Message %s out of order or repeated", msg.ID)
+			}
+			seen[msg.ID] = true
+			last = msg.ID
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		cursor = *page.NextCursor
+	}
+
+	if len(seen) != pageSize+2 || len(pages) != 3 || pages[2] != 12 {
+		t.Errorf("Paged through %d messages in pages %v, want %d in 20, 20, 12", len(seen), pages, pageSize+2)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	srv := newTestServer(t)
+	if err := srv.store.UpdateSyncState(database.SyncState{ChannelID: "C1", LastSyncAt: base.Add(2 * time.Hour)}); err != nil {
+		t.Fatalf("UpdateSyncState() error = %v", err)
+	}
+
+	t.Run("Channels", func(t *testing.T) {
+		var list apiChannelList
+		apiGet(t, srv, "/api/v1/channels", testToken, &list)
+		if len(list.Channels) != 1 || list.Channels[0].Name != "general" || list.Channels[0].Topic != "Company news" {
+			t.Errorf("Channels = %+v, want general", list.Channels)
+		}
+
+		var body apiErrorBody
+		if status := apiGet(t, srv, "/api/v1/channels/C9", testToken, &body); status != http.StatusNotFound {
+			t.Errorf("Unknown channel status = %d, want 404", status)
+		}
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		var list apiUserList
+		apiGet(t, srv, "/api/v1/users", testToken, &list)
+		if len(list.Users) != 2 || list.Users[0].DisplayName != "Alice" {
+			t.Errorf("Users = %+v, want Alice and bob", list.Users)
+		}
+	})
+
+	t.Run("Message filters", func(t *testing.T) {
+		var page apiMessagePage
+		apiGet(t, srv, "/api/v1/messages?user=U1", testToken, &page)
+		if len(page.Messages) != 1 || page.Messages[0].Text != "Lunch?" || page.NextCursor != nil {
+			t.Errorf("Messages by U1 = %+v, want only Lunch?", page)
+		}
+
+		page = apiMessagePage{}
+		apiGet(t, srv, "/api/v1/messages?thread="+ts(0), testToken, &page)
+		if len(page.Messages) != 2 || !page.Messages[1].IsReply || *page.Messages[1].ThreadTS != ts(0) {
+			t.Errorf("Messages in thread = %+v, want parent and reply", page.Messages)
+		}
+	})
+
+	t.Run("Bad parameters", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/messages?limit=0", "/api/v1/messages?limit=5000", "/api/v1/files?since=yesterday"} {
+			var body apiErrorBody
+			if status := apiGet(t, srv, path, testToken, &body); status != http.StatusBadRequest || body.Error == "" {
+				t.Errorf("GET %s = %d %q, want 400 with an error", path, status, body.Error)
+			}
+		}
+	})
+
+	t.Run("Thread", func(t *testing.T) {
+		var list apiMessageList
+		apiGet(t, srv, "/api/v1/channels/C1/threads/"+ts(time.Minute), testToken, &list)
+		if len(list.Messages) != 2 || list.Messages[0].ID != ts(0) {
+			t.Errorf("Thread from reply = %+v, want parent first", list.Messages)
+		}
+
+		var body apiErrorBody
+		if status := apiGet(t, srv, "/api/v1/channels/C1/threads/123.456", testToken, &body); status != http.StatusNotFound {
+			t.Errorf("Unknown thread status = %d, want 404", status)
+		}
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		var list apiFileList
+		apiGet(t, srv, "/api/v1/files?message="+ts(0), testToken, &list)
+		urls := make(map[string]*string)
+		for _, f := range list.Files {
+			urls[f.ID] = f.ContentURL
+		}
+		if len(list.Files) != 3 || urls["F1"] == nil || *urls["F1"] != "/files/"+ts(0)+"/F1" || urls["F3"] != nil {
+			t.Errorf("Files = %+v, want F1 served and F3 not", list.Files)
+		}
+	})
+
+	t.Run("Reactions", func(t *testing.T) {
+		var list apiReactionList
+		apiGet(t, srv, "/api/v1/reactions?channel=C1", testToken, &list)
+		if len(list.Reactions) != 1 || list.Reactions[0].Emoji != "thumbsup" {
+			t.Errorf("Reactions = %+v, want thumbsup", list.Reactions)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		var status apiSyncStatus
+		apiGet(t, srv, "/api/v1/sync", testToken, &status)
+		if len(status.Channels) != 1 || status.Channels[0].LastSyncAt == nil ||
+			!status.Channels[0].LastSyncAt.Equal(base.Add(2*time.Hour)) || status.Channels[0].LastMessageAt == nil {
+			t.Errorf("Sync = %+v, want C1 synced", status.Channels)
+		}
+	})
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := newTestServer(t)
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]struct {
+			Get struct {
+				OperationID string `json:"operationId"`
+				Responses   map[string]struct {
+					Content map[string]struct {
+						Schema map[string]interface{} `json:"schema"`
+					} `json:"content"`
+				} `json:"responses"`
+			} `json:"get"`
+		} `json:"paths"`
+	}
+	// The document is public so clients can be generated without a token
+	if status := apiGet(t, srv, "/api/v1/openapi.json", "", &doc); status != http.StatusOK {
+		t.Fatalf("Status = %d, want 200", status)
+	}
+
+	if doc.OpenAPI == "" {
+		t.Error("Missing openapi version")
+	}
+	for _, route := range srv.apiRoutes() {
+		op, ok := doc.Paths[apiPrefix+route.path]
+		if !ok || op.Get.OperationID != route.operationID {
+			t.Errorf("Path %s missing or has operationId %q", route.path, op.Get.OperationID)
+		}
+	}
+
+	schema := doc.Paths["/api/v1/messages"].Get.Responses["200"].Content["application/json"].Schema
+	props, _ := schema["properties"].(map[string]interface{})
+	cursor, _ := props["next_cursor"].(map[string]interface{})
+	if cursor["type"] != "string" || cursor["nullable"] != true {
+		t.Errorf("next_cursor schema = %v, want nullable string", cursor)
+	}
+	messages, _ := props["messages"].(map[string]interface{})
+	items, _ := messages["items"].(map[string]interface{})
+	fields, _ := items["properties"].(map[string]interface{})
+	if ts, _ := fields["timestamp"].(map[string]interface{}); ts["format"] != "date-time" {
+		t.Errorf("Message timestamp schema = %v, want date-time", ts)
+	}
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openAPI builds an OpenAPI 3 document describing apiRoutes. Response
+// schemas are reflected from the routes' response types and their json tags.
+func (s *Server) openAPI() map[string]interface{} {
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": jsonSchema(reflect.TypeOf(apiErrorBody{}))},
+			},
+		}
+	}
+
+	paths := make(map[string]interface{})
+	for _, route := range s.apiRoutes() {
+		params := []interface{}{}
+		for _, p := range route.params {
+			params = append(params, map[string]interface{}{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.description,
+				"required":    p.in == "path",
+				"schema":      map[string]interface{}{"type": p.typ},
+			})
+		}
+
+		responses := map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "OK",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": jsonSchema(reflect.TypeOf(route.response))},
+				},
+			},
+			"401": errorResponse("Missing or invalid API token"),
+		}
+		if len(route.params) > 0 {
+			responses["400"] = errorResponse("Invalid parameter")
+		}
+		if strings.Contains(route.path, "{") {
+			responses["404"] = errorResponse("Not found")
+		}
+
+		paths[apiPrefix+route.path] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"operationId": route.operationID,
+				"summary":     route.summary,
+				"parameters":  params,
+				"responses":   responses,
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "backup_slack API",
+			"version":     "1",
+			"description": "Read-only access to the Slack archive. Pass an API token as a bearer token.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"token": []interface{}{}}},
+	}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.openAPI())
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema returns the OpenAPI schema for values of type t as encoded by
+// encoding/json. Pointers are nullable.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := jsonSchema(t.Elem())
+		schema["nullable"] = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
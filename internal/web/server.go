@@ -0,0 +1,510 @@
+// Package web serves a read-only browser for the archive
+package web
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/format"
+	"backup_slack/internal/logger"
+	"backup_slack/internal/page"
+	"backup_slack/internal/slack"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"initial": page.Initial,
+}).ParseFS(templateFS, "templates/*.html"))
+
+// pageSize is the number of top-level messages per channel page
+const pageSize = 50
+
+// Options configures a Server
+type Options struct {
+	StoragePath  string   // files are only served from inside this directory
+	WorkspaceURL string   // links messages back to Slack when set
+	APITokens    []string // bearer tokens accepted by the JSON API; none closes it
+}
+
+// Server is an http.Handler that browses a Store. It only ever reads, so it
+// can run against the database while a backup is writing to it.
+type Server struct {
+	store database.Store
+	opts  Options
+	mux   *http.ServeMux
+}
+
+// New returns a Server for store
+func New(store database.Store, opts Options) *Server {
+	s := &Server{store: store, opts: opts, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("GET /static/style.css", handleStylesheet)
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /channels/{channel}", s.handleChannel)
+	s.mux.HandleFunc("GET /channels/{channel}/{ts}", s.handleThread)
+	s.mux.HandleFunc("GET /files/{message}/{file}", s.handleFile)
+	s.mux.HandleFunc("GET /search", s.handleSearch)
+
+	s.mux.HandleFunc("GET "+apiPrefix+"/openapi.json", s.handleOpenAPI)
+	for _, route := range s.apiRoutes() {
+		s.mux.HandleFunc("GET "+apiPrefix+route.path, s.handleAPI(route))
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type webChannel struct {
+	ID       string
+	Name     string
+	Private  bool
+	Archived bool
+	Topic    string
+}
+
+type webMessage struct {
+	ID        string
+	Author    string
+	AvatarURL string
+	Time      time.Time
+	HTML      template.HTML
+	EditedAt  time.Time
+	Deleted   bool
+	Highlight bool
+	Open      bool // show replies expanded
+	Permalink string
+	SlackURL  string
+	Reactions []page.Reaction
+	Files     []webFile
+	Replies   []webMessage
+}
+
+type webFile struct {
+	Name  string
+	Href  string // empty if the file was never downloaded
+	Image bool
+	Size  string
+}
+
+type webResult struct {
+	ChannelID   string
+	ChannelName string
+	Author      string
+	Time        time.Time
+	Snippet     string
+	Permalink   string
+}
+
+// view is what every page needs to render messages: channels and users by
+// ID, and a formatter resolving mentions against them
+type view struct {
+	channels map[string]database.Channel
+	users    map[string]database.User
+	format   *format.Formatter
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	v, err := s.view()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	var channels []webChannel
+	for _, ch := range v.channels {
+		channels = append(channels, v.channel(ch))
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+
+	s.render(w, "index.html", map[string]interface{}{"Channels": channels})
+}
+
+func (s *Server) handleChannel(w http.ResponseWriter, r *http.Request) {
+	v, err := s.view()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	ch, ok := v.channels[r.PathValue("channel")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	before := r.URL.Query().Get("before")
+	page, err := s.store.GetMessagePage(ch.ID, before, pageSize+1)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	older := ""
+	if len(page) > pageSize {
+		page = page[:pageSize]
+		older = page[pageSize-1].ID
+	}
+	// Pages are fetched newest first but read oldest first
+	for i, j := 0, len(page)-1; i < j; i, j = i+1, j-1 {
+		page[i], page[j] = page[j], page[i]
+	}
+
+	messages, err := s.messages(v, ch, page, "")
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	s.render(w, "channel.html", map[string]interface{}{
+		"Channel":  v.channel(ch),
+		"Messages": messages,
+		"Older":    older,
+		"Paged":    before != "",
+	})
+}
+
+// handleThread shows a message with its whole thread, highlighting it if
+// it's a reply. It's the permalink target for messages and search results.
+func (s *Server) handleThread(w http.ResponseWriter, r *http.Request) {
+	v, err := s.view()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	ch, ok := v.channels[r.PathValue("channel")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ts := r.PathValue("ts")
+	found, err := s.store.GetMessages(database.MessageFilter{ChannelIDs: []string{ch.ID}, MessageIDs: []string{ts}})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if len(found) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	root := found[0]
+	if root.ThreadTS.Valid && root.ThreadTS.String != "" && root.ThreadTS.String != root.ID {
+		parents, err := s.store.GetMessages(database.MessageFilter{ChannelIDs: []string{ch.ID}, MessageIDs: []string{root.ThreadTS.String}})
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		// Show the reply on its own if its parent was never backed up
+		if len(parents) > 0 {
+			root = parents[0]
+		}
+	}
+
+	messages, err := s.messages(v, ch, []database.Message{root}, ts)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	messages[0].Open = true
+
+	s.render(w, "thread.html", map[string]interface{}{
+		"Channel": v.channel(ch),
+		"Message": messages[0],
+	})
+}
+
+// handleFile serves a downloaded file with a content type based on its name.
+// Types a browser would run, such as HTML, are sent as downloads.
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	files, err := s.store.GetFiles(database.MessageFilter{MessageIDs: []string{r.PathValue("message")}})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	var file *database.File
+	for i := range files {
+		if files[i].ID == r.PathValue("file") {
+			file = &files[i]
+		}
+	}
+	if file == nil || file.LocalPath == "" || !s.inStorage(file.LocalPath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(file.LocalPath)
+	if err != nil {
+		logger.Warn.Printf("Failed to open file %s: %v", file.ID, err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(file.FileName))
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(file.LocalPath))
+	}
+	disposition := "inline"
+	if contentType == "" || !safeInline(contentType) {
+		disposition = "attachment"
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, file.FileName, info.ModTime(), f)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	input := strings.TrimSpace(r.URL.Query().Get("q"))
+	data := map[string]interface{}{"Query": input}
+	if input == "" {
+		s.render(w, "search.html", data)
+		return
+	}
+
+	query, err := database.ParseSearchQuery(input)
+	if err != nil {
+		data["Error"] = err.Error()
+		s.render(w, "search.html", data)
+		return
+	}
+	query.Limit = pageSize
+
+	found, err := s.store.SearchMessages(query)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	results := make([]webResult, len(found))
+	for i, res := range found {
+		results[i] = webResult{
+			ChannelID:   res.Message.ChannelID,
+			ChannelName: res.ChannelName,
+			Author:      res.Username,
+			Time:        res.Message.Timestamp.Local(),
+			Snippet:     res.Snippet,
+			Permalink:   permalink(res.Message),
+		}
+	}
+	data["Results"] = results
+	s.render(w, "search.html", data)
+}
+
+// view loads the channels and users every page needs
+func (s *Server) view() (*view, error) {
+	channels, err := s.store.GetChannels()
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.store.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &view{channels: make(map[string]database.Channel), users: make(map[string]database.User)}
+	names := format.Names{Users: make(map[string]string), Channels: make(map[string]string)}
+	for _, ch := range channels {
+		v.channels[ch.ID] = ch
+		names.Channels[ch.ID] = ch.Name
+	}
+	for _, u := range users {
+		v.users[u.ID] = u
+	}
+	for _, u := range users {
+		names.Users[u.ID] = v.userName(u.ID)
+	}
+	v.format = format.New(names)
+	return v, nil
+}
+
+// messages renders top-level messages with their replies, reactions and
+// files, highlighting the message with ID highlight
+func (s *Server) messages(v *view, ch database.Channel, top []database.Message, highlight string) ([]webMessage, error) {
+	if len(top) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(top))
+	for i, msg := range top {
+		ids[i] = msg.ID
+	}
+	all, err := s.store.GetMessages(database.MessageFilter{ChannelIDs: []string{ch.ID}, ThreadTS: ids})
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make(map[string][]database.Message)
+	ids = ids[:0]
+	for _, msg := range all {
+		ids = append(ids, msg.ID)
+		if msg.ThreadTS.Valid && msg.ThreadTS.String != msg.ID {
+			replies[msg.ThreadTS.String] = append(replies[msg.ThreadTS.String], msg)
+		}
+	}
+	filter := database.MessageFilter{MessageIDs: ids}
+
+	reactions := make(map[string][]database.Reaction)
+	found, err := s.store.GetReactions(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range found {
+		reactions[r.MessageID] = append(reactions[r.MessageID], r)
+	}
+
+	files := make(map[string][]database.File)
+	attached, err := s.store.GetFiles(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range attached {
+		files[f.MessageID] = append(files[f.MessageID], f)
+	}
+
+	convert := func(msg database.Message) webMessage {
+		u := v.users[msg.UserID]
+		wm := webMessage{
+			ID:        msg.ID,
+			Author:    v.userName(msg.UserID),
+			AvatarURL: u.AvatarURL,
+			Time:      msg.Timestamp.Local(),
+			HTML:      v.format.HTML(msg.Content),
+			Deleted:   msg.IsDeleted,
+			Highlight: msg.ID == highlight,
+			Permalink: permalink(msg),
+			Reactions: page.GroupReactions(reactions[msg.ID], v.userName),
+		}
+		if msg.LastEdited.Valid {
+			wm.EditedAt = msg.LastEdited.Time.Local()
+		}
+		if s.opts.WorkspaceURL != "" {
+			wm.SlackURL = slack.Permalink(s.opts.WorkspaceURL, msg.ChannelID, msg.ID, msg.ThreadTS.String)
+		}
+		for _, f := range files[msg.ID] {
+			wf := webFile{Name: f.FileName, Image: page.IsImage(f.FileType), Size: page.HumanSize(f.SizeBytes)}
+			if f.LocalPath != "" && s.inStorage(f.LocalPath) {
+				wf.Href = "/files/" + f.MessageID + "/" + f.ID
+			}
+			wm.Files = append(wm.Files, wf)
+		}
+		return wm
+	}
+
+	messages := make([]webMessage, len(top))
+	for i, msg := range top {
+		messages[i] = convert(msg)
+		for _, reply := range replies[msg.ID] {
+			wr := convert(reply)
+			messages[i].Open = messages[i].Open || wr.Highlight
+			messages[i].Replies = append(messages[i].Replies, wr)
+		}
+	}
+	return messages, nil
+}
+
+// inStorage reports whether path is inside the storage directory, so a
+// tampered database can't be used to read arbitrary files
+func (s *Server) inStorage(path string) bool {
+	if s.opts.StoragePath == "" {
+		return false
+	}
+	base, err := filepath.Abs(s.opts.StoragePath)
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(base, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s *Server) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		logger.Error.Printf("Failed to render %s: %v", name, err)
+	}
+}
+
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	logger.Error.Printf("Web request failed: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+func (v *view) channel(ch database.Channel) webChannel {
+	wc := webChannel{
+		ID:       ch.ID,
+		Name:     ch.Name,
+		Private:  ch.ChannelType != "public_channel",
+		Archived: ch.IsArchived,
+		Topic:    ch.Topic,
+	}
+	if wc.Name == "" {
+		wc.Name = ch.ID
+	}
+	return wc
+}
+
+// userName returns the best available name for a user ID
+func (v *view) userName(id string) string {
+	u, ok := v.users[id]
+	switch {
+	case !ok:
+		return id
+	case u.DisplayName != "":
+		return u.DisplayName
+	case u.Username != "":
+		return u.Username
+	}
+	return id
+}
+
+// permalink is the web UI's link to a message
+func permalink(msg database.Message) string {
+	return "/channels/" + msg.ChannelID + "/" + msg.ID + "#" + msg.ID
+}
+
+// handleStylesheet serves the stylesheet shared with the HTML export
+func handleStylesheet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	http.ServeContent(w, r, "style.css", time.Time{}, bytes.NewReader(page.Stylesheet))
+}
+
+// safeInline reports whether a browser can show a file of this type inline
+// without running anything in the archive's origin
+func safeInline(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"):
+		return true
+	case mediaType == "application/pdf", mediaType == "text/plain":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package web
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"backup_slack/internal/database"
+	"backup_slack/internal/logger"
+)
+
+const testToken = "secret-token"
+
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func ts(offset time.Duration) string {
+	return strconv.FormatInt(base.Add(offset).Unix(), 10) + ".000100"
+}
+
+// newTestServer serves a channel with a thread, a reaction and three files:
+// one in storage, one HTML file and one outside storage
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := logger.Init(filepath.Join(dir, "logs"), logger.LevelError); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	storage := filepath.Join(dir, "files")
+	if err := os.MkdirAll(storage, 0755); err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	for name, content := range map[string]string{
+		filepath.Join(storage, "F1.png"):  "not really a png",
+		filepath.Join(storage, "F2.html"): "<script>alert(1)</script>",
+		filepath.Join(dir, "secret.txt"):  "outside storage",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	s := database.NewMemoryStore()
+	err := s.Batch(func(w database.Writer) error {
+		if err := w.InsertChannel(database.Channel{ID: "C1", Name: "general", ChannelType: "public_channel", Topic: "Company news"}); err != nil {
+			return err
+		}
+		if err := w.InsertUser(database.User{ID: "U1", Username: "alice", DisplayName: "Alice"}); err != nil {
+			return err
+		}
+		if err := w.InsertUser(database.User{ID: "U2", Username: "bob"}); err != nil {
+			return err
+		}
+
+		thread := sql.NullString{String: ts(0), Valid: true}
+		messages := []database.Message{
+			{ID: ts(0), UserID: "U1", Content: "Lunch?", ThreadTS: thread},
+			{ID: ts(time.Minute), UserID: "U2", Content: "Sure, ask <@U1>", ThreadTS: thread},
+		}
+		// Enough messages for a second page
+		for i := 0; i < pageSize; i++ {
+			messages = append(messages, database.Message{ID: ts(time.Hour + time.Duration(i)*time.Minute), UserID: "U2", Content: "msg " + strconv.Itoa(i)})
+		}
+		for _, msg := range messages {
+			msg.ChannelID = "C1"
+			msg.MessageType = "message"
+			msg.Timestamp = base
+			if err := w.InsertMessage(msg); err != nil {
+				return err
+			}
+		}
+
+		if err := w.InsertReaction(database.Reaction{MessageID: ts(0), UserID: "U2", Emoji: "thumbsup", Timestamp: base}); err != nil {
+			return err
+		}
+		files := []database.File{
+			{ID: "F1", LocalPath: filepath.Join(storage, "F1.png"), FileName: "photo.png", FileType: "png"},
+			{ID: "F2", LocalPath: filepath.Join(storage, "F2.html"), FileName: "page.html", FileType: "html"},
+			{ID: "F3", LocalPath: filepath.Join(dir, "secret.txt"), FileName: "secret.txt", FileType: "text"},
+		}
+		for _, f := range files {
+			f.MessageID = ts(0)
+			if err := w.InsertFile(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate store: %v", err)
+	}
+
+	return New(s, Options{StoragePath: storage, WorkspaceURL: "https://example.slack.com", APITokens: []string{testToken}})
+}
+
+func get(t *testing.T, srv *Server, path string) (*http.Response, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+	return rec.Result(), string(body)
+}
+
+func TestServer(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		contains []string
+		excludes []string
+	}{
+		{"Index", "/", 200, []string{`href="/channels/C1"`, "#general", "Company news"}, nil},
+		{"Latest page", "/channels/C1", 200,
+			[]string{"msg 49", "msg 0", "?before=" + ts(time.Hour)},
+			[]string{"Lunch?", "Latest →"}},
+		{"Older page", "/channels/C1?before=" + ts(time.Hour), 200,
+			[]string{"Lunch?", "1 reply", "Sure, ask", "@Alice", "👍 1", "Latest →",
+				"/files/" + ts(0) + "/F1", "secret.txt</span>", "not downloaded"},
+			[]string{"msg 0", "← Older", "/files/" + ts(0) + "/F3"}},
+		{"Thread from reply", "/channels/C1/" + ts(time.Minute), 200,
+			[]string{"Lunch?", "Sure, ask", "highlight", "<details class=\"thread\" open>",
+				"https://example.slack.com/archives/C1/p" + strings.Replace(ts(time.Minute), ".", "", 1)},
+			nil},
+		{"Search", "/search?q=lunch", 200, []string{"Lunch", `href="/channels/C1/` + ts(0) + `#` + ts(0) + `"`}, nil},
+		{"Bad search", "/search?q=before:yesterday", 200, []string{`class="error"`}, nil},
+		{"Unknown channel", "/channels/C9", 404, nil, nil},
+		{"Unknown message", "/channels/C1/123.456", 404, nil, nil},
+		{"File outside storage", "/files/" + ts(0) + "/F3", 404, nil, nil},
+		{"Unknown file", "/files/" + ts(0) + "/F9", 404, nil, nil},
+		{"Stylesheet", "/static/style.css", 200, []string{".message"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(t, srv, tt.path)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, resp.StatusCode, tt.status)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(body, want) {
+					t.Errorf("GET %s missing %q", tt.path, want)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("GET %s contains %q", tt.path, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestServeFile(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		file        string
+		contentType string
+		disposition string
+	}{
+		{"F1", "image/png", `inline; filename=photo.png`},
+		{"F2", "text/html; charset=utf-8", `attachment; filename=page.html`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			resp, _ := get(t, srv, "/files/"+ts(0)+"/"+tt.file)
+			if resp.StatusCode != 200 {
+				t.Fatalf("Status = %d, want 200", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := resp.Header.Get("Content-Disposition"); got != tt.disposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, tt.disposition)
+			}
+			if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+		})
+	}
+}
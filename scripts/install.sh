@@ -20,4 +20,6 @@ sudo chmod 755 /var/log/backup_slack
 
 # Install systemd service template
 sudo cp ./scripts/systemd/backup-slack@.service /etc/systemd/system/
+sudo cp ./scripts/systemd/backup-slack-listen@.service /etc/systemd/system/
+sudo cp ./scripts/systemd/backup-slack-check@.service ./scripts/systemd/backup-slack-check@.timer /etc/systemd/system/
 sudo systemctl daemon-reload
\ No newline at end of file
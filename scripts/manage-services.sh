@@ -19,6 +19,9 @@ case "$1" in
             echo "=== $name ==="
             sudo systemctl status backup-slack@"$name" --no-pager
             echo
+            (cd "$workspace" && sudo -u backup-slack env ENVIRONMENT=production WORKSPACE="$name" \
+                /opt/backup_slack/bin/backup_slack status)
+            echo
         done
         ;;
     *)